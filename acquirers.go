@@ -12,7 +12,11 @@ type AcquirerService service
 type AcquirerList []Country
 
 type Acquirer struct {
-	//TODO: define structure fields
+	Code        string         `json:"code"`
+	Name        string         `json:"name"`
+	Country     int            `json:"country"`
+	Currency    int            `json:"currency"`
+	Preferences PreferenceList `json:"preferences"`
 }
 
 func (c *AcquirerService) GetList(ctx context.Context, v interface{}) (err error) {
@@ -26,3 +30,11 @@ func (c *AcquirerService) GetDetails(ctx context.Context, code int, v interface{
 	url := url.URL{Path: fmt.Sprintf("%s/%d", path, code)}
 	return c.client.processRequest(ctx, http.MethodGet, url, nil, v)
 }
+
+// GetByCode returns an acquirer by the code merchants refer to it with,
+// e.g. "cbq".
+func (c *AcquirerService) GetByCode(ctx context.Context, code string, v interface{}) (err error) {
+	path := "acquirers/%s"
+	rel := url.URL{Path: fmt.Sprintf(path, code)}
+	return c.client.send(ctx, "get acquirer", http.MethodGet, rel, nil, v)
+}
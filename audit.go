@@ -0,0 +1,249 @@
+package softpos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a mutating call made through the client. Hash covers the
+// entry and the hash of the previous one, chaining the log.
+type AuditEntry struct {
+	Seq      uint64          `json:"seq"`
+	Time     time.Time       `json:"time"`
+	Operator string          `json:"operator"`
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	PrevHash string          `json:"prevHash"`
+	Hash     string          `json:"hash"`
+}
+
+func (e *AuditEntry) computeHash() (string, error) {
+	c := *e
+	c.Hash = ""
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Auditor records mutating calls. Seq, PrevHash and Hash are filled in by
+// the implementation.
+type Auditor interface {
+	Record(ctx context.Context, e *AuditEntry) error
+}
+
+type operatorKey struct{}
+
+// WithOperator returns a context carrying the identity recorded in audit
+// entries of calls made with it.
+func WithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+func OperatorFromContext(ctx context.Context) string {
+	op, _ := ctx.Value(operatorKey{}).(string)
+	return op
+}
+
+// SetAuditor enables auditing of POST, PATCH and PUT requests. A nil
+// auditor disables it.
+func (c *Client) SetAuditor(a Auditor) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.auditor = a
+}
+
+func (c *Client) getAuditor() Auditor {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	return c.auditor
+}
+
+func audited(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodPut
+}
+
+// auditedFields are redacted from request bodies, compared without case.
+var auditedFields = map[string]bool{
+	"keyvalue": true, "key": true, "pin": true, "pinblock": true, "password": true,
+	"secret": true, "token": true, "apikey": true, "authorization": true, "pan": true,
+}
+
+const redacted = "[REDACTED]"
+
+// redactBody returns the JSON body with sensitive fields replaced.
+func redactBody(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	b, ok := redactJSON(body)
+	if !ok {
+		b, _ = json.Marshal(fmt.Sprintf("[non-JSON body of %d bytes]", len(body)))
+	}
+	return b
+}
+
+// redactJSON returns body compacted with sensitive fields replaced, or
+// false if it is not JSON. Numbers are kept as written.
+func redactJSON(body []byte) ([]byte, bool) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+	b, _ := json.Marshal(redactValue(v))
+	return b, true
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if auditedFields[strings.ToLower(k)] {
+				t[k] = redacted
+			} else {
+				t[k] = redactValue(val)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i])
+		}
+	}
+	return v
+}
+
+// audit records a finished mutating request.
+func (c *Client) audit(a Auditor, req *http.Request, body []byte, res *http.Response, callErr error) error {
+	e := &AuditEntry{
+		Time:     time.Now().UTC(),
+		Operator: OperatorFromContext(req.Context()),
+		Method:   req.Method,
+		Endpoint: req.URL.Path,
+		Body:     redactBody(body),
+	}
+	if res != nil {
+		e.Status = res.StatusCode
+	}
+	if callErr != nil {
+		e.Error = callErr.Error()
+	}
+	return a.Record(req.Context(), e)
+}
+
+// AuditLog is an Auditor writing a hash-chained, append-only file of JSON
+// entries, one per line.
+type AuditLog struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+// OpenAuditLog opens or creates the log at path. An existing log is
+// verified first so new entries never extend a tampered chain.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	v, err := VerifyAuditLog(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+	return &AuditLog{file: f, seq: uint64(v.Entries), lastHash: v.LastHash}, nil
+}
+
+func (l *AuditLog) Record(ctx context.Context, e *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	e.Seq = l.seq + 1
+	e.PrevHash = l.lastHash
+	hash, err := e.computeHash()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.lastHash = e.Seq, e.Hash
+	return nil
+}
+
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// AuditVerification is the result of a successful verification. Keep
+// LastHash elsewhere to detect truncation of the log later.
+type AuditVerification struct {
+	Entries  int
+	LastHash string
+}
+
+// VerifyAuditLog checks sequence numbers, hash links and entry hashes. It
+// reports the first broken entry with ErrAuditGap or ErrAuditTampered.
+func VerifyAuditLog(r io.Reader) (AuditVerification, error) {
+	v := AuditVerification{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		e := AuditEntry{}
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return v, fmt.Errorf("line %d: %v: %w", line, err, ErrAuditTampered)
+		}
+		if e.Seq != uint64(v.Entries)+1 {
+			return v, fmt.Errorf("line %d: seq %d after %d: %w", line, e.Seq, v.Entries, ErrAuditGap)
+		}
+		if e.PrevHash != v.LastHash {
+			return v, fmt.Errorf("entry %d: previous hash mismatch: %w", e.Seq, ErrAuditTampered)
+		}
+		if hash, err := e.computeHash(); err != nil || hash != e.Hash {
+			return v, fmt.Errorf("entry %d: hash mismatch: %w", e.Seq, ErrAuditTampered)
+		}
+		v.Entries++
+		v.LastHash = e.Hash
+	}
+	return v, sc.Err()
+}
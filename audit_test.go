@@ -0,0 +1,132 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/terminals/ref-1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPatch)
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["keyValue"] != "0123456789ABCDEF" {
+			t.Errorf("request body = %v, %v; want the unredacted body", body, err)
+		}
+	})
+	mux.HandleFunc("/terminals/ref-2", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("OpenAuditLog error = %v", err)
+	}
+	c.SetAuditor(log)
+
+	ctx := WithOperator(context.Background(), "alice")
+	patch := map[string]interface{}{
+		"description": "front desk",
+		"keys":        []interface{}{map[string]interface{}{"keyType": "TMK", "keyValue": "0123456789ABCDEF"}},
+	}
+	if err := c.TerminalService.Update(ctx, "ref-1", map[string]interface{}{"keyValue": "0123456789ABCDEF"}); err != nil {
+		t.Fatalf("Update error = %v", err)
+	}
+	if err := c.TerminalService.Update(ctx, "ref-2", patch); !errors.Is(err, ErrEntityNotFound) {
+		t.Fatalf("Update error = %v, want %v", err, ErrEntityNotFound)
+	}
+	if err := c.TerminalService.GetKeys(ctx, "m", "t", &[]Keys{}); err == nil {
+		t.Fatal("GetKeys of unknown terminal succeeded")
+	}
+	log.Close()
+
+	// Reopening resumes the chain.
+	if log, err = OpenAuditLog(path); err != nil {
+		t.Fatalf("OpenAuditLog error = %v", err)
+	}
+	c.SetAuditor(log)
+	if err := c.TerminalService.Update(ctx, "ref-1", map[string]interface{}{"keyValue": "0123456789ABCDEF"}); err != nil {
+		t.Fatalf("Update error = %v", err)
+	}
+	log.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := VerifyAuditLog(bytes.NewReader(data))
+	if err != nil || v.Entries != 3 {
+		t.Fatalf("VerifyAuditLog = %+v, %v; want 3 entries", v, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	entries := make([]AuditEntry, len(lines))
+	for i, l := range lines {
+		if err := json.Unmarshal([]byte(l), &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e := entries[1]; e.Operator != "alice" || e.Method != http.MethodPatch || e.Status != http.StatusNotFound ||
+		!strings.HasSuffix(e.Endpoint, "/terminals/ref-2") || e.Time.IsZero() {
+		t.Errorf("entry 2 = %+v", e)
+	}
+	if strings.Contains(string(data), "0123456789ABCDEF") {
+		t.Error("audit log contains key material")
+	}
+	if !strings.Contains(string(entries[1].Body), `"description":"front desk"`) {
+		t.Errorf("entry 2 body = %s", entries[1].Body)
+	}
+	if v.LastHash != entries[2].Hash {
+		t.Errorf("LastHash = %s, want %s", v.LastHash, entries[2].Hash)
+	}
+
+	tampered := strings.Replace(string(data), "alice", "mallory", 1)
+	if _, err := VerifyAuditLog(strings.NewReader(tampered)); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog of edited log error = %v, want %v", err, ErrAuditTampered)
+	}
+	gap := lines[0] + "\n" + lines[2] + "\n"
+	if _, err := VerifyAuditLog(strings.NewReader(gap)); !errors.Is(err, ErrAuditGap) {
+		t.Errorf("VerifyAuditLog of log with a gap error = %v, want %v", err, ErrAuditGap)
+	}
+
+	// Rehashing an edited entry breaks the link to the next one.
+	entries[0].Operator = "mallory"
+	entries[0].Hash, _ = entries[0].computeHash()
+	first, _ := json.Marshal(entries[0])
+	rehashed := string(first) + "\n" + lines[1] + "\n" + lines[2] + "\n"
+	if _, err := VerifyAuditLog(strings.NewReader(rehashed)); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditLog of rehashed log error = %v, want %v", err, ErrAuditTampered)
+	}
+
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenAuditLog(path); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("OpenAuditLog of tampered log error = %v, want %v", err, ErrAuditTampered)
+	}
+}
+
+type failingAuditor struct{}
+
+func (failingAuditor) Record(context.Context, *AuditEntry) error { return errors.New("disk full") }
+
+func TestAuditFailure(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/terminals/ref-1", func(w http.ResponseWriter, r *http.Request) {})
+	c.SetAuditor(failingAuditor{})
+	if err := c.TerminalService.Update(context.Background(), "ref-1", map[string]interface{}{}); err == nil {
+		t.Error("Update succeeded without an audit record")
+	}
+}
@@ -0,0 +1,131 @@
+package softpos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type BatchService service
+
+const (
+	BatchOpen    = "Open"
+	BatchClosing = "Closing"
+	BatchClosed  = "Closed"
+)
+
+// BatchTotals are the totals of a batch in one currency. Amounts are in
+// minor units.
+type BatchTotals struct {
+	Currency      int   `json:"currency"`
+	SalesCount    int   `json:"salesCount"`
+	SalesAmount   int64 `json:"salesAmount"`
+	RefundsCount  int   `json:"refundsCount"`
+	RefundsAmount int64 `json:"refundsAmount"`
+	VoidsCount    int   `json:"voidsCount"`
+	VoidsAmount   int64 `json:"voidsAmount"`
+}
+
+func (t BatchTotals) Sales() Money {
+	return Money{Amount: t.SalesAmount, Currency: t.Currency}
+}
+
+func (t BatchTotals) Refunds() Money {
+	return Money{Amount: t.RefundsAmount, Currency: t.Currency}
+}
+
+// Net is sales less refunds. Voided sales are not part of the sales
+// amount.
+func (t BatchTotals) Net() Money {
+	return Money{Amount: t.SalesAmount - t.RefundsAmount, Currency: t.Currency}
+}
+
+type Batch struct {
+	Reference   string        `json:"reference"`
+	BatchNumber int           `json:"batchNumber"`
+	TerminalID  string        `json:"terminalId"`
+	MerchantID  string        `json:"merchantId"`
+	State       string        `json:"state"`
+	Opened      time.Time     `json:"opened"`
+	Closed      time.Time     `json:"closed"`
+	Totals      []BatchTotals `json:"totals"`
+}
+
+func (b *Batch) IsClosed() bool {
+	return b.State == BatchClosed
+}
+
+// Total returns the totals of a currency.
+func (b *Batch) Total(currency int) (BatchTotals, bool) {
+	for _, t := range b.Totals {
+		if t.Currency == currency {
+			return t, true
+		}
+	}
+	return BatchTotals{}, false
+}
+
+// VerifyTotals compares the batch totals with the expected ones, e.g. from
+// our own transaction records. Every currency on either side must match in
+// counts and amounts.
+func (b *Batch) VerifyTotals(expected []BatchTotals) error {
+	diffs := []string{}
+	seen := map[int]bool{}
+	for _, want := range expected {
+		seen[want.Currency] = true
+		got, _ := b.Total(want.Currency)
+		got.Currency = want.Currency
+		if got != want {
+			diffs = append(diffs, fmt.Sprintf("%d: got %+v, want %+v", want.Currency, got, want))
+		}
+	}
+	for _, got := range b.Totals {
+		if !seen[got.Currency] && got != (BatchTotals{Currency: got.Currency}) {
+			diffs = append(diffs, fmt.Sprintf("%d: unexpected %+v", got.Currency, got))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("batch %s: %s: %w", b.Reference, strings.Join(diffs, "; "), ErrTotalsMismatch)
+	}
+	return nil
+}
+
+func (c *BatchService) GetDetails(ctx context.Context, ref string, v interface{}) (err error) {
+	path := "batches/%s"
+	rel := url.URL{Path: fmt.Sprintf(path, ref)}
+	return c.client.send(ctx, "get batch", http.MethodGet, rel, nil, v)
+}
+
+// GetTotals returns the per currency totals of a batch as []BatchTotals.
+func (c *BatchService) GetTotals(ctx context.Context, ref string, v interface{}) (err error) {
+	path := "batches/%s/totals"
+	rel := url.URL{Path: fmt.Sprintf(path, ref)}
+	return c.client.send(ctx, "get batch totals", http.MethodGet, rel, nil, v)
+}
+
+// GetListByTerminal returns the batches of a terminal, newest first.
+func (c *BatchService) GetListByTerminal(ctx context.Context, mid, tid string, v interface{}) (err error) {
+	path := "merchants/%s/terminals/%s/batches"
+	rel := url.URL{Path: fmt.Sprintf(path, mid, tid)}
+	return c.client.send(ctx, "list batches", http.MethodGet, rel, nil, v)
+}
+
+// Close closes a batch and returns it with its final totals. The terminal
+// continues in a new batch.
+func (c *BatchService) Close(ctx context.Context, ref string, v interface{}) (err error) {
+	path := "batches/%s/close"
+	rel := url.URL{Path: fmt.Sprintf(path, ref)}
+	return c.client.send(ctx, "close batch", http.MethodPost, rel, nil, v)
+}
+
+// CloseCurrent closes the current batch of the terminal.
+func (c *BatchService) CloseCurrent(ctx context.Context, t *TemrinalDetails, v interface{}) (err error) {
+	if t == nil || t.CurrentBatchRef == "" {
+		return errors.New("terminal has no current batch")
+	}
+	return c.Close(ctx, t.CurrentBatchRef, v)
+}
@@ -0,0 +1,99 @@
+package softpos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const batchJSON = `{"reference":"56e336d0-3fa6-4597-9b1e-590314e4b196","batchNumber":12,"terminalId":"66770050","merchantId":"600086900","state":"%s",
+	"opened":"2022-03-28T09:16:29Z","totals":[{"currency":634,"salesCount":3,"salesAmount":15050,"refundsCount":1,"refundsAmount":2000}]}`
+
+func TestBatchServiceMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	ref := "56e336d0-3fa6-4597-9b1e-590314e4b196"
+	mux.HandleFunc("/batches/"+ref, func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, batchJSON, BatchOpen)
+	})
+	mux.HandleFunc("/batches/"+ref+"/totals", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `[{"currency":634,"salesCount":3,"salesAmount":15050}]`)
+	})
+	mux.HandleFunc("/batches/"+ref+"/close", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		fmt.Fprintf(w, batchJSON, BatchClosed)
+	})
+	mux.HandleFunc("/merchants/600086900/terminals/66770050/batches", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, "["+batchJSON+"]", BatchClosed)
+	})
+	mux.HandleFunc("/batches/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	ctx := context.Background()
+	b := &Batch{}
+	if err := c.BatchService.GetDetails(ctx, ref, b); err != nil {
+		t.Fatalf("GetDetails error = %v", err)
+	}
+	if b.BatchNumber != 12 || b.IsClosed() {
+		t.Errorf("GetDetails = %+v", b)
+	}
+	tot, ok := b.Total(634)
+	if !ok || tot.Net().String() != "130.50 634" || tot.Sales().Amount != 15050 {
+		t.Errorf("Total(634) = %+v, %v", tot, ok)
+	}
+
+	totals := []BatchTotals{}
+	if err := c.BatchService.GetTotals(ctx, ref, &totals); err != nil {
+		t.Fatalf("GetTotals error = %v", err)
+	}
+	if diff := cmp.Diff([]BatchTotals{{Currency: 634, SalesCount: 3, SalesAmount: 15050}}, totals); diff != "" {
+		t.Errorf("GetTotals mismatch (-want +got):\n%s", diff)
+	}
+
+	list := []Batch{}
+	if err := c.BatchService.GetListByTerminal(ctx, "600086900", "66770050", &list); err != nil || len(list) != 1 {
+		t.Fatalf("GetListByTerminal = %v, %v", list, err)
+	}
+
+	closed := &Batch{}
+	term := &TemrinalDetails{CurrentBatchRef: ref}
+	if err := c.BatchService.CloseCurrent(ctx, term, closed); err != nil || !closed.IsClosed() {
+		t.Errorf("CloseCurrent = %+v, %v", closed, err)
+	}
+	if err := c.BatchService.CloseCurrent(ctx, &TemrinalDetails{}, closed); err == nil {
+		t.Error("CloseCurrent without batch succeeded")
+	}
+
+	if err := c.BatchService.GetDetails(ctx, "missing", b); !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("GetDetails error = %v, want %v", err, ErrEntityNotFound)
+	}
+}
+
+func TestBatchVerifyTotals(t *testing.T) {
+	b := &Batch{Reference: "b1", Totals: []BatchTotals{
+		{Currency: 634, SalesCount: 2, SalesAmount: 1000},
+		{Currency: 840},
+	}}
+	if err := b.VerifyTotals([]BatchTotals{{Currency: 634, SalesCount: 2, SalesAmount: 1000}}); err != nil {
+		t.Errorf("VerifyTotals error = %v", err)
+	}
+	if err := b.VerifyTotals([]BatchTotals{{Currency: 634, SalesCount: 2, SalesAmount: 900}}); !errors.Is(err, ErrTotalsMismatch) {
+		t.Errorf("VerifyTotals amount error = %v, want %v", err, ErrTotalsMismatch)
+	}
+	if err := b.VerifyTotals([]BatchTotals{{Currency: 978, SalesCount: 1, SalesAmount: 10}}); !errors.Is(err, ErrTotalsMismatch) {
+		t.Errorf("VerifyTotals currency error = %v, want %v", err, ErrTotalsMismatch)
+	}
+	b.Totals[1].SalesCount = 1
+	if err := b.VerifyTotals([]BatchTotals{{Currency: 634, SalesCount: 2, SalesAmount: 1000}}); !errors.Is(err, ErrTotalsMismatch) {
+		t.Errorf("VerifyTotals unexpected currency error = %v, want %v", err, ErrTotalsMismatch)
+	}
+}
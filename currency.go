@@ -29,3 +29,13 @@ func (c *CurrencyService) GetDetails(ctx context.Context, code int, v interface{
 	url := url.URL{Path: fmt.Sprintf("%s/%d", path, code)}
 	return c.client.processRequest(ctx, http.MethodGet, url, nil, v)
 }
+
+// Find returns the currency with the given ISO 4217 numeric code.
+func (l CurrencyList) Find(code int) (Currency, bool) {
+	for _, c := range l {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return Currency{}, false
+}
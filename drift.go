@@ -0,0 +1,394 @@
+package softpos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// DecodeMode selects how the client treats responses that do not match
+// the models.
+type DecodeMode int
+
+const (
+	// DecodeLenient ignores unknown fields, as encoding/json does.
+	DecodeLenient DecodeMode = iota
+	// DecodeStrict fails calls whose response has fields the models do
+	// not know about or values of another type, with a *DriftError. The
+	// result is still decoded as far as possible.
+	DecodeStrict
+)
+
+// Drift kinds reported in DriftIssue.Kind.
+const (
+	DriftUnknownField = "unknown-field"
+	DriftTypeMismatch = "type-mismatch"
+)
+
+// DriftIssue is a response field that does not match the model. Path
+// starts with the model type, or the element type for list responses;
+// "[]" stands for any slice element and "*" for any map key, e.g.
+// "MerchnatList.items[].flags".
+type DriftIssue struct {
+	Endpoint string `json:"endpoint"`
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	Want     string `json:"want,omitempty"`
+	Got      string `json:"got"`
+}
+
+func (i DriftIssue) String() string {
+	if i.Kind == DriftUnknownField {
+		return fmt.Sprintf("%s: unknown field of type %s", i.Path, i.Got)
+	}
+	return fmt.Sprintf("%s: got %s, want %s", i.Path, i.Got, i.Want)
+}
+
+// DriftError is returned by calls in strict mode when the response does
+// not match the model. It matches ErrSpecDrift with errors.Is.
+type DriftError struct {
+	Endpoint string
+	Issues   []DriftIssue
+}
+
+func (e *DriftError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return fmt.Sprintf("%s: response does not match the model: %s", e.Endpoint, strings.Join(msgs, "; "))
+}
+
+func (e *DriftError) Is(target error) bool {
+	return target == ErrSpecDrift
+}
+
+// DriftEntry is a DriftIssue aggregated over the calls it was seen in.
+type DriftEntry struct {
+	Path      string   `json:"path"`
+	Kind      string   `json:"kind"`
+	Want      string   `json:"want,omitempty"`
+	Got       []string `json:"got"`
+	Endpoints []string `json:"endpoints"`
+	Count     int      `json:"count"`
+}
+
+// DriftReport collects the differences between TMS responses and the
+// models over many calls. It is safe for concurrent use.
+type DriftReport struct {
+	mu      sync.Mutex
+	entries map[string]*DriftEntry
+}
+
+func NewDriftReport() *DriftReport {
+	return &DriftReport{entries: map[string]*DriftEntry{}}
+}
+
+func (r *DriftReport) add(issues []DriftIssue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, i := range issues {
+		key := i.Kind + " " + i.Path
+		e := r.entries[key]
+		if e == nil {
+			e = &DriftEntry{Path: i.Path, Kind: i.Kind, Want: i.Want}
+			r.entries[key] = e
+		}
+		e.Count++
+		e.Got = addUnique(e.Got, i.Got)
+		e.Endpoints = addUnique(e.Endpoints, i.Endpoint)
+	}
+}
+
+func addUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	list = append(list, s)
+	sort.Strings(list)
+	return list
+}
+
+// Entries returns the collected drift ordered by path.
+func (r *DriftReport) Entries() []DriftEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]DriftEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		c := *e
+		c.Got = append([]string(nil), e.Got...)
+		c.Endpoints = append([]string(nil), e.Endpoints...)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Kind < list[j].Kind
+	})
+	return list
+}
+
+// WriteText renders the report as a table.
+func (r *DriftReport) WriteText(w io.Writer) error {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(w, "No drift.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tKIND\tWANT\tGOT\tCOUNT\tENDPOINTS")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", e.Path, e.Kind, e.Want,
+			strings.Join(e.Got, ","), e.Count, strings.Join(e.Endpoints, " "))
+	}
+	return tw.Flush()
+}
+
+// SetDecodeMode sets how responses not matching the models are treated.
+// The default is DecodeLenient.
+func (c *Client) SetDecodeMode(mode DecodeMode) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.decodeMode = mode
+}
+
+// SetDriftReport makes the client check every decoded response against
+// the models and collect the differences into r, in either mode. A nil r
+// stops collecting.
+func (c *Client) SetDriftReport(r *DriftReport) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.drift = r
+}
+
+// decode decodes the response body into v. Unless the client is lenient
+// without a drift report, the body is also checked against the type of v.
+func (c *Client) decode(res *http.Response, v interface{}) error {
+	c.clientMu.Lock()
+	mode, report := c.decodeMode, c.drift
+	c.clientMu.Unlock()
+
+	if v == nil {
+		var discard interface{}
+		v = &discard
+	}
+	if mode == DecodeLenient && report == nil {
+		return json.NewDecoder(res.Body).Decode(v)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	err = json.NewDecoder(bytes.NewReader(body)).Decode(v)
+
+	var data interface{}
+	if json.Unmarshal(body, &data) != nil {
+		return err
+	}
+	endpoint := ""
+	if res.Request != nil {
+		endpoint = res.Request.Method + " " + res.Request.URL.Path
+	}
+	issues := driftIssues(endpoint, data, reflect.TypeOf(v))
+	if report != nil {
+		report.add(issues)
+	}
+	if mode == DecodeStrict && len(issues) > 0 {
+		return &DriftError{Endpoint: endpoint, Issues: issues}
+	}
+	return err
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// driftIssues compares decoded JSON with the type it is decoded into.
+func driftIssues(endpoint string, data interface{}, t reflect.Type) []DriftIssue {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	issues := []DriftIssue{}
+	add := func(path, kind string, want reflect.Type, got interface{}) {
+		i := DriftIssue{Endpoint: endpoint, Path: path, Kind: kind, Got: jsonType(got)}
+		if want != nil {
+			i.Want = want.String()
+		}
+		issues = append(issues, i)
+	}
+
+	var walk func(path string, data interface{}, t reflect.Type)
+	walk = func(path string, data interface{}, t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if data == nil || t.Kind() == reflect.Interface {
+			return
+		}
+
+		if reflect.PtrTo(t).Implements(unmarshalerType) {
+			b, _ := json.Marshal(data)
+			if err := json.Unmarshal(b, reflect.New(t).Interface()); err != nil {
+				add(path, DriftTypeMismatch, t, data)
+				return
+			}
+			if _, ok := data.(map[string]interface{}); !ok || t.Kind() != reflect.Struct {
+				return
+			}
+		}
+
+		switch t.Kind() {
+		case reflect.Struct:
+			m, ok := data.(map[string]interface{})
+			if !ok {
+				add(path, DriftTypeMismatch, t, data)
+				return
+			}
+			fields := jsonFields(t)
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				f, ok := fields[strings.ToLower(k)]
+				if !ok {
+					add(path+"."+k, DriftUnknownField, nil, m[k])
+					continue
+				}
+				if f.str {
+					continue
+				}
+				walk(path+"."+k, m[k], f.typ)
+			}
+		case reflect.Map:
+			m, ok := data.(map[string]interface{})
+			if !ok {
+				add(path, DriftTypeMismatch, t, data)
+				return
+			}
+			for _, v := range m {
+				walk(path+".*", v, t.Elem())
+			}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				if _, ok := data.(string); !ok {
+					add(path, DriftTypeMismatch, t, data)
+				}
+				return
+			}
+			l, ok := data.([]interface{})
+			if !ok {
+				add(path, DriftTypeMismatch, t, data)
+				return
+			}
+			for _, v := range l {
+				walk(path+"[]", v, t.Elem())
+			}
+		case reflect.String:
+			if _, ok := data.(string); !ok {
+				add(path, DriftTypeMismatch, t, data)
+			}
+		case reflect.Bool:
+			if _, ok := data.(bool); !ok {
+				add(path, DriftTypeMismatch, t, data)
+			}
+		case reflect.Float32, reflect.Float64:
+			if _, ok := data.(float64); !ok {
+				add(path, DriftTypeMismatch, t, data)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if n, ok := data.(float64); !ok || n != math.Trunc(n) {
+				add(path, DriftTypeMismatch, t, data)
+			}
+		}
+	}
+
+	if l, ok := data.([]interface{}); ok && t.Kind() == reflect.Slice {
+		elem := t.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		for _, v := range l {
+			walk(elem.Name(), v, elem)
+		}
+		return issues
+	}
+	walk(t.Name(), data, t)
+	return issues
+}
+
+type jsonField struct {
+	typ reflect.Type
+	str bool
+}
+
+// jsonFields maps the lowercased JSON names of the fields of a struct,
+// including promoted ones, to their types.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		str := false
+		for _, o := range opts[1:] {
+			str = str || o == "string"
+		}
+		fields[strings.ToLower(name)] = jsonField{typ: f.Type, str: str}
+	}
+	return fields
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
@@ -0,0 +1,96 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDrift(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/merchants/600086900", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"merchantId":"600086900","name":"MERCHANT UAT","mcc":"5812","country":"634","merchantGroup":{"id":7},"created":"2022-02-20T11:58:14Z"}`)
+	})
+	mux.HandleFunc("/merchants", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"count":2,"items":[{"merchantId":"600086900","settlement":"T+1"},{"merchantId":"999700163","settlement":"T+2","updated":"yesterday"}],"links":{"next":null}}`)
+	})
+	mux.HandleFunc("/merchants/600086900/terminals", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"terminalId":"66770050","inputMethods":["Contactless"],"merchant":{"merchantId":"600086900","tier":"gold"},"preferences":[{"tag":"9F33","value":"E0F8C8","scope":"kernel"}]}]`)
+	})
+
+	ctx := context.Background()
+	md := MerchantDetails{}
+	if err := c.MerchantService.GetDetails(ctx, "600086900", &md); err == nil {
+		t.Error("lenient GetDetails of a mistyped field succeeded")
+	}
+
+	report := NewDriftReport()
+	c.SetDriftReport(report)
+	md = MerchantDetails{}
+	if err := c.MerchantService.GetDetails(ctx, "600086900", &md); err == nil || errors.Is(err, ErrSpecDrift) {
+		t.Errorf("lenient GetDetails error = %v, want the decoding error", err)
+	}
+	list := MerchnatList{}
+	if err := c.MerchantService.GetList(ctx, &list); err == nil {
+		t.Error("lenient GetList of a mistyped field succeeded")
+	}
+	terms := []TemrinalDetails{}
+	if err := c.TerminalService.GetListByMerchnat(ctx, "600086900", &terms); err != nil || len(terms) != 1 {
+		t.Errorf("lenient GetListByMerchnat = %d, %v", len(terms), err)
+	}
+
+	c.SetDecodeMode(DecodeStrict)
+	terms = nil
+	err := c.TerminalService.GetListByMerchnat(ctx, "600086900", &terms)
+	drift := &DriftError{}
+	if !errors.As(err, &drift) || !errors.Is(err, ErrSpecDrift) {
+		t.Fatalf("strict GetListByMerchnat error = %v, want a DriftError", err)
+	}
+	if len(drift.Issues) != 2 || len(terms) != 1 || terms[0].Merchant.MerchantID != "600086900" {
+		t.Errorf("strict GetListByMerchnat = %+v, %v", terms, drift.Issues)
+	}
+
+	md = MerchantDetails{}
+	err = c.MerchantService.GetDetails(ctx, "600086900", &md)
+	if !errors.As(err, &drift) || md.Name != "MERCHANT UAT" || md.Mcc != "5812" {
+		t.Errorf("strict GetDetails = %+v, %v", md, err)
+	}
+
+	got := map[string]DriftEntry{}
+	for _, e := range report.Entries() {
+		got[e.Kind+" "+e.Path] = e
+	}
+	for _, want := range []string{
+		"type-mismatch MerchantDetails.country",
+		"unknown-field MerchantDetails.merchantGroup",
+		"unknown-field MerchnatList.items[].settlement",
+		"unknown-field MerchnatList.links",
+		"type-mismatch MerchnatList.items[].updated",
+		"unknown-field TemrinalDetails.merchant.tier",
+		"unknown-field TemrinalDetails.preferences[].scope",
+	} {
+		if _, ok := got[want]; !ok {
+			t.Errorf("report is missing %s", want)
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("report = %+v", report.Entries())
+	}
+	if e := got["unknown-field MerchnatList.items[].settlement"]; e.Count != 2 || e.Endpoints[0] != "GET "+baseURLPath+"/merchants" {
+		t.Errorf("settlement entry = %+v", e)
+	}
+	if e := got["type-mismatch MerchantDetails.country"]; e.Want != "int" || e.Got[0] != "string" || e.Count != 2 {
+		t.Errorf("country entry = %+v", e)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteText(buf); err != nil || !strings.Contains(buf.String(), "MerchantDetails.merchantGroup") {
+		t.Errorf("WriteText = %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,208 @@
+package dukpt
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// KeyType is the algorithm and length of an AES DUKPT key.
+type KeyType uint16
+
+const (
+	TDES2  KeyType = 0x0000
+	TDES3  KeyType = 0x0001
+	AES128 KeyType = 0x0002
+	AES192 KeyType = 0x0003
+	AES256 KeyType = 0x0004
+)
+
+func (t KeyType) bits() (uint16, error) {
+	switch t {
+	case TDES2, AES128:
+		return 128, nil
+	case TDES3, AES192:
+		return 192, nil
+	case AES256:
+		return 256, nil
+	}
+	return 0, fmt.Errorf("key type %#04x: %w", uint16(t), ErrKeyLength)
+}
+
+// AESKeyType returns the key type of an AES key of the given length.
+func AESKeyType(key []byte) (KeyType, error) {
+	switch len(key) {
+	case 16:
+		return AES128, nil
+	case 24:
+		return AES192, nil
+	case 32:
+		return AES256, nil
+	}
+	return 0, fmt.Errorf("AES key of %d bytes: %w", len(key), ErrKeyLength)
+}
+
+var aesUsage = map[Usage]uint16{
+	PINEncryption:   0x1000,
+	MACGeneration:   0x2000,
+	MACVerification: 0x2001,
+	MACBoth:         0x2002,
+	DataEncryption:  0x3000,
+	DataDecryption:  0x3001,
+	DataBoth:        0x3002,
+}
+
+const (
+	usageKeyDerivation        = 0x8000
+	usageKeyDerivationInitial = 0x8001
+
+	aesCounterBits = 32
+	aesMaxOneBits  = 16
+)
+
+// AESKSN is a 12 byte AES DUKPT key serial number: the 8 byte initial key
+// ID followed by a 32 bit transaction counter.
+type AESKSN [12]byte
+
+func ParseAESKSN(s string) (AESKSN, error) {
+	var k AESKSN
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != len(k) {
+		return k, fmt.Errorf("%q: %w", s, ErrKSN)
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+func (k AESKSN) String() string {
+	return strings.ToUpper(hex.EncodeToString(k[:]))
+}
+
+// InitialKeyID returns the BDK ID and derivation ID part of the KSN.
+func (k AESKSN) InitialKeyID() []byte {
+	return append([]byte(nil), k[:8]...)
+}
+
+func (k AESKSN) Counter() uint32 {
+	return binary.BigEndian.Uint32(k[8:])
+}
+
+func (k AESKSN) WithCounter(c uint32) AESKSN {
+	binary.BigEndian.PutUint32(k[8:], c)
+	return k
+}
+
+// Next returns the KSN of the next transaction, skipping counters with more
+// than 16 bits set as the standard requires.
+func (k AESKSN) Next() (AESKSN, error) {
+	for c := uint64(k.Counter()) + 1; c < 1<<aesCounterBits; c++ {
+		if bits.OnesCount64(c) <= aesMaxOneBits {
+			return k.WithCounter(uint32(c)), nil
+		}
+	}
+	return k, ErrCounter
+}
+
+func derivationData(usage uint16, keyType KeyType, context []byte) ([]byte, error) {
+	n, err := keyType.bits()
+	if err != nil {
+		return nil, err
+	}
+	d := make([]byte, 16)
+	d[0] = 0x01 // version
+	d[1] = 0x01 // key block counter
+	binary.BigEndian.PutUint16(d[2:], usage)
+	binary.BigEndian.PutUint16(d[4:], uint16(keyType))
+	binary.BigEndian.PutUint16(d[6:], n)
+	copy(d[8:], context)
+	return d, nil
+}
+
+// derive encrypts the derivation data under the key, once per 128 bits of
+// the derived key.
+func derive(key []byte, keyType KeyType, data []byte) ([]byte, error) {
+	n, err := keyType.bits()
+	if err != nil {
+		return nil, err
+	}
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrKeyLength)
+	}
+
+	out := make([]byte, 0, 32)
+	d := append([]byte(nil), data...)
+	for i := 0; len(out) < int(n/8); i++ {
+		d[1] = byte(i + 1)
+		block := make([]byte, 16)
+		b.Encrypt(block, d)
+		out = append(out, block...)
+	}
+	return out[:n/8], nil
+}
+
+// DeriveInitialKey derives the initial key of a device from an AES base
+// derivation key and the initial key ID of its KSN.
+func DeriveInitialKey(bdk []byte, ksn AESKSN) ([]byte, error) {
+	kt, err := AESKeyType(bdk)
+	if err != nil {
+		return nil, err
+	}
+	data, err := derivationData(usageKeyDerivationInitial, kt, ksn[:8])
+	if err != nil {
+		return nil, err
+	}
+	return derive(bdk, kt, data)
+}
+
+// DeriveWorkingKey derives the working key of the given usage and type for
+// the KSN counter from the initial key.
+func DeriveWorkingKey(initialKey []byte, ksn AESKSN, usage Usage, keyType KeyType) ([]byte, error) {
+	derivationType, err := AESKeyType(initialKey)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := aesUsage[usage]
+	if !ok {
+		return nil, fmt.Errorf("usage %d: %w", usage, ErrUsage)
+	}
+	if n, err := keyType.bits(); err != nil {
+		return nil, err
+	} else if int(n/8) > len(initialKey) {
+		return nil, fmt.Errorf("%d bit working key from %d bit initial key: %w", n, len(initialKey)*8, ErrKeyLength)
+	}
+	counter := ksn.Counter()
+	if bits.OnesCount32(counter) > aesMaxOneBits {
+		return nil, fmt.Errorf("counter %d: %w", counter, ErrKSN)
+	}
+
+	context := make([]byte, 8)
+	copy(context, ksn[4:8])
+
+	key := append([]byte(nil), initialKey...)
+	var working uint32
+	for mask := uint32(1) << (aesCounterBits - 1); mask > 0; mask >>= 1 {
+		if counter&mask == 0 {
+			continue
+		}
+		working |= mask
+		binary.BigEndian.PutUint32(context[4:], working)
+		data, err := derivationData(usageKeyDerivation, derivationType, context)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = derive(key, derivationType, data); err != nil {
+			return nil, err
+		}
+	}
+
+	binary.BigEndian.PutUint32(context[4:], counter)
+	data, err := derivationData(u, keyType, context)
+	if err != nil {
+		return nil, err
+	}
+	return derive(key, keyType, data)
+}
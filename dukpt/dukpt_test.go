@@ -0,0 +1,224 @@
+package dukpt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/softpos/tr31"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// ANSI X9.24-1 test vectors.
+func TestTDES(t *testing.T) {
+	bdk := unhex("0123456789ABCDEFFEDCBA9876543210")
+	ksn, _ := ParseKSN("FFFF9876543210E00000")
+
+	ipek, err := DeriveIPEK(bdk, ksn)
+	if err != nil {
+		t.Fatalf("DeriveIPEK error = %v", err)
+	}
+	if want := unhex("6AC292FAA1315B4D858AB3A3D7D5933A"); !bytes.Equal(ipek, want) {
+		t.Errorf("DeriveIPEK = %X, want %X", ipek, want)
+	}
+
+	tests := []struct {
+		counter uint32
+		pin     string
+	}{
+		{1, "042666B49184CF5C68DE9628D0397B36"},
+		{2, "C46551CEF9FD244FAA9AD834130D3B38"},
+		{3, "0DF3D9422ACA561A47676D07AD6BAD05"},
+	}
+	for _, tt := range tests {
+		got, err := WorkingKey(ipek, ksn.WithCounter(tt.counter), PINEncryption)
+		if err != nil {
+			t.Fatalf("WorkingKey(%d) error = %v", tt.counter, err)
+		}
+		if !bytes.Equal(got, unhex(tt.pin)) {
+			t.Errorf("WorkingKey(%d) = %X, want %s", tt.counter, got, tt.pin)
+		}
+	}
+
+	variants := []struct {
+		usage Usage
+		key   string
+	}{
+		{MACGeneration, "042666B4918430A368DE9628D03984C9"},
+		{MACVerification, "042666B46E84CFA368DE96282F397BC9"},
+		{DataEncryption, "448D3F076D8304036A55A3D7E0055A78"},
+		{DataDecryption, "AD7BFC8B06AD3A08A560B4105CF8D9E5"},
+	}
+	for _, tt := range variants {
+		got, err := WorkingKey(ipek, ksn.WithCounter(1), tt.usage)
+		if err != nil {
+			t.Fatalf("WorkingKey(%d) error = %v", tt.usage, err)
+		}
+		if !bytes.Equal(got, unhex(tt.key)) {
+			t.Errorf("WorkingKey(%d) = %X, want %s", tt.usage, got, tt.key)
+		}
+	}
+	if _, err := WorkingKey(ipek, ksn.WithCounter(1), MACBoth); !errors.Is(err, ErrUsage) {
+		t.Errorf("WorkingKey error = %v, want %v", err, ErrUsage)
+	}
+	if _, err := DeriveKey(ipek, ksn.WithCounter(0x7FF)); !errors.Is(err, ErrKSN) {
+		t.Errorf("DeriveKey error = %v, want %v", err, ErrKSN)
+	}
+}
+
+func TestKSN(t *testing.T) {
+	ksn, err := ParseKSN("FFFF9876543210E003FF")
+	if err != nil {
+		t.Fatalf("ParseKSN error = %v", err)
+	}
+	if ksn.Counter() != 0x3FF {
+		t.Errorf("Counter = %#x, want 0x3ff", ksn.Counter())
+	}
+	next, err := ksn.Next()
+	if err != nil || next.String() != "FFFF9876543210E00400" {
+		t.Errorf("Next = %v, %v", next, err)
+	}
+	if ksn.Initial().String() != "FFFF9876543210E00000" {
+		t.Errorf("Initial = %v", ksn.Initial())
+	}
+
+	last := ksn.WithCounter(0x1FF800)
+	if _, err := last.Next(); !errors.Is(err, ErrCounter) {
+		t.Errorf("Next error = %v, want %v", err, ErrCounter)
+	}
+	if _, err := ParseKSN("FFFF98"); !errors.Is(err, ErrKSN) {
+		t.Errorf("ParseKSN error = %v, want %v", err, ErrKSN)
+	}
+}
+
+// ANSI X9.24-3 test vectors for an AES-128 BDK.
+func TestAES(t *testing.T) {
+	bdk := unhex("FEDCBA9876543210F1F1F1F1F1F1F1F1")
+	ksn, _ := ParseAESKSN("123456789012345600000001")
+
+	ik, err := DeriveInitialKey(bdk, ksn)
+	if err != nil {
+		t.Fatalf("DeriveInitialKey error = %v", err)
+	}
+	if want := unhex("1273671EA26AC29AFA4D1084127652A1"); !bytes.Equal(ik, want) {
+		t.Errorf("DeriveInitialKey = %X, want %X", ik, want)
+	}
+
+	pin, err := DeriveWorkingKey(ik, ksn, PINEncryption, AES128)
+	if err != nil {
+		t.Fatalf("DeriveWorkingKey error = %v", err)
+	}
+	if want := unhex("AF8CB133A78F8DC2D1359F18527593FB"); !bytes.Equal(pin, want) {
+		t.Errorf("DeriveWorkingKey = %X, want %X", pin, want)
+	}
+
+	for _, tt := range []struct {
+		usage Usage
+		key   string
+	}{
+		{MACGeneration, "A2DC23DE6FDE0824A2BC321E08E4B8B7"},
+		{DataEncryption, "A35C412EFD41FDB98B69797C02DCD08F"},
+	} {
+		got, err := DeriveWorkingKey(ik, ksn, tt.usage, AES128)
+		if err != nil || !bytes.Equal(got, unhex(tt.key)) {
+			t.Errorf("DeriveWorkingKey(%d) = %X, %v, want %s", tt.usage, got, err, tt.key)
+		}
+	}
+
+	if _, err := DeriveWorkingKey(ik, ksn, DataBoth, AES256); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("DeriveWorkingKey error = %v, want %v", err, ErrKeyLength)
+	}
+	if _, err := DeriveInitialKey(bdk[:8], ksn); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("DeriveInitialKey error = %v, want %v", err, ErrKeyLength)
+	}
+
+	next, err := ksn.WithCounter(0xFFFF).Next()
+	if err != nil || next.Counter() != 0x10000 {
+		t.Errorf("Next = %v, %v", next, err)
+	}
+}
+
+// ANSI X9.24-3 test vector for an AES-256 BDK.
+func TestAES256(t *testing.T) {
+	bdk := unhex("FEDCBA9876543210F1F1F1F1F1F1F1F1FEDCBA9876543210F1F1F1F1F1F1F1F1")
+	ksn, _ := ParseAESKSN("123456789012345600000001")
+
+	ik, err := DeriveInitialKey(bdk, ksn)
+	if err != nil {
+		t.Fatalf("DeriveInitialKey error = %v", err)
+	}
+	if want := unhex("CE9CE0C101D1138F97FB6CAD4DF045A7083D4EAE2D35A31789D01CCF0949550F"); !bytes.Equal(ik, want) {
+		t.Errorf("DeriveInitialKey = %X, want %X", ik, want)
+	}
+	for _, kt := range []KeyType{AES128, AES192, AES256} {
+		key, err := DeriveWorkingKey(ik, ksn, PINEncryption, kt)
+		if n, _ := kt.bits(); err != nil || len(key)*8 != int(n) {
+			t.Errorf("DeriveWorkingKey(%#04x) = %X, %v", uint16(kt), key, err)
+		}
+	}
+}
+
+func TestAES192(t *testing.T) {
+	ksn, _ := ParseAESKSN("123456789012345600000001")
+	ik, err := DeriveInitialKey(unhex("FEDCBA9876543210F1F1F1F1F1F1F1F1FEDCBA9876543210"), ksn)
+	if err != nil || len(ik) != 24 {
+		t.Fatalf("DeriveInitialKey = %X, %v", ik, err)
+	}
+	if key, err := DeriveWorkingKey(ik, ksn, DataEncryption, AES192); err != nil || len(key) != 24 {
+		t.Errorf("DeriveWorkingKey = %X, %v", key, err)
+	}
+	if _, err := DeriveWorkingKey(ik, ksn, DataEncryption, AES256); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("DeriveWorkingKey error = %v, want %v", err, ErrKeyLength)
+	}
+}
+
+func TestFromKeyBlock(t *testing.T) {
+	kbpk := bytes.Repeat([]byte{0x11}, 16)
+	ipek := unhex("6AC292FAA1315B4D858AB3A3D7D5933A")
+	h := tr31.Header{
+		VersionID: tr31.VersionB, KeyUsage: tr31.UsageIPEK, Algorithm: tr31.AlgorithmTDES,
+		ModeOfUse: tr31.ModeDerive, Exportability: tr31.ExportNone,
+		Blocks: []tr31.OptionalBlock{{ID: "KS", Data: "FFFF9876543210E00000"}},
+	}
+
+	kb, err := tr31.Wrap(kbpk, h, ipek, rand.Reader)
+	if err != nil {
+		t.Fatalf("Wrap error = %v", err)
+	}
+	uh, key, err := tr31.Unwrap(kbpk, kb)
+	if err != nil {
+		t.Fatalf("Unwrap error = %v", err)
+	}
+
+	got, ksn, err := TDESFromKeyBlock(uh, key)
+	if err != nil {
+		t.Fatalf("TDESFromKeyBlock error = %v", err)
+	}
+	if !bytes.Equal(got, ipek) || ksn.String() != "FFFF9876543210E00000" {
+		t.Errorf("TDESFromKeyBlock = %X, %v", got, ksn)
+	}
+
+	if _, _, err := AESFromKeyBlock(uh, key); !errors.Is(err, ErrNotInitial) {
+		t.Errorf("AESFromKeyBlock error = %v, want %v", err, ErrNotInitial)
+	}
+
+	h = tr31.Header{VersionID: tr31.VersionD, KeyUsage: tr31.UsageIPEK, Algorithm: tr31.AlgorithmAES,
+		Blocks: []tr31.OptionalBlock{{ID: "IK", Data: "1234567890123456"}}}
+	_, aksn, err := AESFromKeyBlock(h, unhex("1273671EA26AC29AFA4D1084127652A1"))
+	if err != nil || aksn.String() != "123456789012345600000000" {
+		t.Errorf("AESFromKeyBlock = %v, %v", aksn, err)
+	}
+	h.Blocks = nil
+	if _, _, err := AESFromKeyBlock(h, unhex("1273671EA26AC29AFA4D1084127652A1")); !errors.Is(err, ErrMissingBlock) {
+		t.Errorf("AESFromKeyBlock error = %v, want %v", err, ErrMissingBlock)
+	}
+}
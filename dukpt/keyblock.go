@@ -0,0 +1,50 @@
+package dukpt
+
+import (
+	"fmt"
+
+	"github.com/andrei-cloud/softpos/tr31"
+)
+
+// TDESFromKeyBlock returns the IPEK of an unwrapped TR-31 key block of
+// usage B1 and its initial KSN from the "KS" optional block. Combine with
+// softpos.Keys.UnwrapKeyBlock for keys delivered by the TMS.
+func TDESFromKeyBlock(h tr31.Header, key []byte) ([]byte, KSN, error) {
+	var ksn KSN
+	if h.KeyUsage != tr31.UsageIPEK || h.Algorithm != tr31.AlgorithmTDES {
+		return nil, ksn, ErrNotInitial
+	}
+	if len(key) != 16 {
+		return nil, ksn, fmt.Errorf("IPEK of %d bytes: %w", len(key), ErrKeyLength)
+	}
+	ks, ok := h.Block("KS")
+	if !ok {
+		return nil, ksn, ErrMissingBlock
+	}
+	ksn, err := ParseKSN(ks)
+	if err != nil {
+		return nil, ksn, err
+	}
+	return key, ksn.Initial(), nil
+}
+
+// AESFromKeyBlock returns the initial key of an unwrapped TR-31 key block
+// of usage B1 and its KSN with a zero counter from the "IK" optional block.
+func AESFromKeyBlock(h tr31.Header, key []byte) ([]byte, AESKSN, error) {
+	var ksn AESKSN
+	if h.KeyUsage != tr31.UsageIPEK || h.Algorithm != tr31.AlgorithmAES {
+		return nil, ksn, ErrNotInitial
+	}
+	if _, err := AESKeyType(key); err != nil {
+		return nil, ksn, err
+	}
+	ik, ok := h.Block("IK")
+	if !ok {
+		return nil, ksn, ErrMissingBlock
+	}
+	ksn, err := ParseAESKSN(ik + "00000000")
+	if err != nil {
+		return nil, ksn, err
+	}
+	return key, ksn, nil
+}
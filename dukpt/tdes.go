@@ -0,0 +1,220 @@
+// Package dukpt derives Derived Unique Key Per Transaction keys: TDES DUKPT
+// as defined by ANSI X9.24-1 and AES DUKPT as defined by ANSI X9.24-3.
+package dukpt
+
+import (
+	"crypto/des"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/andrei-cloud/softpos/keys"
+)
+
+var (
+	ErrKSN          error = errors.New("invalid key serial number")
+	ErrCounter      error = errors.New("transaction counter exhausted")
+	ErrKeyLength    error = errors.New("invalid key length")
+	ErrUsage        error = errors.New("unsupported key usage")
+	ErrNotInitial   error = errors.New("key block does not hold an initial DUKPT key")
+	ErrMissingBlock error = errors.New("key block has no initial key ID")
+)
+
+// Usage selects the working key derived for a transaction.
+type Usage int
+
+const (
+	PINEncryption Usage = iota + 1
+	MACGeneration
+	MACVerification
+	MACBoth
+	DataEncryption
+	DataDecryption
+	DataBoth
+)
+
+const (
+	tdesCounterBits = 21
+	tdesMaxOneBits  = 10
+)
+
+var (
+	keyMask = []byte{0xC0, 0xC0, 0xC0, 0xC0, 0, 0, 0, 0, 0xC0, 0xC0, 0xC0, 0xC0, 0, 0, 0, 0}
+
+	pinVariant     = variant(0x00, 0xFF)
+	macReqVariant  = variant(0xFF, 0x00)
+	macRespVariant = []byte{0, 0, 0, 0, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0, 0, 0}
+	dataReqVariant = []byte{0, 0, 0, 0, 0, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0, 0}
+	dataRspVariant = []byte{0, 0, 0, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0, 0, 0, 0}
+)
+
+func variant(b6, b7 byte) []byte {
+	v := make([]byte, 16)
+	v[6], v[7], v[14], v[15] = b6, b7, b6, b7
+	return v
+}
+
+// KSN is a 10 byte TDES DUKPT key serial number. Its rightmost 21 bits are
+// the transaction counter.
+type KSN [10]byte
+
+func ParseKSN(s string) (KSN, error) {
+	var k KSN
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != len(k) {
+		return k, fmt.Errorf("%q: %w", s, ErrKSN)
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+func (k KSN) String() string {
+	return strings.ToUpper(hex.EncodeToString(k[:]))
+}
+
+func (k KSN) Counter() uint32 {
+	return (uint32(k[7]&0x1F)<<16 | uint32(k[8])<<8 | uint32(k[9]))
+}
+
+// WithCounter returns the KSN with its transaction counter replaced.
+func (k KSN) WithCounter(c uint32) KSN {
+	k[7] = k[7]&0xE0 | byte(c>>16)&0x1F
+	k[8], k[9] = byte(c>>8), byte(c)
+	return k
+}
+
+// Initial returns the KSN with a zero transaction counter.
+func (k KSN) Initial() KSN {
+	return k.WithCounter(0)
+}
+
+// Next returns the KSN of the next transaction, skipping counters with more
+// than 10 bits set as the standard requires.
+func (k KSN) Next() (KSN, error) {
+	for c := k.Counter() + 1; c < 1<<tdesCounterBits; c++ {
+		if bits.OnesCount32(c) <= tdesMaxOneBits {
+			return k.WithCounter(c), nil
+		}
+	}
+	return k, ErrCounter
+}
+
+// DeriveIPEK derives the initial PIN encryption key of a device from the
+// base derivation key.
+func DeriveIPEK(bdk []byte, ksn KSN) ([]byte, error) {
+	if len(bdk) != 16 {
+		return nil, fmt.Errorf("BDK of %d bytes: %w", len(bdk), ErrKeyLength)
+	}
+	init := ksn.Initial()
+	data := init[:8]
+
+	ipek := make([]byte, 16)
+	b, err := keys.NewCipher(keys.TDES, bdk)
+	if err != nil {
+		return nil, err
+	}
+	b.Encrypt(ipek[:8], data)
+
+	masked := xorBytes(bdk, keyMask)
+	if b, err = keys.NewCipher(keys.TDES, masked); err != nil {
+		return nil, err
+	}
+	b.Encrypt(ipek[8:], data)
+	return ipek, nil
+}
+
+// DeriveKey derives the transaction key for the KSN counter from the IPEK.
+func DeriveKey(ipek []byte, ksn KSN) ([]byte, error) {
+	if len(ipek) != 16 {
+		return nil, fmt.Errorf("IPEK of %d bytes: %w", len(ipek), ErrKeyLength)
+	}
+	counter := ksn.Counter()
+	if bits.OnesCount32(counter) > tdesMaxOneBits {
+		return nil, fmt.Errorf("counter %d: %w", counter, ErrKSN)
+	}
+
+	key := append([]byte(nil), ipek...)
+	reg := ksn.Initial()
+	r := reg[2:]
+	for shift := uint32(1) << (tdesCounterBits - 1); shift > 0; shift >>= 1 {
+		if counter&shift == 0 {
+			continue
+		}
+		r[5] |= byte(shift >> 16)
+		r[6] |= byte(shift >> 8)
+		r[7] |= byte(shift)
+
+		var err error
+		if key, err = nonReversibleKey(key, r); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+func nonReversibleKey(key, data []byte) ([]byte, error) {
+	half := func(k []byte) ([]byte, error) {
+		b, err := des.NewCipher(k[:8])
+		if err != nil {
+			return nil, err
+		}
+		out := xorBytes(data, k[8:])
+		b.Encrypt(out, out)
+		return xorBytes(out, k[8:]), nil
+	}
+
+	right, err := half(key)
+	if err != nil {
+		return nil, err
+	}
+	left, err := half(xorBytes(key, keyMask))
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+// WorkingKey derives the TDES working key for a usage. MAC generation and
+// data encryption use the request variants, MAC verification and data
+// decryption the response variants.
+func WorkingKey(ipek []byte, ksn KSN, usage Usage) ([]byte, error) {
+	key, err := DeriveKey(ipek, ksn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch usage {
+	case PINEncryption:
+		return xorBytes(key, pinVariant), nil
+	case MACGeneration:
+		return xorBytes(key, macReqVariant), nil
+	case MACVerification:
+		return xorBytes(key, macRespVariant), nil
+	case DataEncryption, DataDecryption:
+		v := dataReqVariant
+		if usage == DataDecryption {
+			v = dataRspVariant
+		}
+		// data keys are the variant encrypted under itself
+		k := xorBytes(key, v)
+		b, err := keys.NewCipher(keys.TDES, k)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 16)
+		b.Encrypt(out[:8], k[:8])
+		b.Encrypt(out[8:], k[8:])
+		return out, nil
+	}
+	return nil, fmt.Errorf("usage %d: %w", usage, ErrUsage)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
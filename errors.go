@@ -12,4 +12,32 @@ var (
 	ErrNoPermission   error = errors.New("do not have permission")
 	ErrConflict       error = errors.New("conflict")
 	ErrUnknown        error = errors.New("unknown error")
+
+	ErrInvalidAmount    error = errors.New("invalid amount")
+	ErrAmountOverflow   error = errors.New("amount overflow")
+	ErrCurrencyMismatch error = errors.New("currency mismatch")
+
+	ErrNotKeyBlock error = errors.New("key value is not a key block")
+
+	ErrPreferenceNotFound error = errors.New("preference not found")
+	ErrPreferenceType     error = errors.New("preference value has unexpected type")
+
+	ErrCapabilityMismatch error = errors.New("terminal capabilities do not match input methods")
+
+	ErrTotalsMismatch error = errors.New("batch totals do not match")
+
+	ErrAlreadySettled       error = errors.New("transaction already settled")
+	ErrAlreadyVoided        error = errors.New("transaction already voided")
+	ErrExceedsOriginal      error = errors.New("amount exceeds original transaction")
+	ErrNotReversible        error = errors.New("transaction cannot be reversed")
+	ErrIdempotencyKeyReused error = errors.New("idempotency key reused for a different request")
+
+	ErrWebhookSignature error = errors.New("invalid webhook signature")
+
+	ErrAuditTampered error = errors.New("audit log tampered")
+	ErrAuditGap      error = errors.New("audit log has a gap")
+
+	ErrCassetteMismatch error = errors.New("no recorded interaction matches the request")
+
+	ErrSpecDrift error = errors.New("response does not match the API model")
 )
@@ -0,0 +1,209 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Key policy rules reported in KeyFinding.Rule.
+const (
+	RuleKeyAge         = "key-age"
+	RuleUnconfirmed    = "keys-unconfirmed"
+	RuleMissingKeyType = "missing-key-type"
+	RuleDuplicateKCV   = "duplicate-kcv"
+)
+
+// KeyPolicy describes the key management requirements terminals are
+// checked against. Zero values disable the corresponding rule.
+type KeyPolicy struct {
+	// MaxKeyAgeDays is the longest time in days since the terminal was
+	// last updated.
+	MaxKeyAgeDays int `json:"maxKeyAgeDays,omitempty"`
+	// RequireConfirmed flags terminals whose keys were not confirmed.
+	RequireConfirmed bool `json:"requireConfirmed,omitempty"`
+	// RequiredKeyTypes lists key types every terminal must hold, e.g. TMK.
+	RequiredKeyTypes []string `json:"requiredKeyTypes,omitempty"`
+	// UniqueKCV flags keys sharing a check value with another terminal.
+	UniqueKCV bool `json:"uniqueKcv,omitempty"`
+}
+
+// DefaultKeyPolicy is a starting point for PCI PIN key management checks.
+var DefaultKeyPolicy = KeyPolicy{
+	MaxKeyAgeDays:    365,
+	RequireConfirmed: true,
+	RequiredKeyTypes: []string{"TMK", "TPK"},
+	UniqueKCV:        true,
+}
+
+type KeyFinding struct {
+	MerchantID  string `json:"merchantId"`
+	TerminalID  string `json:"terminalId"`
+	Reference   string `json:"reference"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+// KeyReport is the result of checking a fleet against a KeyPolicy. It
+// encodes to JSON for machine processing and WriteText renders it for
+// people.
+type KeyReport struct {
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Policy      KeyPolicy    `json:"policy"`
+	Merchants   int          `json:"merchants"`
+	Terminals   int          `json:"terminals"`
+	Compliant   int          `json:"compliant"`
+	Findings    []KeyFinding `json:"findings"`
+}
+
+// Evaluate checks terminals, keyed by the ID of the merchant they were
+// listed under, against the policy as of now.
+func (p KeyPolicy) Evaluate(terminals map[string][]TemrinalDetails, now time.Time) []KeyFinding {
+	type fleetTerminal struct {
+		merchantID string
+		*TemrinalDetails
+	}
+
+	findings := []KeyFinding{}
+	add := func(t fleetTerminal, rule, format string, args ...interface{}) {
+		findings = append(findings, KeyFinding{
+			MerchantID:  t.merchantID,
+			TerminalID:  t.TerminalID,
+			Reference:   t.Reference,
+			Rule:        rule,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	mids := make([]string, 0, len(terminals))
+	for mid := range terminals {
+		mids = append(mids, mid)
+	}
+	sort.Strings(mids)
+
+	maxAge := time.Duration(p.MaxKeyAgeDays) * 24 * time.Hour
+	kcvs := map[string][]fleetTerminal{}
+	for _, mid := range mids {
+		list := terminals[mid]
+		for i := range list {
+			t := fleetTerminal{mid, &list[i]}
+
+			if maxAge > 0 && !t.Updated.IsZero() {
+				if age := now.Sub(t.Updated); age > maxAge {
+					add(t, RuleKeyAge, "keys last updated %s, %d days ago", t.Updated.Format("2006-01-02"), int(age.Hours()/24))
+				}
+			}
+			if p.RequireConfirmed && !t.KeysConfirmed {
+				add(t, RuleUnconfirmed, "keys are not confirmed")
+			}
+			for _, kt := range p.RequiredKeyTypes {
+				if !hasKeyType(t.Keys, kt) {
+					add(t, RuleMissingKeyType, "no %s key", kt)
+				}
+			}
+			if p.UniqueKCV {
+				for _, k := range t.Keys {
+					if k.KeyCheckValue == "" {
+						continue
+					}
+					id := strings.ToUpper(k.KeyCheckValue)
+					if n := len(kcvs[id]); n == 0 || kcvs[id][n-1].TemrinalDetails != t.TemrinalDetails {
+						kcvs[id] = append(kcvs[id], t)
+					}
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(kcvs))
+	for kcv, list := range kcvs {
+		if len(list) > 1 {
+			ids = append(ids, kcv)
+		}
+	}
+	sort.Strings(ids)
+	for _, kcv := range ids {
+		list := kcvs[kcv]
+		for _, t := range list {
+			add(t, RuleDuplicateKCV, "key check value %s shared by %d terminals", kcv, len(list))
+		}
+	}
+
+	return findings
+}
+
+func hasKeyType(list []Keys, keyType string) bool {
+	for _, k := range list {
+		if strings.EqualFold(k.KeyType, keyType) {
+			return true
+		}
+	}
+	return false
+}
+
+// FleetScanner checks the keys of every terminal of every merchant.
+type FleetScanner struct {
+	client *Client
+	Policy KeyPolicy
+}
+
+func NewFleetScanner(client *Client, policy KeyPolicy) *FleetScanner {
+	return &FleetScanner{client: client, Policy: policy}
+}
+
+// Scan lists merchants and their terminals and evaluates the policy.
+func (s *FleetScanner) Scan(ctx context.Context) (*KeyReport, error) {
+	merchants, err := s.client.MerchantService.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list merchants: %w", err)
+	}
+
+	terminals := map[string][]TemrinalDetails{}
+	count := 0
+	for _, m := range merchants {
+		list := []TemrinalDetails{}
+		if err := s.client.TerminalService.GetListByMerchnat(ctx, m.MerchantID, &list); err != nil {
+			return nil, fmt.Errorf("list terminals of %s: %w", m.MerchantID, err)
+		}
+		terminals[m.MerchantID] = append(terminals[m.MerchantID], list...)
+		count += len(list)
+	}
+
+	now := time.Now().UTC()
+	report := &KeyReport{
+		GeneratedAt: now,
+		Policy:      s.Policy,
+		Merchants:   len(merchants),
+		Terminals:   count,
+		Findings:    s.Policy.Evaluate(terminals, now),
+	}
+
+	failed := map[string]bool{}
+	for _, f := range report.Findings {
+		failed[f.MerchantID+"/"+f.TerminalID] = true
+	}
+	report.Compliant = report.Terminals - len(failed)
+	return report, nil
+}
+
+// WriteText renders the report as a table for audit evidence.
+func (r *KeyReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Key compliance report generated %s\n", r.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Merchants: %d  Terminals: %d  Compliant: %d  Findings: %d\n\n",
+		r.Merchants, r.Terminals, r.Compliant, len(r.Findings))
+	if len(r.Findings) == 0 {
+		_, err := fmt.Fprintln(w, "No findings.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MERCHANT\tTERMINAL\tRULE\tDESCRIPTION")
+	for _, f := range r.Findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.MerchantID, f.TerminalID, f.Rule, f.Description)
+	}
+	return tw.Flush()
+}
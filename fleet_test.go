@@ -0,0 +1,103 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyPolicyEvaluate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	terminals := make([]TemrinalDetails, 3)
+	for i := range terminals {
+		terminals[i].TerminalID = fmt.Sprintf("6677005%d", i)
+		terminals[i].KeysConfirmed = true
+		terminals[i].Updated = now.Add(-24 * time.Hour)
+	}
+	terminals[0].Keys = []Keys{{KeyType: "TMK", KeyCheckValue: "BAA397"}, {KeyType: "TPK", KeyCheckValue: "083CA1"}}
+	terminals[1].Keys = []Keys{{KeyType: "TMK", KeyCheckValue: "baa397"}, {KeyType: "TPK", KeyCheckValue: "11AA22"}}
+	terminals[1].Updated = now.Add(-400 * 24 * time.Hour)
+	terminals[2].Keys = []Keys{{KeyType: "TMK", KeyCheckValue: "33BB44"}}
+	terminals[2].KeysConfirmed = false
+
+	got := map[string][]string{}
+	for _, f := range DefaultKeyPolicy.Evaluate(map[string][]TemrinalDetails{"600086900": terminals}, now) {
+		if f.MerchantID != "600086900" {
+			t.Errorf("finding merchant = %q", f.MerchantID)
+		}
+		got[f.TerminalID] = append(got[f.TerminalID], f.Rule)
+	}
+
+	want := map[string][]string{
+		"66770050": {RuleDuplicateKCV},
+		"66770051": {RuleKeyAge, RuleDuplicateKCV},
+		"66770052": {RuleUnconfirmed, RuleMissingKeyType},
+	}
+	for tid, rules := range want {
+		if strings.Join(got[tid], ",") != strings.Join(rules, ",") {
+			t.Errorf("%s findings = %v, want %v", tid, got[tid], rules)
+		}
+	}
+
+	if f := (KeyPolicy{}).Evaluate(map[string][]TemrinalDetails{"600086900": terminals}, now); len(f) != 0 {
+		t.Errorf("empty policy findings = %v", f)
+	}
+}
+
+func TestFleetScannerMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/merchants", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"index":2,"totalPages":2,"items":[{"merchantId":"999700163"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"index":1,"totalPages":2,"items":[{"merchantId":"600086900"}]}`)
+	})
+	mux.HandleFunc("/merchants/600086900/terminals", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"terminalId":"66770057","merchant":{"merchantId":"600086900"},"keys":[{"keyType":"TPK","keyCheckValue":"083CA1"},{"keyType":"TMK","keyCheckValue":"BAA397"}],"keysConfirmed":true,"updated":"%s"}]`,
+			time.Now().Add(-time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/merchants/999700163/terminals", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"terminalId":"66770056","merchant":{"merchantId":"999700000"},"keys":[{"keyType":"TMK","keyCheckValue":"BAA397"}],"keysConfirmed":true,"updated":"2020-03-14T12:30:54.694094Z"}]`)
+	})
+
+	report, err := NewFleetScanner(c, DefaultKeyPolicy).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Error occured = %v", err)
+	}
+	if report.Merchants != 2 || report.Terminals != 2 || report.Compliant != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Findings) != 4 {
+		t.Errorf("findings = %+v, want 4", report.Findings)
+	}
+	for _, f := range report.Findings {
+		if f.TerminalID == "66770056" && f.MerchantID != "999700163" {
+			t.Errorf("finding merchant = %q, want 999700163", f.MerchantID)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteText(buf); err != nil {
+		t.Fatalf("WriteText error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "missing-key-type") || !strings.Contains(buf.String(), "66770056") {
+		t.Errorf("WriteText = %s", buf.String())
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Errorf("Marshal error = %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"maxKeyAgeDays":365`)) {
+		t.Errorf("Marshal = %s", data)
+	}
+}
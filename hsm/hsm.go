@@ -0,0 +1,82 @@
+// Package hsm abstracts the payment HSM operations needed to provision
+// terminals with keys stored under a Local Master Key (LMK), and provides a
+// pure Go software implementation for development and tests.
+package hsm
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrKeyType   error = errors.New("unsupported key type")
+	ErrKeyFormat error = errors.New("malformed key")
+	ErrPINBlock  error = errors.New("invalid PIN block")
+	ErrPIN       error = errors.New("invalid PIN")
+	ErrPAN       error = errors.New("invalid PAN")
+)
+
+// KeyType is a Thales style key type code: a variant digit followed by the
+// LMK pair code, e.g. "000" for a ZMK or "002" for a TPK/TMK.
+type KeyType string
+
+const (
+	KeyTypeZMK KeyType = "000"
+	KeyTypeZPK KeyType = "001"
+	KeyTypeTPK KeyType = "002"
+	KeyTypeTMK KeyType = "002"
+	KeyTypePVK KeyType = "002"
+	KeyTypeTAK KeyType = "003"
+	KeyTypeZAK KeyType = "008"
+	KeyTypeBDK KeyType = "009"
+	KeyTypeZEK KeyType = "00A"
+	KeyTypeCVK KeyType = "402"
+)
+
+var keyTypeNames = map[string]KeyType{
+	"ZMK": KeyTypeZMK,
+	"ZPK": KeyTypeZPK,
+	"TPK": KeyTypeTPK,
+	"TMK": KeyTypeTMK,
+	"PVK": KeyTypePVK,
+	"TAK": KeyTypeTAK,
+	"ZAK": KeyTypeZAK,
+	"BDK": KeyTypeBDK,
+	"ZEK": KeyTypeZEK,
+	"CVK": KeyTypeCVK,
+}
+
+// KeyTypeFor maps a key name such as the softpos.Keys KeyType "TPK" to
+// its key type code.
+func KeyTypeFor(name string) (KeyType, bool) {
+	kt, ok := keyTypeNames[strings.ToUpper(strings.TrimSpace(name))]
+	return kt, ok
+}
+
+// Key is a key value encrypted under the LMK or an exchange key, in Thales
+// notation with a scheme prefix ("U" for double length variant, "X" for
+// double length X9.17, ...), and its check value.
+type Key struct {
+	Value string
+	KCV   string
+}
+
+// HSM is the set of host security module operations used in terminal
+// provisioning. Key arguments are encrypted under the LMK.
+type HSM interface {
+	// GenerateKey creates a random double length key of the given type.
+	GenerateKey(ctx context.Context, keyType KeyType) (Key, error)
+	// TranslateToZMK exports a key from LMK to ZMK encryption.
+	TranslateToZMK(ctx context.Context, zmk string, keyType KeyType, key string) (Key, error)
+	// TranslateToTMK exports a key from LMK to TMK encryption for loading
+	// into a terminal.
+	TranslateToTMK(ctx context.Context, tmk string, keyType KeyType, key string) (Key, error)
+	// KCV returns the check value of a key.
+	KCV(ctx context.Context, keyType KeyType, key string) (string, error)
+	// VerifyPIN decrypts a PIN block under the TPK and compares it with
+	// the clear PIN.
+	VerifyPIN(ctx context.Context, tpk string, pinBlock []byte, format PINBlockFormat, pan, pin string) (bool, error)
+	// GenerateMAC computes an ISO 9797-1 algorithm 3 MAC under the TAK.
+	GenerateMAC(ctx context.Context, tak string, data []byte) ([]byte, error)
+}
@@ -0,0 +1,133 @@
+package hsm
+
+import (
+	"fmt"
+	"io"
+)
+
+// PINBlockFormat is an ISO 9564-1 PIN block format.
+type PINBlockFormat int
+
+const (
+	ISO0 PINBlockFormat = 0
+	ISO1 PINBlockFormat = 1
+	ISO3 PINBlockFormat = 3
+)
+
+// EncodePINBlock builds a clear PIN block. Fill digits of formats 1 and 3
+// are read from rand.
+func EncodePINBlock(format PINBlockFormat, pin, pan string, rand io.Reader) ([]byte, error) {
+	if len(pin) < 4 || len(pin) > 12 || !digits(pin) {
+		return nil, ErrPIN
+	}
+
+	fill := make([]byte, 14-len(pin))
+	switch format {
+	case ISO0:
+		for i := range fill {
+			fill[i] = 0xF
+		}
+	case ISO1, ISO3:
+		if _, err := io.ReadFull(rand, fill); err != nil {
+			return nil, err
+		}
+		for i := range fill {
+			fill[i] &= 0xF
+			if format == ISO3 {
+				fill[i] = 0xA + fill[i]%6
+			}
+		}
+	default:
+		return nil, fmt.Errorf("format %d: %w", format, ErrPINBlock)
+	}
+
+	nibbles := make([]byte, 0, 16)
+	nibbles = append(nibbles, byte(format), byte(len(pin)))
+	for i := 0; i < len(pin); i++ {
+		nibbles = append(nibbles, pin[i]-'0')
+	}
+	nibbles = append(nibbles, fill...)
+
+	block := make([]byte, 8)
+	for i := range block {
+		block[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	if format == ISO1 {
+		return block, nil
+	}
+
+	pf, err := panField(pan)
+	if err != nil {
+		return nil, err
+	}
+	for i := range block {
+		block[i] ^= pf[i]
+	}
+	return block, nil
+}
+
+// DecodePINBlock extracts the PIN from a clear PIN block.
+func DecodePINBlock(format PINBlockFormat, block []byte, pan string) (string, error) {
+	if len(block) != 8 {
+		return "", ErrPINBlock
+	}
+	b := append([]byte(nil), block...)
+	if format != ISO1 {
+		pf, err := panField(pan)
+		if err != nil {
+			return "", err
+		}
+		for i := range b {
+			b[i] ^= pf[i]
+		}
+	}
+
+	if PINBlockFormat(b[0]>>4) != format {
+		return "", fmt.Errorf("format %d, want %d: %w", b[0]>>4, format, ErrPINBlock)
+	}
+	n := int(b[0] & 0xF)
+	if n < 4 || n > 12 {
+		return "", fmt.Errorf("PIN length %d: %w", n, ErrPINBlock)
+	}
+
+	pin := make([]byte, 0, n)
+	for i := 2; i < 16; i++ {
+		nib := b[i/2] >> 4
+		if i%2 == 1 {
+			nib = b[i/2] & 0xF
+		}
+		switch {
+		case i < n+2:
+			if nib > 9 {
+				return "", fmt.Errorf("PIN digit: %w", ErrPINBlock)
+			}
+			pin = append(pin, '0'+nib)
+		case format == ISO0 && nib != 0xF, format == ISO3 && nib < 0xA:
+			return "", fmt.Errorf("fill digit: %w", ErrPINBlock)
+		}
+	}
+	return string(pin), nil
+}
+
+// panField is the rightmost 12 PAN digits excluding the check digit,
+// prefixed with four zero nibbles.
+func panField(pan string) ([]byte, error) {
+	if len(pan) < 13 || len(pan) > 19 || !digits(pan) {
+		return nil, ErrPAN
+	}
+	d := "0000" + pan[len(pan)-13:len(pan)-1]
+	f := make([]byte, 8)
+	for i := range f {
+		f[i] = (d[2*i]-'0')<<4 | (d[2*i+1] - '0')
+	}
+	return f, nil
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,311 @@
+package hsm
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andrei-cloud/softpos/keys"
+)
+
+// LMK is a variant Local Master Key: 20 double length LMK pairs, 00-01
+// through 38-39.
+type LMK [20][16]byte
+
+// TestLMK is the well known Thales test LMK. It must never protect
+// production keys.
+var TestLMK = LMK{
+	lmkPair("0101010101010101", "7902CD1FD36EF8BA"),
+	lmkPair("2020202020202020", "3131313131313131"),
+	lmkPair("4040404040404040", "5151515151515151"),
+	lmkPair("6161616161616161", "7070707070707070"),
+	lmkPair("8080808080808080", "9191919191919191"),
+	lmkPair("A1A1A1A1A1A1A1A1", "B0B0B0B0B0B0B0B0"),
+	lmkPair("C1C1010101010101", "D0D0010101010101"),
+	lmkPair("E0E0010101010101", "F1F1010101010101"),
+	lmkPair("1C587F1C13924FEF", "0101010101010101"),
+	lmkPair("0101010101010101", "0101010101010101"),
+	lmkPair("0202020202020202", "0404040404040404"),
+	lmkPair("0707070707070707", "1010101010101010"),
+	lmkPair("1313131313131313", "1515151515151515"),
+	lmkPair("1616161616161616", "1919191919191919"),
+	lmkPair("1A1A1A1A1A1A1A1A", "1C1C1C1C1C1C1C1C"),
+	lmkPair("2323232323232323", "2525252525252525"),
+	lmkPair("2626262626262626", "2929292929292929"),
+	lmkPair("2A2A2A2A2A2A2A2A", "2C2C2C2C2C2C2C2C"),
+	lmkPair("2F2F2F2F2F2F2F2F", "3131313131313131"),
+	lmkPair("0101010101010101", "0101010101010101"),
+}
+
+func lmkPair(left, right string) (p [16]byte) {
+	if _, err := hex.Decode(p[:], []byte(left+right)); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// pairIndex maps the LMK pair code of a key type to the LMK pair.
+var pairIndex = map[string]int{
+	"00": 2, "01": 3, "02": 7, "03": 8, "04": 9, "05": 10, "06": 11, "07": 12,
+	"08": 13, "09": 14, "0A": 15, "0B": 16, "0C": 17, "0D": 18, "0E": 19,
+}
+
+var (
+	typeVariants   = [10]byte{0x00, 0xA6, 0x5A, 0x6A, 0xDE, 0x2B, 0x50, 0x74, 0x9C, 0xFA}
+	schemeVariants = map[byte][]byte{
+		'U': {0xA6, 0x5A},
+		'T': {0x6A, 0xDE, 0x2B},
+	}
+)
+
+// Software is an HSM implemented in memory using the variant LMK scheme.
+// It is meant for development and test rigs only.
+type Software struct {
+	lmk  LMK
+	rand io.Reader
+}
+
+var _ HSM = (*Software)(nil)
+
+// NewSoftware returns a software HSM using lmk. A nil rand uses
+// crypto/rand.
+func NewSoftware(lmk LMK, random io.Reader) *Software {
+	if random == nil {
+		random = rand.Reader
+	}
+	return &Software{lmk: lmk, rand: random}
+}
+
+func (s *Software) variantLMK(kt KeyType, scheme byte, part int) (cipher.Block, error) {
+	if len(kt) != 3 || kt[0] < '0' || kt[0] > '9' {
+		return nil, fmt.Errorf("%q: %w", kt, ErrKeyType)
+	}
+	idx, ok := pairIndex[strings.ToUpper(string(kt[1:]))]
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", kt, ErrKeyType)
+	}
+
+	pair := s.lmk[idx]
+	pair[0] ^= typeVariants[kt[0]-'0']
+	if v, ok := schemeVariants[scheme]; ok {
+		pair[8] ^= v[part]
+	}
+	k, _ := keys.TripleDESKey(pair[:])
+	return des.NewTripleDESCipher(k)
+}
+
+// encryptLMK encrypts a clear key under the LMK with the U (double) or T
+// (triple) variant scheme, or unprefixed for single length keys.
+func (s *Software) encryptLMK(kt KeyType, clear []byte) (string, error) {
+	scheme, err := schemeFor(clear, 'U', 'T')
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, len(clear))
+	for i := 0; i < len(clear); i += 8 {
+		b, err := s.variantLMK(kt, scheme, i/8)
+		if err != nil {
+			return "", err
+		}
+		b.Encrypt(out[i:i+8], clear[i:i+8])
+	}
+	return prefixed(scheme, out), nil
+}
+
+func (s *Software) decryptLMK(kt KeyType, key string) ([]byte, error) {
+	scheme, enc, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if scheme != 0 && scheme != 'U' && scheme != 'T' {
+		return nil, fmt.Errorf("scheme %c under LMK: %w", scheme, ErrKeyFormat)
+	}
+	out := make([]byte, len(enc))
+	for i := 0; i < len(enc); i += 8 {
+		b, err := s.variantLMK(kt, scheme, i/8)
+		if err != nil {
+			return nil, err
+		}
+		b.Decrypt(out[i:i+8], enc[i:i+8])
+	}
+	return out, nil
+}
+
+func schemeFor(clear []byte, double, triple byte) (byte, error) {
+	switch len(clear) {
+	case 8:
+		return 0, nil
+	case 16:
+		return double, nil
+	case 24:
+		return triple, nil
+	}
+	return 0, fmt.Errorf("%d bytes: %w", len(clear), keys.ErrKeyLength)
+}
+
+func prefixed(scheme byte, key []byte) string {
+	s := strings.ToUpper(hex.EncodeToString(key))
+	if scheme != 0 {
+		s = string(scheme) + s
+	}
+	return s
+}
+
+// parseKey splits a key in Thales notation into its scheme and value.
+func parseKey(key string) (byte, []byte, error) {
+	var scheme byte
+	if len(key)%2 == 1 {
+		scheme, key = key[0], key[1:]
+	}
+	want := map[byte]int{0: 8, 'Z': 8, 'U': 16, 'X': 16, 'T': 24, 'Y': 24}
+	n, ok := want[scheme]
+	if !ok {
+		return 0, nil, fmt.Errorf("scheme %q: %w", scheme, ErrKeyFormat)
+	}
+	b, err := hex.DecodeString(key)
+	if err != nil || len(b) != n {
+		return 0, nil, ErrKeyFormat
+	}
+	if scheme == 'Z' {
+		scheme = 0
+	}
+	return scheme, b, nil
+}
+
+func kcv(clear []byte) (string, error) {
+	return keys.KCVHex(keys.TDES, clear)
+}
+
+// ImportKey encrypts a clear key under the LMK, as done when forming a key
+// from components at a key ceremony.
+func (s *Software) ImportKey(ctx context.Context, keyType KeyType, clear []byte) (Key, error) {
+	if err := keys.CheckParity(clear); err != nil {
+		return Key{}, err
+	}
+	value, err := s.encryptLMK(keyType, clear)
+	if err != nil {
+		return Key{}, err
+	}
+	check, err := kcv(clear)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Value: value, KCV: check}, nil
+}
+
+func (s *Software) GenerateKey(ctx context.Context, keyType KeyType) (Key, error) {
+	clear := make([]byte, 16)
+	if _, err := io.ReadFull(s.rand, clear); err != nil {
+		return Key{}, err
+	}
+	keys.AdjustParity(clear)
+	return s.ImportKey(ctx, keyType, clear)
+}
+
+func (s *Software) TranslateToZMK(ctx context.Context, zmk string, keyType KeyType, key string) (Key, error) {
+	return s.export(KeyTypeZMK, zmk, keyType, key)
+}
+
+func (s *Software) TranslateToTMK(ctx context.Context, tmk string, keyType KeyType, key string) (Key, error) {
+	return s.export(KeyTypeTMK, tmk, keyType, key)
+}
+
+// export encrypts a key under an exchange key in X9.17 ECB mode.
+func (s *Software) export(kekType KeyType, kek string, keyType KeyType, key string) (Key, error) {
+	clearKEK, err := s.decryptLMK(kekType, kek)
+	if err != nil {
+		return Key{}, fmt.Errorf("exchange key: %w", err)
+	}
+	clear, err := s.decryptLMK(keyType, key)
+	if err != nil {
+		return Key{}, err
+	}
+	b, err := keys.NewCipher(keys.TDES, clearKEK)
+	if err != nil {
+		return Key{}, err
+	}
+
+	scheme, err := schemeFor(clear, 'X', 'Y')
+	if err != nil {
+		return Key{}, err
+	}
+	out := make([]byte, len(clear))
+	for i := 0; i < len(clear); i += 8 {
+		b.Encrypt(out[i:i+8], clear[i:i+8])
+	}
+	check, err := kcv(clear)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Value: prefixed(scheme, out), KCV: check}, nil
+}
+
+func (s *Software) KCV(ctx context.Context, keyType KeyType, key string) (string, error) {
+	clear, err := s.decryptLMK(keyType, key)
+	if err != nil {
+		return "", err
+	}
+	return kcv(clear)
+}
+
+func (s *Software) VerifyPIN(ctx context.Context, tpk string, pinBlock []byte, format PINBlockFormat, pan, pin string) (bool, error) {
+	clear, err := s.decryptLMK(KeyTypeTPK, tpk)
+	if err != nil {
+		return false, err
+	}
+	if len(pinBlock) != 8 {
+		return false, ErrPINBlock
+	}
+	b, err := keys.NewCipher(keys.TDES, clear)
+	if err != nil {
+		return false, err
+	}
+
+	block := make([]byte, 8)
+	b.Decrypt(block, pinBlock)
+	got, err := DecodePINBlock(format, block, pan)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(pin)) == 1, nil
+}
+
+func (s *Software) GenerateMAC(ctx context.Context, tak string, data []byte) ([]byte, error) {
+	clear, err := s.decryptLMK(KeyTypeTAK, tak)
+	if err != nil {
+		return nil, err
+	}
+	return RetailMAC(clear, data)
+}
+
+// RetailMAC computes an ISO 9797-1 MAC algorithm 3 with padding method 1
+// under a double length key.
+func RetailMAC(key, data []byte) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("%d bytes: %w", len(key), keys.ErrKeyLength)
+	}
+	k1, _ := des.NewCipher(key[:8])
+	k2, _ := des.NewCipher(key[8:])
+
+	msg := append([]byte(nil), data...)
+	if len(msg) == 0 || len(msg)%8 != 0 {
+		msg = append(msg, make([]byte, 8-len(msg)%8)...)
+	}
+
+	mac := make([]byte, 8)
+	for i := 0; i < len(msg); i += 8 {
+		for j := range mac {
+			mac[j] ^= msg[i+j]
+		}
+		k1.Encrypt(mac, mac)
+	}
+	k2.Decrypt(mac, mac)
+	k1.Encrypt(mac, mac)
+	return mac, nil
+}
@@ -0,0 +1,180 @@
+package hsm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/softpos/keys"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestSoftwareImportKey(t *testing.T) {
+	ctx := context.Background()
+	h := NewSoftware(TestLMK, nil)
+
+	clear := unhex("0123456789ABCDEFFEDCBA9876543210")
+	k, err := h.ImportKey(ctx, KeyTypeTPK, clear)
+	if err != nil {
+		t.Fatalf("ImportKey error = %v", err)
+	}
+	if !strings.HasPrefix(k.Value, "U") || len(k.Value) != 33 {
+		t.Errorf("ImportKey value = %s", k.Value)
+	}
+	if k.KCV != "08D7B4" {
+		t.Errorf("ImportKey KCV = %s, want 08D7B4", k.KCV)
+	}
+
+	got, err := h.decryptLMK(KeyTypeTPK, k.Value)
+	if err != nil || !bytes.Equal(got, clear) {
+		t.Errorf("decryptLMK = %X, %v", got, err)
+	}
+
+	// a different key type uses a different LMK pair
+	other, _ := h.ImportKey(ctx, KeyTypeZMK, clear)
+	if other.Value == k.Value {
+		t.Error("ImportKey used the same LMK pair for ZMK and TPK")
+	}
+
+	if _, err := h.ImportKey(ctx, KeyType("0ZZ"), clear); !errors.Is(err, ErrKeyType) {
+		t.Errorf("ImportKey error = %v, want %v", err, ErrKeyType)
+	}
+	if _, err := h.ImportKey(ctx, KeyTypeTPK, unhex("0023456789ABCDEFFEDCBA9876543210")); !errors.Is(err, keys.ErrParity) {
+		t.Errorf("ImportKey error = %v, want %v", err, keys.ErrParity)
+	}
+}
+
+func TestSoftwareTranslate(t *testing.T) {
+	ctx := context.Background()
+	h := NewSoftware(TestLMK, nil)
+
+	tmkClear := unhex("0123456789ABCDEFFEDCBA9876543210")
+	tmk, _ := h.ImportKey(ctx, KeyTypeTMK, tmkClear)
+
+	tpk, err := h.GenerateKey(ctx, KeyTypeTPK)
+	if err != nil {
+		t.Fatalf("GenerateKey error = %v", err)
+	}
+	kcv, err := h.KCV(ctx, KeyTypeTPK, tpk.Value)
+	if err != nil || kcv != tpk.KCV {
+		t.Errorf("KCV = %s, %v, want %s", kcv, err, tpk.KCV)
+	}
+
+	exported, err := h.TranslateToTMK(ctx, tmk.Value, KeyTypeTPK, tpk.Value)
+	if err != nil {
+		t.Fatalf("TranslateToTMK error = %v", err)
+	}
+	if !strings.HasPrefix(exported.Value, "X") || exported.KCV != tpk.KCV {
+		t.Errorf("TranslateToTMK = %+v", exported)
+	}
+
+	// the terminal decrypts the exported key under its clear TMK
+	b, _ := keys.NewCipher(keys.TDES, tmkClear)
+	enc := unhex(exported.Value[1:])
+	clear := make([]byte, len(enc))
+	for i := 0; i < len(enc); i += 8 {
+		b.Decrypt(clear[i:], enc[i:i+8])
+	}
+	if err := keys.Verify(keys.TDES, clear, tpk.KCV); err != nil {
+		t.Errorf("exported key check value: %v", err)
+	}
+
+	zmk, _ := h.GenerateKey(ctx, KeyTypeZMK)
+	if _, err := h.TranslateToZMK(ctx, zmk.Value, KeyTypeTPK, tpk.Value); err != nil {
+		t.Errorf("TranslateToZMK error = %v", err)
+	}
+	if _, err := h.TranslateToZMK(ctx, exported.Value, KeyTypeTPK, tpk.Value); !errors.Is(err, ErrKeyFormat) {
+		t.Errorf("TranslateToZMK error = %v, want %v", err, ErrKeyFormat)
+	}
+}
+
+func TestSoftwareVerifyPIN(t *testing.T) {
+	ctx := context.Background()
+	h := NewSoftware(TestLMK, nil)
+
+	clear := unhex("0123456789ABCDEFFEDCBA9876543210")
+	tpk, _ := h.ImportKey(ctx, KeyTypeTPK, clear)
+	pan := "4111111111111111"
+
+	block, err := EncodePINBlock(ISO0, "1234", pan, nil)
+	if err != nil {
+		t.Fatalf("EncodePINBlock error = %v", err)
+	}
+	b, _ := keys.NewCipher(keys.TDES, clear)
+	b.Encrypt(block, block)
+
+	if ok, err := h.VerifyPIN(ctx, tpk.Value, block, ISO0, pan, "1234"); err != nil || !ok {
+		t.Errorf("VerifyPIN = %v, %v, want true", ok, err)
+	}
+	if ok, err := h.VerifyPIN(ctx, tpk.Value, block, ISO0, pan, "4321"); err != nil || ok {
+		t.Errorf("VerifyPIN wrong PIN = %v, %v, want false", ok, err)
+	}
+	if _, err := h.VerifyPIN(ctx, tpk.Value, block, ISO0, "4111111111112111", "1234"); !errors.Is(err, ErrPINBlock) {
+		t.Errorf("VerifyPIN wrong PAN error = %v, want %v", err, ErrPINBlock)
+	}
+}
+
+func TestPINBlock(t *testing.T) {
+	block, err := EncodePINBlock(ISO0, "1234", "4111111111111111", nil)
+	if err != nil {
+		t.Fatalf("EncodePINBlock error = %v", err)
+	}
+	if got, want := strings.ToUpper(hex.EncodeToString(block)), "041225EEEEEEEEEE"; got != want {
+		t.Errorf("EncodePINBlock = %s, want %s", got, want)
+	}
+
+	for _, f := range []PINBlockFormat{ISO0, ISO1, ISO3} {
+		block, err := EncodePINBlock(f, "123456", "5413330089020011", rand.Reader)
+		if err != nil {
+			t.Fatalf("EncodePINBlock(%d) error = %v", f, err)
+		}
+		pin, err := DecodePINBlock(f, block, "5413330089020011")
+		if err != nil || pin != "123456" {
+			t.Errorf("DecodePINBlock(%d) = %s, %v", f, pin, err)
+		}
+	}
+
+	if _, err := EncodePINBlock(ISO0, "12a4", "4111111111111111", nil); !errors.Is(err, ErrPIN) {
+		t.Errorf("EncodePINBlock error = %v, want %v", err, ErrPIN)
+	}
+	if _, err := EncodePINBlock(ISO0, "1234", "4111", nil); !errors.Is(err, ErrPAN) {
+		t.Errorf("EncodePINBlock error = %v, want %v", err, ErrPAN)
+	}
+}
+
+func TestGenerateMAC(t *testing.T) {
+	ctx := context.Background()
+	h := NewSoftware(TestLMK, nil)
+
+	key := unhex("0123456789ABCDEFFEDCBA9876543210")
+	tak, _ := h.ImportKey(ctx, KeyTypeTAK, key)
+
+	data := []byte("Now is the time for all ")
+	mac, err := h.GenerateMAC(ctx, tak.Value, data)
+	if err != nil {
+		t.Fatalf("GenerateMAC error = %v", err)
+	}
+	if got, want := strings.ToUpper(hex.EncodeToString(mac)), "A1C72E74EA3FA9B6"; got != want {
+		t.Errorf("GenerateMAC = %s, want %s", got, want)
+	}
+}
+
+func TestKeyTypeFor(t *testing.T) {
+	if kt, ok := KeyTypeFor("tpk"); !ok || kt != KeyTypeTPK {
+		t.Errorf("KeyTypeFor(tpk) = %v, %v", kt, ok)
+	}
+	if _, ok := KeyTypeFor("XYZ"); ok {
+		t.Error("KeyTypeFor(XYZ) found a key type")
+	}
+}
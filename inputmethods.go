@@ -0,0 +1,224 @@
+package softpos
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InputMethod is a way a terminal accepts cards or credentials.
+type InputMethod string
+
+const (
+	InputContactless       InputMethod = "Contactless"
+	InputPINOnGlass        InputMethod = "PinOnGlass"
+	InputChip              InputMethod = "Chip"
+	InputMagstripe         InputMethod = "Magstripe"
+	InputMagstripeFallback InputMethod = "MagstripeFallback"
+	InputManual            InputMethod = "Manual"
+	InputQR                InputMethod = "QR"
+	InputSignature         InputMethod = "Signature"
+)
+
+var inputMethods = []InputMethod{
+	InputContactless, InputPINOnGlass, InputChip, InputMagstripe,
+	InputMagstripeFallback, InputManual, InputQR, InputSignature,
+}
+
+// Terminal capabilities (9F33) bits set by input methods.
+const (
+	capManualEntry   = 0x80 // byte 1
+	capMagstripe     = 0x40 // byte 1
+	capChip          = 0x20 // byte 1
+	capOnlinePIN     = 0x40 // byte 2
+	capSignature     = 0x20 // byte 2
+	capInputMask     = 0xE0
+	capCVMOwnedMask  = capOnlinePIN | capSignature
+	capabilitiesSize = 3
+)
+
+func (m InputMethod) Valid() bool {
+	for _, k := range inputMethods {
+		if m == k {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON accepts known methods in any case; unknown values are kept
+// as sent and reported by Validate.
+func (m *InputMethod) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("input method %s: %w", data, ErrIncorrect)
+	}
+	*m = InputMethod(s)
+	for _, k := range inputMethods {
+		if strings.EqualFold(s, string(k)) {
+			*m = k
+		}
+	}
+	return nil
+}
+
+// InputMethods is the set of input methods enabled on a terminal.
+type InputMethods []InputMethod
+
+func (l InputMethods) Has(m InputMethod) bool {
+	for _, k := range l {
+		if k == m {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal reports whether both sets hold the same methods, in any order.
+func (l InputMethods) Equal(other InputMethods) bool {
+	a, b := l.sorted(), other.sorted()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (l InputMethods) sorted() []string {
+	s := make([]string, len(l))
+	for i, m := range l {
+		s[i] = string(m)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// Validate checks the set for unknown and duplicate methods and for
+// methods that depend on another one. The error is a ValidationError.
+func (l InputMethods) Validate() error {
+	e := ValidationError{}
+	e.inputMethods("inputMethods", l)
+	return e.err()
+}
+
+func (e ValidationError) inputMethods(field string, l InputMethods) {
+	seen := map[InputMethod]bool{}
+	for _, m := range l {
+		switch {
+		case !m.Valid():
+			e[field] = fmt.Sprintf("unknown input method %q", m)
+			return
+		case seen[m]:
+			e[field] = fmt.Sprintf("duplicate input method %q", m)
+			return
+		}
+		seen[m] = true
+	}
+	if seen[InputPINOnGlass] && !seen[InputContactless] {
+		e[field] = fmt.Sprintf("%s requires %s", InputPINOnGlass, InputContactless)
+	} else if seen[InputMagstripeFallback] && !seen[InputChip] {
+		e[field] = fmt.Sprintf("%s requires %s", InputMagstripeFallback, InputChip)
+	}
+}
+
+// validateUpdateInputMethods checks the input methods of a terminal
+// update body, which is either a Terminal or a map of changed fields.
+func validateUpdateInputMethods(data interface{}) error {
+	switch d := data.(type) {
+	case *Terminal:
+		return d.InputMethods.Validate()
+	case Terminal:
+		return d.InputMethods.Validate()
+	case map[string]interface{}:
+		switch l := d["inputMethods"].(type) {
+		case InputMethods:
+			return l.Validate()
+		case []InputMethod:
+			return InputMethods(l).Validate()
+		case []string:
+			list := make(InputMethods, len(l))
+			for i, m := range l {
+				list[i] = InputMethod(m)
+			}
+			return list.Validate()
+		}
+	}
+	return nil
+}
+
+// TerminalCapabilities returns the terminal capabilities (9F33) matching
+// the input methods. The card data input byte and the online PIN and
+// signature bits are derived from the set; the other CVM bits, such as
+// no CVM, and the security byte are kept from current, which may be nil.
+// Contactless and QR have no 9F33 bit.
+func (l InputMethods) TerminalCapabilities(current []byte) []byte {
+	caps := make([]byte, capabilitiesSize)
+	copy(caps, current)
+
+	caps[0] &^= capInputMask
+	caps[1] &^= capCVMOwnedMask
+	if l.Has(InputManual) {
+		caps[0] |= capManualEntry
+	}
+	if l.Has(InputMagstripe) || l.Has(InputMagstripeFallback) {
+		caps[0] |= capMagstripe
+	}
+	if l.Has(InputChip) {
+		caps[0] |= capChip
+	}
+	if l.Has(InputPINOnGlass) {
+		caps[1] |= capOnlinePIN
+	}
+	if l.Has(InputSignature) {
+		caps[1] |= capSignature
+	}
+	return caps
+}
+
+// InputMethodsFromCapabilities returns the input methods a terminal
+// capabilities (9F33) value advertises. Methods without a 9F33 bit, such
+// as contactless, cannot be recovered.
+func InputMethodsFromCapabilities(caps []byte) InputMethods {
+	l := InputMethods{}
+	if len(caps) < 2 {
+		return l
+	}
+	if caps[0]&capManualEntry != 0 {
+		l = append(l, InputManual)
+	}
+	if caps[0]&capMagstripe != 0 {
+		l = append(l, InputMagstripe)
+	}
+	if caps[0]&capChip != 0 {
+		l = append(l, InputChip)
+	}
+	if caps[1]&capOnlinePIN != 0 {
+		l = append(l, InputPINOnGlass)
+	}
+	if caps[1]&capSignature != 0 {
+		l = append(l, InputSignature)
+	}
+	return l
+}
+
+// CheckCapabilities reports whether the terminal capabilities preference
+// of a payment system agrees with the terminal input methods.
+func (t *TemrinalDetails) CheckCapabilities(paymentSystem string) error {
+	caps, err := t.Preferences.TerminalCapabilities(paymentSystem)
+	if err != nil {
+		return err
+	}
+	if len(caps) != capabilitiesSize {
+		return fmt.Errorf("9F33 %X: %w", caps, ErrPreferenceType)
+	}
+	want := t.InputMethods.TerminalCapabilities(caps)
+	if caps[0]&capInputMask != want[0]&capInputMask || caps[1]&capCVMOwnedMask != want[1]&capCVMOwnedMask {
+		return fmt.Errorf("9F33 %X does not match input methods %v, want %X: %w", caps, t.InputMethods, want, ErrCapabilityMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package softpos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestInputMethodsJSON(t *testing.T) {
+	var l InputMethods
+	if err := json.Unmarshal([]byte(`["contactless","PINONGLASS","Telepathy"]`), &l); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	want := InputMethods{InputContactless, InputPINOnGlass, "Telepathy"}
+	if !l.Equal(want) {
+		t.Errorf("Unmarshal = %v, want %v", l, want)
+	}
+	if err := l.Validate(); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrIncorrect)
+	}
+	if err := json.Unmarshal([]byte(`[1]`), &l); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Unmarshal number error = %v, want %v", err, ErrIncorrect)
+	}
+}
+
+func TestInputMethodsValidate(t *testing.T) {
+	tests := []struct {
+		in      InputMethods
+		wantErr bool
+	}{
+		{nil, false},
+		{InputMethods{InputContactless, InputPINOnGlass, InputQR}, false},
+		{InputMethods{InputChip, InputMagstripeFallback}, false},
+		{InputMethods{InputPINOnGlass}, true},
+		{InputMethods{InputMagstripeFallback}, true},
+		{InputMethods{InputManual, InputManual}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.in.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%v.Validate() error = %v", tt.in, err)
+		}
+	}
+
+	term := validTerminal()
+	term.InputMethods = InputMethods{"NFC"}
+	if got := fieldsOf(term.Validate()); len(got) != 1 || got[0] != "inputMethods" {
+		t.Errorf("Terminal.Validate() fields = %v, want [inputMethods]", got)
+	}
+}
+
+func TestInputMethodsCapabilities(t *testing.T) {
+	l := InputMethods{InputContactless, InputPINOnGlass, InputManual}
+	caps := l.TerminalCapabilities([]byte{0x20, 0xB0, 0xC8})
+	if got := fmt.Sprintf("%X", caps); got != "80D0C8" {
+		t.Errorf("TerminalCapabilities = %s, want 80D0C8", got)
+	}
+	if got := fmt.Sprintf("%X", (InputMethods{InputContactless}).TerminalCapabilities(nil)); got != "000000" {
+		t.Errorf("TerminalCapabilities(nil) = %s, want 000000", got)
+	}
+
+	back := InputMethodsFromCapabilities(caps)
+	if !back.Equal(InputMethods{InputManual, InputPINOnGlass}) {
+		t.Errorf("InputMethodsFromCapabilities = %v", back)
+	}
+
+	term := &TemrinalDetails{
+		InputMethods: l,
+		Preferences:  PreferenceList{{Tag: "9F33", Value: "80D8C8"}},
+	}
+	if err := term.CheckCapabilities("VISA"); err != nil {
+		t.Errorf("CheckCapabilities error = %v", err)
+	}
+	noCVM := &TemrinalDetails{
+		InputMethods: InputMethods{InputManual, InputMagstripe, InputChip, InputSignature},
+		Preferences:  PreferenceList{{Tag: "9F33", Value: "E0B0C8"}},
+	}
+	if err := noCVM.CheckCapabilities("VISA"); err != nil {
+		t.Errorf("CheckCapabilities without no CVM error = %v", err)
+	}
+	term.InputMethods = InputMethods{InputContactless}
+	if err := term.CheckCapabilities("VISA"); !errors.Is(err, ErrCapabilityMismatch) {
+		t.Errorf("CheckCapabilities error = %v, want %v", err, ErrCapabilityMismatch)
+	}
+	term.Preferences[0].Value = "E0"
+	if err := term.CheckCapabilities("VISA"); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("CheckCapabilities short value error = %v, want %v", err, ErrPreferenceType)
+	}
+}
+
+func TestTerminalInputMethodsRejected(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	})
+
+	ctx := context.Background()
+	bad := &Terminal{TerminalID: "66770050", InputMethods: InputMethods{"Swipe"}}
+	if err := c.TerminalService.Create(ctx, "600086900", bad, &TemrinalDetails{}); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Create error = %v, want %v", err, ErrIncorrect)
+	}
+	patch := map[string]interface{}{"inputMethods": []string{"Contactless", "Contactless"}}
+	if err := c.TerminalService.Update(ctx, "ref-1", patch); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Update error = %v, want %v", err, ErrIncorrect)
+	}
+}
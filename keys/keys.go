@@ -0,0 +1,289 @@
+// Package keys computes and verifies key check values of clear TDES and AES
+// keys and assembles keys from XOR components.
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrKeyLength   error = errors.New("invalid key length")
+	ErrKCVMismatch error = errors.New("key check value mismatch")
+	ErrKCVFormat   error = errors.New("invalid key check value")
+	ErrParity      error = errors.New("key is not odd parity")
+	ErrComponents  error = errors.New("no key components")
+)
+
+type Algorithm int
+
+const (
+	TDES Algorithm = iota + 1
+	AES
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case TDES:
+		return "TDES"
+	case AES:
+		return "AES"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+const (
+	// TDESKCVLen is the length of a TDES key check value in bytes.
+	TDESKCVLen = 3
+	// AESKCVLen is the length of an AES key check value in bytes.
+	AESKCVLen = 5
+)
+
+// NewCipher returns the block cipher for a clear key. Single and double
+// length TDES keys are expanded to three key form.
+func NewCipher(alg Algorithm, key []byte) (cipher.Block, error) {
+	switch alg {
+	case TDES:
+		k, err := TripleDESKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return des.NewTripleDESCipher(k)
+	case AES:
+		switch len(key) {
+		case 16, 24, 32:
+			return aes.NewCipher(key)
+		}
+		return nil, fmt.Errorf("AES key of %d bytes: %w", len(key), ErrKeyLength)
+	}
+	return nil, fmt.Errorf("unsupported algorithm %v", alg)
+}
+
+// TripleDESKey expands a single (8 byte) or double (16 byte) length DES key
+// into the 24 byte K1K2K3 form used by crypto/des.
+func TripleDESKey(key []byte) ([]byte, error) {
+	switch len(key) {
+	case 8:
+		return bytes.Repeat(key, 3), nil
+	case 16:
+		k := make([]byte, 0, 24)
+		return append(append(k, key...), key[:8]...), nil
+	case 24:
+		return append([]byte(nil), key...), nil
+	}
+	return nil, fmt.Errorf("TDES key of %d bytes: %w", len(key), ErrKeyLength)
+}
+
+// KCV computes the key check value of a clear key. TDES keys use the
+// leftmost 3 bytes of a block of zeros encrypted under the key, AES keys the
+// leftmost 5 bytes of the CMAC of a block of zeros (ANSI X9.24-1).
+func KCV(alg Algorithm, key []byte) ([]byte, error) {
+	b, err := NewCipher(alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	zeros := make([]byte, b.BlockSize())
+	switch alg {
+	case TDES:
+		out := make([]byte, b.BlockSize())
+		b.Encrypt(out, zeros)
+		return out[:TDESKCVLen], nil
+	default:
+		return CMAC(b, zeros)[:AESKCVLen], nil
+	}
+}
+
+// KCVHex is KCV encoded as upper case hex, as found in softpos.Keys.
+func KCVHex(alg Algorithm, key []byte) (string, error) {
+	kcv, err := KCV(alg, key)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(kcv)), nil
+}
+
+// Verify checks a clear key against a hex encoded key check value. Check
+// values shorter than the full one are compared on their length, which must
+// be at least 2 bytes.
+func Verify(alg Algorithm, key []byte, kcv string) error {
+	want, err := hex.DecodeString(strings.TrimSpace(kcv))
+	if err != nil || len(want) < 2 {
+		return fmt.Errorf("%q: %w", kcv, ErrKCVFormat)
+	}
+
+	got, err := KCV(alg, key)
+	if err != nil {
+		return err
+	}
+	if len(want) > len(got) {
+		return fmt.Errorf("%q: %w", kcv, ErrKCVFormat)
+	}
+	if subtle.ConstantTimeCompare(got[:len(want)], want) != 1 {
+		return fmt.Errorf("got %X, want %X: %w", got[:len(want)], want, ErrKCVMismatch)
+	}
+	return nil
+}
+
+// CMAC computes the NIST SP 800-38B CMAC of msg.
+func CMAC(b cipher.Block, msg []byte) []byte {
+	n := b.BlockSize()
+	k1, k2 := cmacSubkeys(b)
+
+	blocks := (len(msg) + n - 1) / n
+	last := make([]byte, n)
+	if blocks > 0 && len(msg)%n == 0 {
+		xor(last, msg[(blocks-1)*n:], k1)
+	} else {
+		if blocks == 0 {
+			blocks = 1
+		}
+		rest := msg[(blocks-1)*n:]
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xor(last, last, k2)
+	}
+
+	mac := make([]byte, n)
+	for i := 0; i < blocks-1; i++ {
+		xor(mac, mac, msg[i*n:(i+1)*n])
+		b.Encrypt(mac, mac)
+	}
+	xor(mac, mac, last)
+	b.Encrypt(mac, mac)
+	return mac
+}
+
+func cmacSubkeys(b cipher.Block) (k1, k2 []byte) {
+	n := b.BlockSize()
+	rb := byte(0x87)
+	if n == 8 {
+		rb = 0x1b
+	}
+
+	l := make([]byte, n)
+	b.Encrypt(l, l)
+	k1 = shiftLeft(l, rb)
+	k2 = shiftLeft(k1, rb)
+	return k1, k2
+}
+
+func shiftLeft(in []byte, rb byte) []byte {
+	out := make([]byte, len(in))
+	var carry byte
+	for i := len(in) - 1; i >= 0; i-- {
+		out[i] = in[i]<<1 | carry
+		carry = in[i] >> 7
+	}
+	if carry != 0 {
+		out[len(out)-1] ^= rb
+	}
+	return out
+}
+
+func xor(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+
+// Component is one XOR share of a key, as handed to a key custodian.
+type Component struct {
+	Value []byte
+	// KCV is the hex encoded check value of the component. It is verified
+	// by Combine when set.
+	KCV string
+}
+
+// Combine verifies the components check values and XORs them into a key.
+func Combine(alg Algorithm, components ...Component) ([]byte, error) {
+	if len(components) == 0 {
+		return nil, ErrComponents
+	}
+
+	key := make([]byte, len(components[0].Value))
+	for i, c := range components {
+		if len(c.Value) != len(key) {
+			return nil, fmt.Errorf("component %d: %w", i+1, ErrKeyLength)
+		}
+		if c.KCV != "" {
+			if err := Verify(alg, c.Value, c.KCV); err != nil {
+				return nil, fmt.Errorf("component %d: %w", i+1, err)
+			}
+		}
+		xor(key, key, c.Value)
+	}
+	if alg == TDES {
+		AdjustParity(key)
+	}
+	return key, nil
+}
+
+// Split divides a key into n random XOR components with their check values.
+func Split(alg Algorithm, key []byte, n int, rand io.Reader) ([]Component, error) {
+	if n < 2 {
+		return nil, fmt.Errorf("split into %d: %w", n, ErrComponents)
+	}
+	if _, err := NewCipher(alg, key); err != nil {
+		return nil, err
+	}
+
+	last := append([]byte(nil), key...)
+	components := make([]Component, 0, n)
+	for i := 0; i < n; i++ {
+		v := last
+		if i < n-1 {
+			v = make([]byte, len(key))
+			if _, err := io.ReadFull(rand, v); err != nil {
+				return nil, err
+			}
+			if alg == TDES {
+				AdjustParity(v)
+			}
+			xor(last, last, v)
+		}
+		kcv, err := KCVHex(alg, v)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, Component{Value: v, KCV: kcv})
+	}
+	return components, nil
+}
+
+// AdjustParity sets the low bit of every byte so the key has odd parity, as
+// required for DES keys.
+func AdjustParity(key []byte) {
+	for i, b := range key {
+		b &^= 1
+		if !oddParity(b) {
+			b |= 1
+		}
+		key[i] = b
+	}
+}
+
+// CheckParity returns ErrParity if any byte of the key has even parity.
+func CheckParity(key []byte) error {
+	for i, b := range key {
+		if !oddParity(b) {
+			return fmt.Errorf("byte %d: %w", i, ErrParity)
+		}
+	}
+	return nil
+}
+
+func oddParity(b byte) bool {
+	b ^= b >> 4
+	b ^= b >> 2
+	b ^= b >> 1
+	return b&1 == 1
+}
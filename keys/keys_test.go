@@ -0,0 +1,139 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestKCV(t *testing.T) {
+	tests := []struct {
+		alg  Algorithm
+		key  string
+		want string
+	}{
+		{TDES, "0123456789ABCDEFFEDCBA9876543210", "08D7B4"},
+		{TDES, "0123456789ABCDEF", "D5D44F"},
+		{TDES, "0123456789ABCDEFFEDCBA98765432100123456789ABCDEF", "08D7B4"},
+	}
+
+	for _, tt := range tests {
+		got, err := KCVHex(tt.alg, unhex(tt.key))
+		if err != nil {
+			t.Fatalf("KCVHex(%s) error = %v", tt.key, err)
+		}
+		if got != tt.want {
+			t.Errorf("KCVHex(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+
+	if _, err := KCV(AES, unhex("0123456789ABCDEF")); !errors.Is(err, ErrKeyLength) {
+		t.Errorf("KCV(AES, 8 bytes) error = %v, want %v", err, ErrKeyLength)
+	}
+}
+
+func TestAESKCV(t *testing.T) {
+	// The KCV is the CMAC of a zero block, which for one complete block is
+	// AES(K1): with the RFC 4493 key and its published subkey
+	// K1 = FBEED618357133667C85E08F7236A8DE that is 7AD386C3760FB349...
+	got, err := KCVHex(AES, unhex("2B7E151628AED2A6ABF7158809CF4F3C"))
+	if err != nil {
+		t.Fatalf("KCVHex error = %v", err)
+	}
+	if want := "7AD386C376"; got != want {
+		t.Errorf("KCVHex = %s, want %s", got, want)
+	}
+}
+
+// RFC 4493 section 4 test vectors.
+func TestCMAC(t *testing.T) {
+	b, _ := aes.NewCipher(unhex("2B7E151628AED2A6ABF7158809CF4F3C"))
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"", "BB1D6929E95937287FA37D129B756746"},
+		{"6BC1BEE22E409F96E93D7E117393172A", "070A16B46B4D4144F79BDD9DD04A287C"},
+		{"6BC1BEE22E409F96E93D7E117393172AAE2D8A571E03AC9C9EB76FAC45AF8E5130C81C46A35CE411", "DFA66747DE9AE63030CA32611497C827"},
+		{"6BC1BEE22E409F96E93D7E117393172AAE2D8A571E03AC9C9EB76FAC45AF8E5130C81C46A35CE411E5FBC1191A0A52EFF69F2445DF4F9B17AD2B417BE66C3710", "51F0BEBF7E3B9D92FC49741779363CFE"},
+	}
+
+	for _, tt := range tests {
+		if got := CMAC(b, unhex(tt.msg)); !bytes.Equal(got, unhex(tt.want)) {
+			t.Errorf("CMAC(%s) = %X, want %s", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := unhex("0123456789ABCDEFFEDCBA9876543210")
+
+	if err := Verify(TDES, key, "08d7b4"); err != nil {
+		t.Errorf("Verify error = %v", err)
+	}
+	if err := Verify(TDES, key, "08D7"); err != nil {
+		t.Errorf("Verify short error = %v", err)
+	}
+	if err := Verify(TDES, key, "083CA1"); !errors.Is(err, ErrKCVMismatch) {
+		t.Errorf("Verify error = %v, want %v", err, ErrKCVMismatch)
+	}
+	if err := Verify(TDES, key, "08"); !errors.Is(err, ErrKCVFormat) {
+		t.Errorf("Verify error = %v, want %v", err, ErrKCVFormat)
+	}
+	if err := Verify(TDES, key, "08D7B4FB62"); !errors.Is(err, ErrKCVFormat) {
+		t.Errorf("Verify error = %v, want %v", err, ErrKCVFormat)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	key := unhex("0123456789ABCDEFFEDCBA9876543210")
+
+	components, err := Split(TDES, key, 3, rand.Reader)
+	if err != nil {
+		t.Fatalf("Split error = %v", err)
+	}
+	if len(components) != 3 {
+		t.Fatalf("Split returned %d components, want 3", len(components))
+	}
+
+	got, err := Combine(TDES, components...)
+	if err != nil {
+		t.Fatalf("Combine error = %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("Combine = %X, want %X", got, key)
+	}
+
+	components[1].KCV = "000000"
+	if _, err := Combine(TDES, components...); !errors.Is(err, ErrKCVMismatch) {
+		t.Errorf("Combine error = %v, want %v", err, ErrKCVMismatch)
+	}
+	if _, err := Combine(TDES); !errors.Is(err, ErrComponents) {
+		t.Errorf("Combine error = %v, want %v", err, ErrComponents)
+	}
+}
+
+func TestParity(t *testing.T) {
+	key := unhex("0023456789ABCDEF")
+	if err := CheckParity(key); !errors.Is(err, ErrParity) {
+		t.Errorf("CheckParity error = %v, want %v", err, ErrParity)
+	}
+	AdjustParity(key)
+	if !bytes.Equal(key, unhex("0123456789ABCDEF")) {
+		t.Errorf("AdjustParity = %X", key)
+	}
+	if err := CheckParity(key); err != nil {
+		t.Errorf("CheckParity error = %v", err)
+	}
+}
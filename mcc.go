@@ -0,0 +1,258 @@
+package softpos
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed mcc.txt
+var mccData string
+
+// MCC is an ISO 18245 merchant category code. The TMS sends it either as a
+// JSON string or as a number depending on the endpoint, so both are
+// accepted when decoding. It is encoded as a number; fields the TMS
+// expects as a string use MCCString.
+type MCC int
+
+func (m MCC) String() string {
+	return fmt.Sprintf("%04d", int(m))
+}
+
+// Valid reports whether m is in the 0001-9999 range.
+func (m MCC) Valid() bool {
+	return m > 0 && m <= 9999
+}
+
+// Category returns the category group the code belongs to.
+func (m MCC) Category() MCCCategory {
+	for _, r := range mccRanges {
+		if m >= r.from && m <= r.to {
+			return r.category
+		}
+	}
+	return ""
+}
+
+// Label returns the code with its description, e.g. "5912 – Drug stores and
+// pharmacies", or only the code when it is not in DefaultMCCRegistry.
+func (m MCC) Label() string {
+	if info, ok := DefaultMCCRegistry.Lookup(m); ok {
+		return fmt.Sprintf("%s – %s", m, info.Description)
+	}
+	return m.String()
+}
+
+func (m *MCC) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			*m = 0
+			return nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 9999 {
+		return fmt.Errorf("mcc %s: %w", data, ErrIncorrect)
+	}
+	*m = MCC(v)
+	return nil
+}
+
+// MCCString is a merchant category code encoded as a JSON string, e.g.
+// "0742". It keeps the value as sent; a number is kept as its digits.
+// Use MCC to read the code.
+type MCCString string
+
+// MCC returns the code, or 0 if it is not numeric.
+func (s MCCString) MCC() MCC {
+	n, err := strconv.Atoi(strings.TrimSpace(string(s)))
+	if err != nil {
+		return 0
+	}
+	return MCC(n)
+}
+
+func (s *MCCString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if strings.HasPrefix(string(data), `"`) {
+		return json.Unmarshal(data, (*string)(s))
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*s = MCCString(n)
+	return nil
+}
+
+type MCCCategory string
+
+const (
+	MCCAgricultural MCCCategory = "Agricultural services"
+	MCCContracted   MCCCategory = "Contracted services"
+	MCCAirlines     MCCCategory = "Airlines"
+	MCCCarRental    MCCCategory = "Car rental"
+	MCCLodging      MCCCategory = "Lodging"
+	MCCTransport    MCCCategory = "Transportation services"
+	MCCUtilities    MCCCategory = "Utility services"
+	MCCRetail       MCCCategory = "Retail outlet services"
+	MCCClothing     MCCCategory = "Clothing stores"
+	MCCMiscStores   MCCCategory = "Miscellaneous stores"
+	MCCBusiness     MCCCategory = "Business services"
+	MCCProfessional MCCCategory = "Professional services and membership organizations"
+	MCCGovernment   MCCCategory = "Government services"
+)
+
+var mccRanges = []struct {
+	from, to MCC
+	category MCCCategory
+}{
+	{1, 1499, MCCAgricultural},
+	{1500, 2999, MCCContracted},
+	{3000, 3299, MCCAirlines},
+	{3300, 3499, MCCCarRental},
+	{3500, 3999, MCCLodging},
+	{4000, 4799, MCCTransport},
+	{4800, 4999, MCCUtilities},
+	{5000, 5599, MCCRetail},
+	{5600, 5699, MCCClothing},
+	{5700, 7299, MCCMiscStores},
+	{7300, 7999, MCCBusiness},
+	{8000, 8999, MCCProfessional},
+	{9000, 9999, MCCGovernment},
+}
+
+// rangeDescriptions describes the blocks of codes assigned to individual
+// airlines, car rental agencies and hotel chains.
+var rangeDescriptions = map[MCCCategory]string{
+	MCCAirlines:  "Airlines and air carriers",
+	MCCCarRental: "Car rental agencies",
+	MCCLodging:   "Lodging - hotels, motels and resorts",
+}
+
+// defaultHighRisk lists codes commonly treated as high brand risk by the
+// card schemes.
+var defaultHighRisk = []MCC{4816, 4829, 5122, 5912, 5962, 5966, 5967, 5993, 6051, 6211, 6540, 7273, 7801, 7802, 7995}
+
+type MCCInfo struct {
+	Code        MCC
+	Description string
+	Category    MCCCategory
+	HighRisk    bool
+}
+
+// MCCRegistry describes merchant category codes. It is safe for concurrent
+// use.
+type MCCRegistry struct {
+	mu       sync.RWMutex
+	entries  map[MCC]string
+	highRisk map[MCC]bool
+}
+
+// DefaultMCCRegistry is loaded from the embedded ISO 18245 code list.
+var DefaultMCCRegistry = NewMCCRegistry()
+
+// NewMCCRegistry returns a registry with the embedded ISO 18245 code list
+// and the default high risk codes.
+func NewMCCRegistry() *MCCRegistry {
+	r := &MCCRegistry{
+		entries:  make(map[MCC]string),
+		highRisk: make(map[MCC]bool),
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(mccData))
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		r.entries[MCC(v)] = fields[1]
+	}
+
+	r.SetHighRisk(true, defaultHighRisk...)
+	return r
+}
+
+// Set adds or replaces the description of a code.
+func (r *MCCRegistry) Set(code MCC, description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[code] = description
+}
+
+// SetHighRisk flags or unflags codes as high risk.
+func (r *MCCRegistry) SetHighRisk(risky bool, codes ...MCC) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range codes {
+		if risky {
+			r.highRisk[c] = true
+		} else {
+			delete(r.highRisk, c)
+		}
+	}
+}
+
+func (r *MCCRegistry) IsHighRisk(code MCC) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.highRisk[code]
+}
+
+// Lookup returns the description of a code. Codes in the airline, car
+// rental and lodging blocks get a generic description of their block.
+func (r *MCCRegistry) Lookup(code MCC) (MCCInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info := MCCInfo{
+		Code:     code,
+		Category: code.Category(),
+		HighRisk: r.highRisk[code],
+	}
+	desc, ok := r.entries[code]
+	if !ok {
+		desc, ok = rangeDescriptions[info.Category]
+	}
+	info.Description = desc
+	return info, ok
+}
+
+// ByCategory returns the known codes of a category sorted by code.
+func (r *MCCRegistry) ByCategory(category MCCCategory) []MCCInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := []MCCInfo{}
+	for code, desc := range r.entries {
+		if code.Category() != category {
+			continue
+		}
+		list = append(list, MCCInfo{
+			Code:        code,
+			Description: desc,
+			Category:    category,
+			HighRisk:    r.highRisk[code],
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
@@ -0,0 +1,96 @@
+package softpos
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMCCUnmarshal(t *testing.T) {
+	var v struct {
+		A MCC `json:"a"`
+		B MCC `json:"b"`
+		C MCC `json:"c"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":"5910","b":742,"c":""}`), &v); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	if v.A != 5910 || v.B != 742 || v.C != 0 {
+		t.Errorf("Unmarshal = %+v", v)
+	}
+	if v.B.String() != "0742" {
+		t.Errorf("String() = %q, want %q", v.B.String(), "0742")
+	}
+
+	if err := json.Unmarshal([]byte(`{"a":"59x0"}`), &v); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Unmarshal error = %v, want %v", err, ErrIncorrect)
+	}
+	if err := json.Unmarshal([]byte(`{"a":10000}`), &v); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Unmarshal error = %v, want %v", err, ErrIncorrect)
+	}
+
+	b, _ := json.Marshal(Terminal{Mcc: 5812})
+	if got, want := string(b), `{"mcc":5812}`; got != want {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+}
+
+func TestMCCString(t *testing.T) {
+	m := MerchantDetails{}
+	if err := json.Unmarshal([]byte(`{"mcc":742}`), &m); err != nil || m.Mcc != "742" || m.Mcc.MCC() != 742 {
+		t.Errorf("Unmarshal = %q, %v", m.Mcc, err)
+	}
+	for _, raw := range []string{"0000", "812", "N/A"} {
+		if err := json.Unmarshal([]byte(`{"mcc":"`+raw+`"}`), &m); err != nil || string(m.Mcc) != raw {
+			t.Errorf("Unmarshal(%q) = %q, %v", raw, m.Mcc, err)
+		}
+	}
+	if m.Mcc.MCC() != 0 {
+		t.Errorf("MCC() of N/A = %v", m.Mcc.MCC())
+	}
+	b, err := json.Marshal(MerchantDetails{Mcc: "0742"})
+	if err != nil || string(b) != `{"mcc":"0742"}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+}
+
+func TestMCCRegistry(t *testing.T) {
+	r := NewMCCRegistry()
+
+	info, ok := r.Lookup(5912)
+	if !ok || info.Description != "Drug stores and pharmacies" || info.Category != MCCMiscStores || !info.HighRisk {
+		t.Errorf("Lookup(5912) = %+v, %v", info, ok)
+	}
+	if info, ok := r.Lookup(3005); !ok || info.Category != MCCAirlines {
+		t.Errorf("Lookup(3005) = %+v, %v", info, ok)
+	}
+	if _, ok := r.Lookup(5910); ok {
+		t.Error("Lookup(5910) found an unassigned code")
+	}
+
+	r.SetHighRisk(false, 5912)
+	r.SetHighRisk(true, 5812)
+	if r.IsHighRisk(5912) || !r.IsHighRisk(5812) {
+		t.Error("SetHighRisk did not update the registry")
+	}
+	if !DefaultMCCRegistry.IsHighRisk(5912) {
+		t.Error("DefaultMCCRegistry changed by another registry")
+	}
+
+	r.Set(5910, "Drug stores")
+	if got, want := r.ByCategory(MCCMiscStores)[0].Code, MCC(5712); got != want {
+		t.Errorf("ByCategory first = %v, want %v", got, want)
+	}
+	if got := r.ByCategory(MCCClothing); len(got) != 12 {
+		t.Errorf("ByCategory(clothing) = %d codes, want 12", len(got))
+	}
+}
+
+func TestMCCLabel(t *testing.T) {
+	if got, want := MCC(5812).Label(), "5812 – Eating places and restaurants"; got != want {
+		t.Errorf("Label() = %q, want %q", got, want)
+	}
+	if got, want := MCC(5910).Label(), "5910"; got != want {
+		t.Errorf("Label() = %q, want %q", got, want)
+	}
+}
@@ -7,69 +7,72 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
 type MerchantService service
 
 type MerchnatList struct {
-	Index      int `json:"index"`
-	TotalPages int `json:"totalPages"`
-	Count      int `json:"count"`
-	TotalCount int `json:"totalCount"`
-	PerPage    int `json:"perPage"`
-	Offset     int `json:"offset"`
-	Items      []struct {
-		State              string    `json:"state"`
-		Reference          string    `json:"reference"`
-		MerchantID         string    `json:"merchantId"`
-		IsLocationRequired bool      `json:"isLocationRequired"`
-		Name               string    `json:"name"`
-		TaxRefNumber       string    `json:"taxRefNumber"`
-		Country            int       `json:"country"`
-		City               string    `json:"city"`
-		Region             string    `json:"region"`
-		Address            string    `json:"address"`
-		PostalCode         string    `json:"postalCode"`
-		Phone              string    `json:"phone"`
-		Email              string    `json:"email"`
-		Created            time.Time `json:"created"`
-		Updated            time.Time `json:"updated"`
-		Acquirer           string    `json:"acquirer"`
-		Currency           int       `json:"currency"`
-		Mcc                string    `json:"mcc"`
-		Language           string    `json:"language"`
-		Profile            string    `json:"profile"`
-		Flags              string    `json:"flags"`
-	} `json:"items"`
+	Index      int                `json:"index"`
+	TotalPages int                `json:"totalPages"`
+	Count      int                `json:"count"`
+	TotalCount int                `json:"totalCount"`
+	PerPage    int                `json:"perPage"`
+	Offset     int                `json:"offset"`
+	Items      []MerchantListItem `json:"items"`
+}
+
+type MerchantListItem struct {
+	State              string    `json:"state"`
+	Reference          string    `json:"reference"`
+	MerchantID         string    `json:"merchantId"`
+	IsLocationRequired bool      `json:"isLocationRequired"`
+	Name               string    `json:"name"`
+	TaxRefNumber       string    `json:"taxRefNumber"`
+	Country            int       `json:"country"`
+	City               string    `json:"city"`
+	Region             string    `json:"region"`
+	Address            string    `json:"address"`
+	PostalCode         string    `json:"postalCode"`
+	Phone              string    `json:"phone"`
+	Email              string    `json:"email"`
+	Created            time.Time `json:"created"`
+	Updated            time.Time `json:"updated"`
+	Acquirer           string    `json:"acquirer"`
+	Currency           int       `json:"currency"`
+	Mcc                MCCString `json:"mcc"`
+	Language           string    `json:"language"`
+	Profile            string    `json:"profile"`
+	Flags              string    `json:"flags"`
 }
 
 type MerchantDetails struct {
-	CurrencyName       string `json:"currencyName,omitempty"`
-	AcquirerName       string `json:"acquirerName,omitempty"`
-	CountryName        string `json:"countryName,omitempty"`
-	CountryNativeName  string `json:"countryNativeName,omitempty"`
-	Mcc                string `json:"mcc,omitempty"`
-	State              string `json:"state,omitempty"`
-	Reference          string `json:"reference,omitempty"`
-	MerchantID         string `json:"merchantId,omitempty"`
-	IsLocationRequired bool   `json:"isLocationRequired,omitempty"`
-	Name               string `json:"name,omitempty"`
-	TaxRefNumber       string `json:"taxRefNumber,omitempty"`
-	Country            int    `json:"country,omitempty"`
-	City               string `json:"city,omitempty"`
-	Region             string `json:"region,omitempty"`
-	Address            string `json:"address,omitempty"`
-	PostalCode         string `json:"postalCode,omitempty"`
-	Phone              string `json:"phone,omitempty"`
-	Email              string `json:"email,omitempty"`
-	Created            string `json:"created,omitempty"`
-	Updated            string `json:"updated,omitempty"`
-	Acquirer           string `json:"acquirer,omitempty"`
-	Currency           int    `json:"currency,omitempty"`
-	Language           string `json:"language,omitempty"`
-	Profile            string `json:"profile,omitempty"`
-	Flags              string `json:"flags,omitempty"`
+	CurrencyName       string    `json:"currencyName,omitempty"`
+	AcquirerName       string    `json:"acquirerName,omitempty"`
+	CountryName        string    `json:"countryName,omitempty"`
+	CountryNativeName  string    `json:"countryNativeName,omitempty"`
+	Mcc                MCCString `json:"mcc,omitempty"`
+	State              string    `json:"state,omitempty"`
+	Reference          string    `json:"reference,omitempty"`
+	MerchantID         string    `json:"merchantId,omitempty"`
+	IsLocationRequired bool      `json:"isLocationRequired,omitempty"`
+	Name               string    `json:"name,omitempty"`
+	TaxRefNumber       string    `json:"taxRefNumber,omitempty"`
+	Country            int       `json:"country,omitempty"`
+	City               string    `json:"city,omitempty"`
+	Region             string    `json:"region,omitempty"`
+	Address            string    `json:"address,omitempty"`
+	PostalCode         string    `json:"postalCode,omitempty"`
+	Phone              string    `json:"phone,omitempty"`
+	Email              string    `json:"email,omitempty"`
+	Created            string    `json:"created,omitempty"`
+	Updated            string    `json:"updated,omitempty"`
+	Acquirer           string    `json:"acquirer,omitempty"`
+	Currency           int       `json:"currency,omitempty"`
+	Language           string    `json:"language,omitempty"`
+	Profile            string    `json:"profile,omitempty"`
+	Flags              string    `json:"flags,omitempty"`
 }
 
 func (c *MerchantService) GetList(ctx context.Context, v interface{}) (err error) {
@@ -78,6 +81,33 @@ func (c *MerchantService) GetList(ctx context.Context, v interface{}) (err error
 	return c.client.processRequest(ctx, http.MethodGet, url, nil, v)
 }
 
+// GetPage returns one page of merchants. Pages start at 1; a zero perPage
+// leaves the page size to the TMS.
+func (c *MerchantService) GetPage(ctx context.Context, page, perPage int, v interface{}) (err error) {
+	q := url.Values{}
+	q.Set("page", strconv.Itoa(page))
+	if perPage > 0 {
+		q.Set("perPage", strconv.Itoa(perPage))
+	}
+	url := url.URL{Path: "merchants", RawQuery: q.Encode()}
+	return c.client.processRequest(ctx, http.MethodGet, url, nil, v)
+}
+
+// GetAll walks every page of merchants.
+func (c *MerchantService) GetAll(ctx context.Context) ([]MerchantListItem, error) {
+	all := []MerchantListItem{}
+	for page := 1; ; page++ {
+		list := MerchnatList{}
+		if err := c.GetPage(ctx, page, 0, &list); err != nil {
+			return nil, fmt.Errorf("merchants page %d: %w", page, err)
+		}
+		all = append(all, list.Items...)
+		if len(list.Items) == 0 || page >= list.TotalPages {
+			return all, nil
+		}
+	}
+}
+
 func (c *MerchantService) GetDetails(ctx context.Context, mid string, v interface{}) (err error) {
 	path := "merchants"
 	url := url.URL{Path: fmt.Sprintf("%s/%s", path, mid)}
@@ -103,7 +133,7 @@ func (c *MerchantService) Create(ctx context.Context, data *MerchantDetails, v i
 	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusCreated {
-		err = json.NewDecoder(res.Body).Decode(v)
+		err = c.client.decode(res, v)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,324 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncStats summarises a mirror sync.
+type SyncStats struct {
+	Full             bool
+	Merchants        int
+	Terminals        int
+	MerchantsFetched int
+	Created          int
+	Updated          int
+	Deleted          int
+	Finished         time.Time
+}
+
+// Mirror keeps a local copy of merchants and terminals in a Store and
+// indexes it for queries.
+type Mirror struct {
+	// FullSyncInterval is how often Sync runs a full sync, picking up
+	// terminal changes that do not touch their merchant. Zero makes every
+	// sync full.
+	FullSyncInterval time.Duration
+
+	client *Client
+	store  Store
+	syncMu sync.Mutex
+
+	mu        sync.RWMutex
+	merchants map[string]MerchantListItem
+	terminals map[string]mirroredTerminal
+	index     map[string]map[string][]string
+	lastFull  time.Time
+}
+
+// mirroredTerminal is a terminal with the ID of the merchant it was listed
+// under.
+type mirroredTerminal struct {
+	merchantID string
+	details    TemrinalDetails
+}
+
+// Index names.
+const (
+	indexMerchantState    = "merchant-state"
+	indexMerchantAcquirer = "merchant-acquirer"
+	indexMerchantMCC      = "merchant-mcc"
+	indexTerminalState    = "terminal-state"
+	indexTerminalAcquirer = "terminal-acquirer"
+	indexTerminalMCC      = "terminal-mcc"
+	indexTerminalID       = "terminal-id"
+)
+
+// NewMirror loads the store contents.
+func NewMirror(client *Client, store Store) (*Mirror, error) {
+	m := &Mirror{FullSyncInterval: time.Hour, client: client, store: store}
+	merchants, err := store.Merchants()
+	if err != nil {
+		return nil, err
+	}
+	terminals, err := store.Terminals()
+	if err != nil {
+		return nil, err
+	}
+
+	m.merchants = map[string]MerchantListItem{}
+	for _, mer := range merchants {
+		m.merchants[mer.MerchantID] = mer
+	}
+	m.terminals = map[string]mirroredTerminal{}
+	for mid, list := range terminals {
+		for _, t := range list {
+			m.terminals[terminalKey(mid, t.TerminalID)] = mirroredTerminal{merchantID: mid, details: t}
+		}
+	}
+	m.reindex()
+	return m, nil
+}
+
+// Sync runs an incremental sync, or a full one when the store was never
+// synced, on the first Sync of the mirror or once FullSyncInterval has
+// passed since the last full sync.
+func (m *Mirror) Sync(ctx context.Context) (SyncStats, error) {
+	last, err := m.store.LastSync()
+	if err != nil {
+		return SyncStats{}, err
+	}
+	m.mu.RLock()
+	lastFull := m.lastFull
+	m.mu.RUnlock()
+	full := last.IsZero() || lastFull.IsZero() || time.Since(lastFull) >= m.FullSyncInterval
+	return m.sync(ctx, full)
+}
+
+// FullSync lists the terminals of every merchant.
+func (m *Mirror) FullSync(ctx context.Context) (SyncStats, error) {
+	return m.sync(ctx, true)
+}
+
+// IncrementalSync lists merchants and fetches terminals only of merchants
+// that are new or whose Updated time changed. Terminal changes that do not
+// touch the merchant are picked up by the next full sync.
+func (m *Mirror) IncrementalSync(ctx context.Context) (SyncStats, error) {
+	return m.sync(ctx, false)
+}
+
+func (m *Mirror) sync(ctx context.Context, full bool) (SyncStats, error) {
+	m.syncMu.Lock()
+	defer m.syncMu.Unlock()
+	stats := SyncStats{Full: full}
+
+	items, err := m.client.MerchantService.GetAll(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	m.mu.RLock()
+	oldMerchants, oldTerminals := m.merchants, m.terminals
+	m.mu.RUnlock()
+	byMerchant := map[string][]string{}
+	for k, t := range oldTerminals {
+		byMerchant[t.merchantID] = append(byMerchant[t.merchantID], k)
+	}
+
+	merchants := map[string]MerchantListItem{}
+	terminals := map[string]mirroredTerminal{}
+	for _, mer := range items {
+		merchants[mer.MerchantID] = mer
+		old, known := oldMerchants[mer.MerchantID]
+		if !full && known && !mer.Updated.IsZero() && mer.Updated.Equal(old.Updated) {
+			for _, k := range byMerchant[mer.MerchantID] {
+				terminals[k] = oldTerminals[k]
+			}
+			continue
+		}
+
+		page := []TemrinalDetails{}
+		if err := m.client.TerminalService.GetListByMerchnat(ctx, mer.MerchantID, &page); err != nil {
+			return stats, fmt.Errorf("merchant %s: %w", mer.MerchantID, err)
+		}
+		stats.MerchantsFetched++
+		for _, t := range page {
+			terminals[terminalKey(mer.MerchantID, t.TerminalID)] = mirroredTerminal{merchantID: mer.MerchantID, details: t}
+		}
+	}
+
+	for id, mer := range merchants {
+		if old, ok := oldMerchants[id]; !ok {
+			stats.Created++
+		} else if reflect.DeepEqual(old, mer) {
+			continue
+		} else {
+			stats.Updated++
+		}
+		if err := m.store.PutMerchant(mer); err != nil {
+			return stats, err
+		}
+	}
+	for k, t := range terminals {
+		if old, ok := oldTerminals[k]; !ok {
+			stats.Created++
+		} else if reflect.DeepEqual(old, t) {
+			continue
+		} else {
+			stats.Updated++
+		}
+		if err := m.store.PutTerminal(t.merchantID, t.details); err != nil {
+			return stats, err
+		}
+	}
+	for k, t := range oldTerminals {
+		if _, ok := terminals[k]; !ok {
+			stats.Deleted++
+			if err := m.store.DeleteTerminal(t.merchantID, t.details.TerminalID); err != nil {
+				return stats, err
+			}
+		}
+	}
+	for id := range oldMerchants {
+		if _, ok := merchants[id]; !ok {
+			stats.Deleted++
+			if err := m.store.DeleteMerchant(id); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	stats.Finished = time.Now().UTC()
+	if err := m.store.SetLastSync(stats.Finished); err != nil {
+		return stats, err
+	}
+
+	m.mu.Lock()
+	m.merchants, m.terminals = merchants, terminals
+	if full {
+		m.lastFull = stats.Finished
+	}
+	m.reindex()
+	m.mu.Unlock()
+
+	stats.Merchants, stats.Terminals = len(merchants), len(terminals)
+	return stats, nil
+}
+
+// terminalMCC is the terminal MCC, falling back to the merchant one.
+func terminalMCC(t *TemrinalDetails) MCC {
+	switch {
+	case t.TerminalMcc.MCC() != 0:
+		return t.TerminalMcc.MCC()
+	case t.Mcc != 0:
+		return t.Mcc
+	}
+	return t.Merchant.Mcc.MCC()
+}
+
+func (m *Mirror) reindex() {
+	idx := map[string]map[string][]string{}
+	add := func(index, value, key string) {
+		if idx[index] == nil {
+			idx[index] = map[string][]string{}
+		}
+		value = strings.ToLower(value)
+		idx[index][value] = append(idx[index][value], key)
+	}
+
+	for id, mer := range m.merchants {
+		add(indexMerchantState, mer.State, id)
+		add(indexMerchantAcquirer, mer.Acquirer, id)
+		add(indexMerchantMCC, mer.Mcc.MCC().String(), id)
+	}
+	for k, mt := range m.terminals {
+		t := mt.details
+		acquirer := t.Merchant.Acquirer
+		if mer, ok := m.merchants[mt.merchantID]; ok && acquirer == "" {
+			acquirer = mer.Acquirer
+		}
+		add(indexTerminalState, t.State, k)
+		add(indexTerminalAcquirer, acquirer, k)
+		add(indexTerminalMCC, terminalMCC(&t).String(), k)
+		add(indexTerminalID, t.TerminalID, k)
+	}
+	for _, values := range idx {
+		for _, keys := range values {
+			sort.Strings(keys)
+		}
+	}
+	m.index = idx
+}
+
+func (m *Mirror) terminalsBy(index, value string) []TemrinalDetails {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := m.index[index][strings.ToLower(value)]
+	list := make([]TemrinalDetails, len(keys))
+	for i, k := range keys {
+		list[i] = m.terminals[k].details
+	}
+	return list
+}
+
+func (m *Mirror) merchantsBy(index, value string) []MerchantListItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := m.index[index][strings.ToLower(value)]
+	list := make([]MerchantListItem, len(keys))
+	for i, k := range keys {
+		list[i] = m.merchants[k]
+	}
+	return list
+}
+
+func (m *Mirror) Merchant(mid string) (MerchantListItem, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mer, ok := m.merchants[mid]
+	return mer, ok
+}
+
+func (m *Mirror) Terminal(mid, tid string) (TemrinalDetails, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.terminals[terminalKey(mid, tid)]
+	return t.details, ok
+}
+
+// TerminalsByID returns the terminals with the ID under any merchant.
+func (m *Mirror) TerminalsByID(tid string) []TemrinalDetails {
+	return m.terminalsBy(indexTerminalID, tid)
+}
+
+func (m *Mirror) TerminalsByState(state string) []TemrinalDetails {
+	return m.terminalsBy(indexTerminalState, state)
+}
+
+// TerminalsByAcquirer returns the terminals of merchants of the acquirer.
+func (m *Mirror) TerminalsByAcquirer(acquirer string) []TemrinalDetails {
+	return m.terminalsBy(indexTerminalAcquirer, acquirer)
+}
+
+// TerminalsByMCC matches the terminal MCC or, when not set, the merchant
+// MCC.
+func (m *Mirror) TerminalsByMCC(mcc MCC) []TemrinalDetails {
+	return m.terminalsBy(indexTerminalMCC, mcc.String())
+}
+
+func (m *Mirror) MerchantsByState(state string) []MerchantListItem {
+	return m.merchantsBy(indexMerchantState, state)
+}
+
+func (m *Mirror) MerchantsByAcquirer(acquirer string) []MerchantListItem {
+	return m.merchantsBy(indexMerchantAcquirer, acquirer)
+}
+
+func (m *Mirror) MerchantsByMCC(mcc MCC) []MerchantListItem {
+	return m.merchantsBy(indexMerchantMCC, mcc.String())
+}
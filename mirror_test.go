@@ -0,0 +1,146 @@
+package softpos
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirrorSync(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	tms := &fakeTMS{}
+	tms.register(t, mux)
+	tms.set(`{"items":[
+		{"merchantId":"600086900","state":"Active","acquirer":"cbq","mcc":5812,"updated":"2022-03-01T00:00:00Z"},
+		{"merchantId":"999700163","state":"Suspended","acquirer":"QNB","mcc":5411,"updated":"2022-03-01T00:00:00Z"}]}`,
+		map[string]string{
+			"600086900": `[{"terminalId":"66770050","state":"Active","terminalMcc":5814},{"terminalId":"66770051","state":"Blocked"}]`,
+			"999700163": `[{"terminalId":"66770050","state":"Active","merchant":{"merchantId":"999700163","mcc":5411}}]`,
+		})
+
+	store, err := OpenFileStore(filepath.Join(t.TempDir(), "fleet.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	m, err := NewMirror(c, store)
+	if err != nil {
+		t.Fatalf("NewMirror error = %v", err)
+	}
+	ctx := context.Background()
+	stats, err := m.Sync(ctx)
+	if err != nil || !stats.Full || stats.Merchants != 2 || stats.Terminals != 3 || stats.Created != 5 {
+		t.Fatalf("first Sync = %+v, %v", stats, err)
+	}
+
+	if n := len(m.TerminalsByID("66770050")); n != 2 {
+		t.Errorf("TerminalsByID = %d terminals, want 2", n)
+	}
+	if n := len(m.TerminalsByState("active")); n != 2 {
+		t.Errorf("TerminalsByState(active) = %d, want 2", n)
+	}
+	if l := m.TerminalsByAcquirer("CBQ"); len(l) != 2 {
+		t.Errorf("TerminalsByAcquirer(CBQ) = %d, want 2", len(l))
+	}
+	if l := m.TerminalsByMCC(5814); len(l) != 1 || l[0].TerminalID != "66770050" {
+		t.Errorf("TerminalsByMCC(5814) = %+v", l)
+	}
+	if l := m.TerminalsByMCC(5411); len(l) != 1 || l[0].Merchant.MerchantID != "999700163" {
+		t.Errorf("TerminalsByMCC(5411) = %+v", l)
+	}
+	if l := m.MerchantsByState("Suspended"); len(l) != 1 || l[0].MerchantID != "999700163" {
+		t.Errorf("MerchantsByState = %+v", l)
+	}
+
+	tms.set(`{"items":[{"merchantId":"600086900","state":"Active","acquirer":"cbq","mcc":5812,"updated":"2022-03-02T00:00:00Z"},
+		{"merchantId":"999700163","state":"Suspended","acquirer":"QNB","mcc":5411,"updated":"2022-03-01T00:00:00Z"}]}`,
+		map[string]string{
+			"600086900": `[{"terminalId":"66770050","state":"Active","terminalMcc":5814}]`,
+			"999700163": `[]`,
+		})
+	tms.listed = 0
+	stats, err = m.Sync(ctx)
+	if err != nil || stats.Full || stats.MerchantsFetched != 1 || tms.listed != 1 || stats.Deleted != 1 || stats.Updated != 1 {
+		t.Fatalf("incremental Sync = %+v, %v (listed %d)", stats, err, tms.listed)
+	}
+	if _, ok := m.Terminal("999700163", "66770050"); !ok {
+		t.Error("incremental sync dropped terminal of unchanged merchant")
+	}
+	if _, ok := m.Terminal("600086900", "66770051"); ok {
+		t.Error("deleted terminal still mirrored")
+	}
+
+	stats, err = m.FullSync(ctx)
+	if err != nil || stats.Deleted != 1 || stats.Terminals != 1 {
+		t.Fatalf("FullSync = %+v, %v", stats, err)
+	}
+
+	reloaded, err := NewMirror(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := reloaded.TerminalsByAcquirer("cbq"); len(l) != 1 {
+		t.Errorf("reloaded TerminalsByAcquirer = %+v", l)
+	}
+	if _, ok := reloaded.Merchant("999700163"); !ok {
+		t.Error("reloaded mirror lost merchant")
+	}
+}
+
+func TestMirrorPagesAndTerminalChanges(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	tms := &fakeTMS{}
+	tms.register(t, mux)
+	tms.pages = map[string]string{
+		"1": `{"index":1,"totalPages":2,"items":[{"merchantId":"600086900","updated":"2022-03-01T00:00:00Z"}]}`,
+		"2": `{"index":2,"totalPages":2,"items":[{"merchantId":"999700163","updated":"2022-03-01T00:00:00Z"}]}`,
+	}
+	tms.set("", map[string]string{
+		"600086900": `[{"terminalId":"66770050","state":"Active"}]`,
+		"999700163": `[{"terminalId":"66770051","state":"Active","merchant":{"merchantId":"999700000"}}]`,
+	})
+
+	store := NewMemoryStore()
+	m, err := NewMirror(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		stats, err := m.Sync(ctx)
+		if err != nil || stats.Merchants != 2 || stats.Terminals != 2 || stats.Deleted != 0 {
+			t.Fatalf("Sync %d = %+v, %v", i, stats, err)
+		}
+	}
+	if _, ok := m.Terminal("999700163", "66770051"); !ok {
+		t.Error("terminal not mirrored under the merchant it was listed under")
+	}
+
+	tms.set("", map[string]string{
+		"600086900": `[{"terminalId":"66770050","state":"Blocked"}]`,
+		"999700163": `[{"terminalId":"66770051","state":"Active","merchant":{"merchantId":"999700000"}}]`,
+	})
+	if stats, err := m.Sync(ctx); err != nil || stats.Full || stats.Updated != 0 {
+		t.Fatalf("incremental Sync = %+v, %v", stats, err)
+	}
+	m.FullSyncInterval = 0
+	if stats, err := m.Sync(ctx); err != nil || !stats.Full || stats.Updated != 1 {
+		t.Fatalf("scheduled full Sync = %+v, %v", stats, err)
+	}
+	if term, _ := m.Terminal("600086900", "66770050"); term.State != "Blocked" {
+		t.Errorf("terminal state = %q, want Blocked", term.State)
+	}
+
+	reloaded, err := NewMirror(c, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Terminal("999700163", "66770051"); !ok {
+		t.Error("reloaded mirror lost terminal")
+	}
+}
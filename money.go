@@ -0,0 +1,194 @@
+package softpos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount expressed in minor units of an ISO 4217 currency,
+// e.g. Money{Amount: 1250, Currency: 634} is 12.50 QAR.
+type Money struct {
+	Amount   int64
+	Currency int
+}
+
+// minorUnits lists ISO 4217 currencies which do not use two decimal places.
+// It is only a fallback for when the Currency from CurrencyService is not
+// at hand, such as in String, refund amounts and settlement files; its
+// DecimalPlaces is authoritative.
+var minorUnits = map[int]int{
+	108: 0, 152: 0, 174: 0, 262: 0, 324: 0, 352: 0, 392: 0, 410: 0, 548: 0,
+	600: 0, 646: 0, 704: 0, 800: 0, 940: 0, 950: 0, 952: 0, 953: 0,
+	48: 3, 368: 3, 400: 3, 414: 3, 434: 3, 512: 3, 788: 3,
+	927: 4, 990: 4,
+}
+
+// DecimalPlaces returns the ISO 4217 number of minor unit digits for the
+// currency code from the fallback table. Unknown codes default to 2. Use
+// Currency.DecimalPlaces when the currency was fetched from the TMS.
+func DecimalPlaces(code int) int {
+	if d, ok := minorUnits[code]; ok {
+		return d
+	}
+	return 2
+}
+
+func NewMoney(amount int64, currency int) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount such as "12.50" or "-3" using the
+// decimal places of the currency.
+func ParseMoney(s string, currency Currency) (Money, error) {
+	amount, err := parseMinor(s, currency.DecimalPlaces)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency.Code}, nil
+}
+
+func parseMinor(s string, places int) (int64, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if (whole == "" && frac == "") || len(frac) > places || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%q: %w", orig, ErrInvalidAmount)
+	}
+	frac += strings.Repeat("0", places-len(frac))
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", orig, ErrAmountOverflow)
+	}
+	if neg {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal returns the amount as a decimal string with the given number of
+// decimal places, e.g. "12.50".
+func (m Money) Decimal(places int) string {
+	neg := m.Amount < 0
+	// strconv on uint64 keeps math.MinInt64 representable
+	u := uint64(m.Amount)
+	if neg {
+		u = -u
+	}
+	s := strconv.FormatUint(u, 10)
+	if places > 0 {
+		if len(s) <= places {
+			s = strings.Repeat("0", places-len(s)+1) + s
+		}
+		s = s[:len(s)-places] + "." + s[len(s)-places:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Format renders the amount using the currency sign and decimal places,
+// falling back to the currency name when no sign is defined.
+func (m Money) Format(currency Currency) string {
+	sign := currency.Sign
+	if sign == "" {
+		sign = currency.Name
+	}
+	return strings.TrimSpace(m.Decimal(currency.DecimalPlaces) + " " + sign)
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%s %03d", m.Decimal(DecimalPlaces(m.Currency)), m.Currency)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%03d + %03d: %w", m.Currency, o.Currency, ErrCurrencyMismatch)
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) ||
+		(o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrAmountOverflow
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%03d - %03d: %w", m.Currency, o.Currency, ErrCurrencyMismatch)
+	}
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrAmountOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+// Cmp compares two amounts of the same currency and returns -1, 0 or +1.
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, fmt.Errorf("%03d <> %03d: %w", m.Currency, o.Currency, ErrCurrencyMismatch)
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// MarshalJSON encodes the amount as a number of minor units, which is how
+// the TMS represents amounts such as contactless limits. The currency is
+// not part of the encoding and has to be taken from the enclosing entity.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Amount, 10)), nil
+}
+
+// UnmarshalJSON accepts a number or a string of minor units. The currency
+// is left untouched.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	s := string(data)
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	amount, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return fmt.Errorf("money %s: %w", data, ErrInvalidAmount)
+	}
+	m.Amount = amount
+	return nil
+}
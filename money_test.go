@@ -0,0 +1,126 @@
+package softpos
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+var qar = Currency{Name: "QAR", Code: 634, DecimalPlaces: 2, Sign: "QR"}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		cur  Currency
+		want int64
+		err  error
+	}{
+		{"12.50", qar, 1250, nil},
+		{"12.5", qar, 1250, nil},
+		{"12", qar, 1200, nil},
+		{".5", qar, 50, nil},
+		{"-3.01", qar, -301, nil},
+		{"1.234", Currency{Code: 48, DecimalPlaces: 3}, 1234, nil},
+		{"100", Currency{Code: 392, DecimalPlaces: 0}, 100, nil},
+		{"12.505", qar, 0, ErrInvalidAmount},
+		{"1,000.00", qar, 0, ErrInvalidAmount},
+		{"", qar, 0, ErrInvalidAmount},
+		{".", qar, 0, ErrInvalidAmount},
+		{"99999999999999999999", qar, 0, ErrAmountOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, tt.cur)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && (got.Amount != tt.want || got.Currency != tt.cur.Code) {
+			t.Errorf("ParseMoney(%q) = %+v, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		m    Money
+		cur  Currency
+		want string
+	}{
+		{Money{1250, 634}, qar, "12.50 QR"},
+		{Money{5, 634}, qar, "0.05 QR"},
+		{Money{-5, 634}, qar, "-0.05 QR"},
+		{Money{1234, 48}, Currency{Name: "BHD", Code: 48, DecimalPlaces: 3}, "1.234 BHD"},
+		{Money{100, 392}, Currency{Code: 392, DecimalPlaces: 0, Sign: "¥"}, "100 ¥"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.Format(tt.cur); got != tt.want {
+			t.Errorf("Format(%+v) = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+
+	if got, want := (Money{math.MinInt64, 634}).Decimal(2), "-92233720368547758.08"; got != want {
+		t.Errorf("Decimal(MinInt64) = %q, want %q", got, want)
+	}
+	if got, want := (Money{1234, 414}).String(), "1.234 414"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, b := Money{1000, 634}, Money{250, 634}
+
+	sum, err := a.Add(b)
+	if err != nil || sum.Amount != 1250 {
+		t.Errorf("Add = %v, %v, want 1250", sum, err)
+	}
+	diff, err := b.Sub(a)
+	if err != nil || diff.Amount != -750 || !diff.IsNegative() {
+		t.Errorf("Sub = %v, %v, want -750", diff, err)
+	}
+	if c, err := a.Cmp(b); err != nil || c != 1 {
+		t.Errorf("Cmp = %v, %v, want 1", c, err)
+	}
+
+	usd := Money{100, 840}
+	if _, err := a.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add cross currency error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := a.Sub(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub cross currency error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := a.Cmp(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp cross currency error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := (Money{math.MaxInt64, 634}).Add(Money{1, 634}); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("Add overflow error = %v, want %v", err, ErrAmountOverflow)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Limit Money `json:"limit"`
+		Floor Money `json:"floor"`
+	}
+	v.Limit.Currency = 634
+	if err := json.Unmarshal([]byte(`{"limit":10000,"floor":"000000005000"}`), &v); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	if v.Limit.Amount != 10000 || v.Limit.Currency != 634 || v.Floor.Amount != 5000 {
+		t.Errorf("Unmarshal = %+v", v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error = %v", err)
+	}
+	if got, want := string(b), `{"limit":10000,"floor":5000}`; got != want {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"limit":"12.50"}`), &v); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Unmarshal decimal error = %v, want %v", err, ErrInvalidAmount)
+	}
+}
@@ -0,0 +1,409 @@
+package softpos
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/softpos/tlv"
+)
+
+//go:embed emvtags.txt
+var emvTagData string
+
+// PreferenceType is how a preference value is encoded, as reported in
+// Preferences.Type.
+type PreferenceType string
+
+const (
+	PreferenceAmount  PreferenceType = "Amount"
+	PreferenceBoolean PreferenceType = "Boolean"
+	PreferenceNumeric PreferenceType = "Numeric"
+	PreferenceHex     PreferenceType = "Hex"
+	PreferenceString  PreferenceType = "String"
+)
+
+// EMVTag describes an EMV data element and the TMS preference names that
+// carry it. Tag is empty for TMS settings without an EMV counterpart.
+type EMVTag struct {
+	Tag     string
+	Name    string
+	Type    PreferenceType
+	Length  int
+	Aliases []string
+}
+
+var emvTags, emvTagIndex = loadEMVTags()
+
+func loadEMVTags() ([]EMVTag, map[string]int) {
+	list := []EMVTag{}
+	index := map[string]int{}
+
+	sc := bufio.NewScanner(strings.NewReader(emvTagData))
+	for sc.Scan() {
+		f := strings.Split(sc.Text(), "\t")
+		if len(f) != 5 {
+			continue
+		}
+		n, _ := strconv.Atoi(f[2])
+		t := EMVTag{Name: f[3], Type: PreferenceType(f[1]), Length: n, Aliases: strings.Split(f[4], ",")}
+		if f[0] != "-" {
+			t.Tag = f[0]
+			index[strings.ToLower(t.Tag)] = len(list)
+		}
+		for _, a := range t.Aliases {
+			index[strings.ToLower(a)] = len(list)
+		}
+		list = append(list, t)
+	}
+	return list, index
+}
+
+// LookupEMVTag finds a dictionary entry by hex tag, e.g. "9F1B", or by
+// TMS preference name, e.g. "terminalFloorLimit".
+func LookupEMVTag(tag string) (EMVTag, bool) {
+	i, ok := emvTagIndex[strings.ToLower(strings.TrimSpace(tag))]
+	if !ok {
+		return EMVTag{}, false
+	}
+	return emvTags[i], true
+}
+
+// EMVTags returns the whole dictionary.
+func EMVTags() []EMVTag {
+	return append([]EMVTag(nil), emvTags...)
+}
+
+// EMVTag returns the dictionary entry of the preference.
+func (p Preferences) EMVTag() (EMVTag, bool) {
+	return LookupEMVTag(p.Tag)
+}
+
+// Kind returns the preference type, taken from Type or, when it is not
+// set, from the EMV tag dictionary.
+func (p Preferences) Kind() PreferenceType {
+	for _, t := range []PreferenceType{PreferenceAmount, PreferenceBoolean, PreferenceNumeric, PreferenceHex, PreferenceString} {
+		if strings.EqualFold(p.Type, string(t)) {
+			return t
+		}
+	}
+	if t, ok := p.EMVTag(); ok {
+		return t.Type
+	}
+	return PreferenceType(p.Type)
+}
+
+func (p Preferences) typeError(want PreferenceType) error {
+	return fmt.Errorf("preference %s %v (%T) as %s: %w", p.Tag, p.Value, p.Value, want, ErrPreferenceType)
+}
+
+// checkKind fails unless the preference kind is one of kinds. Preferences
+// of unknown kind are decoded by value only.
+func (p Preferences) checkKind(kinds ...PreferenceType) error {
+	kind := p.Kind()
+	if kind == "" {
+		return nil
+	}
+	for _, k := range kinds {
+		if kind == k {
+			return nil
+		}
+	}
+	return p.typeError(kinds[0])
+}
+
+func (p Preferences) Bool() (bool, error) {
+	if err := p.checkKind(PreferenceBoolean); err != nil {
+		return false, err
+	}
+	switch v := p.Value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err == nil {
+			return b, nil
+		}
+	case float64:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	}
+	return false, p.typeError(PreferenceBoolean)
+}
+
+// Int decodes a numeric value. EMV numeric strings such as "0634" are
+// read as decimal. Amounts can be read as numbers too.
+func (p Preferences) Int() (int64, error) {
+	if err := p.checkKind(PreferenceNumeric, PreferenceAmount); err != nil {
+		return 0, err
+	}
+	switch v := p.Value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, p.typeError(PreferenceNumeric)
+}
+
+// Amount decodes an amount in minor units of the currency. Numbers and
+// EMV n12 strings are minor units; strings with a decimal point are
+// parsed using the currency decimal places.
+func (p Preferences) Amount(currency int) (Money, error) {
+	if err := p.checkKind(PreferenceAmount, PreferenceNumeric); err != nil {
+		return Money{}, err
+	}
+	if s, ok := p.Value.(string); ok && strings.Contains(s, ".") {
+		amount, err := parseMinor(s, DecimalPlaces(currency))
+		if err != nil {
+			return Money{}, fmt.Errorf("preference %s: %w", p.Tag, err)
+		}
+		return Money{Amount: amount, Currency: currency}, nil
+	}
+	n, err := p.Int()
+	if err != nil {
+		return Money{}, p.typeError(PreferenceAmount)
+	}
+	return Money{Amount: n, Currency: currency}, nil
+}
+
+// Bytes decodes a hex encoded value such as a capability bitmap.
+func (p Preferences) Bytes() ([]byte, error) {
+	if err := p.checkKind(PreferenceHex); err != nil {
+		return nil, err
+	}
+	if s, ok := p.Value.(string); ok {
+		if b, err := hex.DecodeString(strings.TrimSpace(s)); err == nil {
+			return b, nil
+		}
+	}
+	return nil, p.typeError(PreferenceHex)
+}
+
+func (p Preferences) Text() (string, error) {
+	if err := p.checkKind(PreferenceString); err != nil {
+		return "", err
+	}
+	switch v := p.Value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	}
+	return "", p.typeError(PreferenceString)
+}
+
+// PreferenceList is a list of terminal preferences with typed accessors.
+type PreferenceList []Preferences
+
+// Find returns the preference by hex tag or name for a payment system. A
+// preference without a payment system applies to all of them and is used
+// when there is no specific one.
+func (l PreferenceList) Find(tag, paymentSystem string) (Preferences, bool) {
+	want, known := LookupEMVTag(tag)
+	match := func(p Preferences) bool {
+		if strings.EqualFold(p.Tag, tag) {
+			return true
+		}
+		t, ok := p.EMVTag()
+		return known && ok && t.Name == want.Name
+	}
+
+	var generic *Preferences
+	for i, p := range l {
+		if !match(p) {
+			continue
+		}
+		if strings.EqualFold(p.PaymentSystem, paymentSystem) {
+			return p, true
+		}
+		if p.PaymentSystem == "" && generic == nil {
+			generic = &l[i]
+		}
+	}
+	if generic != nil {
+		return *generic, true
+	}
+	return Preferences{}, false
+}
+
+// amount reads an amount preference in the 5F2A currency or, when the list
+// has none, in the fallback currency. It fails when neither is known.
+func (l PreferenceList) amount(tag, paymentSystem string, fallback int) (Money, error) {
+	p, ok := l.Find(tag, paymentSystem)
+	if !ok {
+		return Money{}, fmt.Errorf("%s for %q: %w", tag, paymentSystem, ErrPreferenceNotFound)
+	}
+	currency := l.currency()
+	if currency == 0 {
+		currency = fallback
+	}
+	if currency == 0 {
+		return Money{}, fmt.Errorf("%s for %q: no 5F2A currency: %w", tag, paymentSystem, ErrPreferenceNotFound)
+	}
+	return p.Amount(currency)
+}
+
+// currency returns the transaction currency preference, if any.
+func (l PreferenceList) currency() int {
+	if p, ok := l.Find("5F2A", ""); ok {
+		if n, err := p.Int(); err == nil {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// ContactlessLimit returns the reader contactless transaction limit
+// (DF8124). The currency is taken from the 5F2A preference and the limits
+// fail without it; use TemrinalDetails.ContactlessLimit to default it to
+// the terminal currency.
+func (l PreferenceList) ContactlessLimit(paymentSystem string) (Money, error) {
+	return l.amount("DF8124", paymentSystem, 0)
+}
+
+// ContactlessFloorLimit returns the reader contactless floor limit (DF8123).
+func (l PreferenceList) ContactlessFloorLimit(paymentSystem string) (Money, error) {
+	return l.amount("DF8123", paymentSystem, 0)
+}
+
+// CVMRequiredLimit returns the reader CVM required limit (DF8126).
+func (l PreferenceList) CVMRequiredLimit(paymentSystem string) (Money, error) {
+	return l.amount("DF8126", paymentSystem, 0)
+}
+
+// FloorLimit returns the terminal floor limit (9F1B).
+func (l PreferenceList) FloorLimit(paymentSystem string) (Money, error) {
+	return l.amount("9F1B", paymentSystem, 0)
+}
+
+// TerminalCapabilities returns the terminal capabilities bitmap (9F33).
+func (l PreferenceList) TerminalCapabilities(paymentSystem string) ([]byte, error) {
+	p, ok := l.Find("9F33", paymentSystem)
+	if !ok {
+		return nil, fmt.Errorf("9F33 for %q: %w", paymentSystem, ErrPreferenceNotFound)
+	}
+	return p.Bytes()
+}
+
+// ContactlessLimit is PreferenceList.ContactlessLimit in the terminal
+// currency.
+func (t *TemrinalDetails) ContactlessLimit(paymentSystem string) (Money, error) {
+	return t.Preferences.amount("DF8124", paymentSystem, t.terminalCurrency())
+}
+
+func (t *TemrinalDetails) terminalCurrency() int {
+	if t.TerminalCurrency != 0 {
+		return t.TerminalCurrency
+	}
+	return t.Currency
+}
+
+// TLV decodes a hex preference carrying BER-TLV encoded configuration.
+func (p Preferences) TLV() (tlv.List, error) {
+	b, err := p.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	list, err := tlv.Decode(b, tlv.Lenient)
+	if err != nil {
+		return nil, fmt.Errorf("preference %s: %w", p.Tag, err)
+	}
+	return list, nil
+}
+
+// DataObject encodes the preference as an EMV data object using the tag
+// dictionary. Amounts of 6 bytes and numerics are BCD, shorter amounts
+// such as the floor limit are binary.
+func (p Preferences) DataObject() (tlv.TLV, error) {
+	t, ok := p.EMVTag()
+	if !ok || t.Tag == "" {
+		return tlv.TLV{}, fmt.Errorf("preference %s has no EMV tag: %w", p.Tag, ErrPreferenceType)
+	}
+	tag, err := tlv.ParseTag(t.Tag)
+	if err != nil {
+		return tlv.TLV{}, err
+	}
+
+	var value []byte
+	switch t.Type {
+	case PreferenceAmount, PreferenceNumeric:
+		var n int64
+		if t.Type == PreferenceAmount {
+			m, err := p.Amount(0)
+			if err != nil {
+				return tlv.TLV{}, err
+			}
+			n = m.Amount
+		} else if n, err = p.Int(); err != nil {
+			return tlv.TLV{}, err
+		}
+		if n < 0 {
+			return tlv.TLV{}, p.typeError(t.Type)
+		}
+		if t.Type == PreferenceAmount && t.Length != 6 {
+			value = make([]byte, t.Length)
+			for i := len(value) - 1; i >= 0; i-- {
+				value[i] = byte(n)
+				n >>= 8
+			}
+			if n != 0 {
+				return tlv.TLV{}, p.typeError(t.Type)
+			}
+			break
+		}
+		s := fmt.Sprintf("%0*d", t.Length*2, n)
+		if len(s) > t.Length*2 {
+			return tlv.TLV{}, p.typeError(t.Type)
+		}
+		value, _ = hex.DecodeString(s)
+	case PreferenceHex:
+		if value, err = p.Bytes(); err != nil {
+			return tlv.TLV{}, err
+		}
+	case PreferenceString:
+		s, err := p.Text()
+		if err != nil {
+			return tlv.TLV{}, err
+		}
+		value = []byte(s)
+	default:
+		return tlv.TLV{}, p.typeError(t.Type)
+	}
+	return tlv.New(tag, value), nil
+}
+
+// EMVData builds the data objects configured for a payment system, in
+// dictionary order. Preferences without an EMV tag are skipped.
+func (l PreferenceList) EMVData(paymentSystem string) (tlv.List, error) {
+	list := tlv.List{}
+	for _, t := range emvTags {
+		if t.Tag == "" {
+			continue
+		}
+		p, ok := l.Find(t.Tag, paymentSystem)
+		if !ok {
+			continue
+		}
+		obj, err := p.DataObject()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, obj)
+	}
+	return list, nil
+}
@@ -0,0 +1,152 @@
+package softpos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andrei-cloud/softpos/tlv"
+)
+
+const prefsJSON = `[
+	{"tag":"readerCvmRequiredLimitEnabled","value":true,"description":"CVM Required Limit Enabled","paymentSystem":"VISA","type":"Boolean"},
+	{"tag":"readerContactlessTransactionLimit","value":50000,"description":"Contactless Transaction Limit","paymentSystem":"VISA","type":"Amount"},
+	{"tag":"readerContactlessTransactionLimit","value":"000000030000","description":"Contactless Transaction Limit","paymentSystem":"","type":"Amount"},
+	{"tag":"DF8126","value":"100.00","paymentSystem":"MASTERCARD"},
+	{"tag":"9F33","value":"E0F8C8","paymentSystem":"","type":"Hex"},
+	{"tag":"terminalType","value":"22","paymentSystem":"","type":"Numeric"}
+]`
+
+func TestPreferencesAccessors(t *testing.T) {
+	prefs := PreferenceList{}
+	if err := json.Unmarshal([]byte(prefsJSON), &prefs); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+
+	if b, err := prefs[0].Bool(); err != nil || !b {
+		t.Errorf("Bool() = %v, %v", b, err)
+	}
+	if _, err := prefs[0].Int(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("Int() error = %v, want %v", err, ErrPreferenceType)
+	}
+	if n, err := prefs[5].Int(); err != nil || n != 22 {
+		t.Errorf("Int() = %v, %v", n, err)
+	}
+	if _, err := prefs[5].Bytes(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("Bytes() of Numeric error = %v, want %v", err, ErrPreferenceType)
+	}
+	if _, err := prefs[4].Text(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("Text() of Hex error = %v, want %v", err, ErrPreferenceType)
+	}
+	if prefs[3].Kind() != PreferenceAmount {
+		t.Errorf("Kind() = %v, want %v", prefs[3].Kind(), PreferenceAmount)
+	}
+
+	if _, err := prefs.ContactlessLimit("VISA"); !errors.Is(err, ErrPreferenceNotFound) {
+		t.Errorf("ContactlessLimit without 5F2A error = %v, want %v", err, ErrPreferenceNotFound)
+	}
+	prefs = append(prefs, Preferences{Tag: "5F2A", Value: "0634"})
+	limit, err := prefs.ContactlessLimit("VISA")
+	if err != nil || limit != (Money{Amount: 50000, Currency: 634}) {
+		t.Errorf("ContactlessLimit(VISA) = %v, %v", limit, err)
+	}
+	limit, err = prefs.ContactlessLimit("MASTERCARD")
+	if err != nil || limit.Amount != 30000 {
+		t.Errorf("ContactlessLimit(MASTERCARD) = %v, %v", limit, err)
+	}
+	cvm, err := prefs.CVMRequiredLimit("MASTERCARD")
+	if err != nil || cvm.Amount != 10000 {
+		t.Errorf("CVMRequiredLimit(MASTERCARD) = %v, %v", cvm, err)
+	}
+	if _, err := prefs.FloorLimit("VISA"); !errors.Is(err, ErrPreferenceNotFound) {
+		t.Errorf("FloorLimit error = %v, want %v", err, ErrPreferenceNotFound)
+	}
+
+	caps, err := prefs.TerminalCapabilities("VISA")
+	if err != nil || len(caps) != 3 || caps[0] != 0xE0 {
+		t.Errorf("TerminalCapabilities = %X, %v", caps, err)
+	}
+}
+
+func TestTerminalContactlessLimit(t *testing.T) {
+	term := TemrinalDetails{TerminalCurrency: 634}
+	if err := json.Unmarshal([]byte(prefsJSON), &term.Preferences); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+
+	limit, err := term.ContactlessLimit("VISA")
+	if err != nil {
+		t.Fatalf("ContactlessLimit error = %v", err)
+	}
+	if got, want := limit.Format(qar), "500.00 QR"; got != want {
+		t.Errorf("ContactlessLimit = %s, want %s", got, want)
+	}
+}
+
+func TestLookupEMVTag(t *testing.T) {
+	byTag, ok := LookupEMVTag("df8124")
+	if !ok || byTag.Type != PreferenceAmount || byTag.Length != 6 {
+		t.Errorf("LookupEMVTag(df8124) = %+v, %v", byTag, ok)
+	}
+	byName, ok := LookupEMVTag("readerContactlessTransactionLimit")
+	if !ok || byName.Tag != "DF8124" {
+		t.Errorf("LookupEMVTag(readerContactlessTransactionLimit) = %+v, %v", byName, ok)
+	}
+	if tag, ok := LookupEMVTag("readerCvmRequiredLimitEnabled"); !ok || tag.Tag != "" || tag.Type != PreferenceBoolean {
+		t.Errorf("LookupEMVTag(readerCvmRequiredLimitEnabled) = %+v, %v", tag, ok)
+	}
+	if _, ok := LookupEMVTag("FFFF"); ok {
+		t.Error("LookupEMVTag(FFFF) found an unknown tag")
+	}
+	if len(EMVTags()) == 0 {
+		t.Error("EMVTags() is empty")
+	}
+}
+
+func TestPreferencesEMVData(t *testing.T) {
+	prefs := PreferenceList{}
+	if err := json.Unmarshal([]byte(prefsJSON), &prefs); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	prefs = append(prefs,
+		Preferences{Tag: "terminalFloorLimit", Value: 10000.0},
+		Preferences{Tag: "5F2A", Value: "634"},
+	)
+
+	list, err := prefs.EMVData("MASTERCARD")
+	if err != nil {
+		t.Fatalf("EMVData error = %v", err)
+	}
+	b, err := tlv.Encode(list...)
+	if err != nil {
+		t.Fatalf("Encode error = %v", err)
+	}
+	want := "5F2A020634" + "9F1B0400002710" + "9F3303E0F8C8" + "9F350122" +
+		"DF8124060000000300 00" + "DF8126060000000100 00"
+	want = strings.ReplaceAll(want, " ", "")
+	if got := fmt.Sprintf("%X", b); got != want {
+		t.Errorf("EMVData = %s, want %s", got, want)
+	}
+
+	if _, err := prefs[0].DataObject(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("DataObject() of TMS only preference error = %v, want %v", err, ErrPreferenceType)
+	}
+	big := Preferences{Tag: "9F1B", Value: 1e10}
+	if _, err := big.DataObject(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("DataObject() overflow error = %v, want %v", err, ErrPreferenceType)
+	}
+}
+
+func TestPreferencesTLV(t *testing.T) {
+	p := Preferences{Tag: "DF8301", Value: "9F3303E0F8C8 0000", Type: "Hex"}
+	if _, err := p.TLV(); !errors.Is(err, ErrPreferenceType) {
+		t.Errorf("TLV() error = %v, want %v", err, ErrPreferenceType)
+	}
+	p.Value = "9F3303E0F8C80000"
+	list, err := p.TLV()
+	if err != nil || len(list) != 1 || list[0].Tag != 0x9F33 {
+		t.Errorf("TLV() = %v, %v", list, err)
+	}
+}
@@ -0,0 +1,32 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type ProfileService service
+
+// Profile is a named set of preferences shared by merchants or, for
+// terminal profiles, by terminals.
+type Profile struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Preferences PreferenceList `json:"preferences"`
+}
+
+// GetDetails returns a merchant profile.
+func (c *ProfileService) GetDetails(ctx context.Context, name string, v interface{}) (err error) {
+	path := "profiles/%s"
+	rel := url.URL{Path: fmt.Sprintf(path, name)}
+	return c.client.send(ctx, "get profile", http.MethodGet, rel, nil, v)
+}
+
+// GetTerminalProfile returns a terminal profile.
+func (c *ProfileService) GetTerminalProfile(ctx context.Context, name string, v interface{}) (err error) {
+	path := "terminalProfiles/%s"
+	rel := url.URL{Path: fmt.Sprintf(path, name)}
+	return c.client.send(ctx, "get terminal profile", http.MethodGet, rel, nil, v)
+}
@@ -0,0 +1,422 @@
+package softpos
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Discrepancy kinds.
+const (
+	DiscrepancyAmount        = "amount"
+	DiscrepancyCount         = "count"
+	DiscrepancyMissingInTMS  = "missing-in-tms"
+	DiscrepancyNotAtAcquirer = "missing-at-acquirer"
+	DiscrepancyBatchTotals   = "batch-totals"
+)
+
+// ReconKey groups reconciliation totals. Empty fields of an acquirer
+// statement record match any value.
+type ReconKey struct {
+	MerchantID string `json:"merchantId"`
+	TerminalID string `json:"terminalId"`
+	Currency   int    `json:"currency"`
+	Scheme     string `json:"scheme"`
+}
+
+func (k ReconKey) matches(o ReconKey) bool {
+	return (k.MerchantID == "" || k.MerchantID == o.MerchantID) &&
+		(k.TerminalID == "" || k.TerminalID == o.TerminalID) &&
+		(k.Currency == 0 || k.Currency == o.Currency) &&
+		(k.Scheme == "" || strings.EqualFold(k.Scheme, o.Scheme))
+}
+
+// ReconLine holds the TMS totals of one group. Gross is approved sales,
+// Net is gross less refunds; voided sales only count in VoidsCount.
+type ReconLine struct {
+	ReconKey
+	SalesCount   int   `json:"salesCount"`
+	Gross        Money `json:"gross"`
+	RefundsCount int   `json:"refundsCount"`
+	Refunds      Money `json:"refunds"`
+	VoidsCount   int   `json:"voidsCount"`
+	Net          Money `json:"net"`
+}
+
+// Discrepancy is a difference between the TMS and the acquirer statement,
+// or between a batch and its transactions.
+type Discrepancy struct {
+	ReconKey
+	Kind          string `json:"kind"`
+	BatchRef      string `json:"batchRef,omitempty"`
+	TMSCount      int    `json:"tmsCount"`
+	TMSNet        Money  `json:"tmsNet"`
+	AcquirerCount int    `json:"acquirerCount"`
+	AcquirerNet   Money  `json:"acquirerNet"`
+	Description   string `json:"description"`
+}
+
+type ReconReport struct {
+	From          time.Time     `json:"from"`
+	To            time.Time     `json:"to"`
+	GeneratedAt   time.Time     `json:"generatedAt"`
+	Lines         []ReconLine   `json:"lines"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// NewReconReport groups transactions by merchant, terminal, currency and
+// scheme.
+func NewReconReport(from, to time.Time, txns []Transaction) *ReconReport {
+	r := &ReconReport{From: from, To: to, GeneratedAt: time.Now().UTC(), Lines: []ReconLine{}, Discrepancies: []Discrepancy{}}
+	index := map[ReconKey]int{}
+	for _, t := range txns {
+		key := ReconKey{MerchantID: t.MerchantID, TerminalID: t.TerminalID, Currency: t.Currency, Scheme: strings.ToUpper(t.Scheme)}
+		i, ok := index[key]
+		if !ok {
+			i = len(r.Lines)
+			index[key] = i
+			zero := Money{Currency: t.Currency}
+			r.Lines = append(r.Lines, ReconLine{ReconKey: key, Gross: zero, Refunds: zero, Net: zero})
+		}
+		r.Lines[i].add(t)
+	}
+	sort.Slice(r.Lines, func(i, j int) bool {
+		a, b := r.Lines[i].ReconKey, r.Lines[j].ReconKey
+		if a.MerchantID != b.MerchantID {
+			return a.MerchantID < b.MerchantID
+		}
+		if a.TerminalID != b.TerminalID {
+			return a.TerminalID < b.TerminalID
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.Scheme < b.Scheme
+	})
+	return r
+}
+
+func (l *ReconLine) add(t Transaction) {
+	// Void transactions are not counted themselves; the voided sale is.
+	switch {
+	case t.Type == TransactionSale && t.Status == TransactionVoided:
+		l.VoidsCount++
+	case t.Type == TransactionSale && t.Status != TransactionDeclined:
+		l.SalesCount++
+		l.Gross.Amount += t.Amount.Amount
+	case t.Type == TransactionRefund && t.Status == TransactionApproved:
+		l.RefundsCount++
+		l.Refunds.Amount += t.Amount.Amount
+	}
+	l.Net.Amount = l.Gross.Amount - l.Refunds.Amount
+}
+
+// CheckBatches adds a discrepancy for every batch whose totals in any
+// currency differ from its transactions. txns must hold every transaction
+// of the batches, not only the ones of the report period.
+func (r *ReconReport) CheckBatches(batches []Batch, txns []Transaction) {
+	byBatch := map[string][]Transaction{}
+	for _, t := range txns {
+		byBatch[t.BatchRef] = append(byBatch[t.BatchRef], t)
+	}
+	for _, b := range batches {
+		expected := map[int]BatchTotals{}
+		currencies := []int{}
+		for _, line := range NewReconReport(time.Time{}, time.Time{}, byBatch[b.Reference]).Lines {
+			want, ok := expected[line.Currency]
+			if !ok {
+				currencies = append(currencies, line.Currency)
+			}
+			want.Currency = line.Currency
+			want.SalesCount += line.SalesCount
+			want.SalesAmount += line.Gross.Amount
+			want.RefundsCount += line.RefundsCount
+			want.RefundsAmount += line.Refunds.Amount
+			expected[line.Currency] = want
+		}
+		for _, got := range b.Totals {
+			if _, ok := expected[got.Currency]; !ok {
+				currencies = append(currencies, got.Currency)
+			}
+		}
+		sort.Ints(currencies)
+
+		for i, cur := range currencies {
+			if i > 0 && currencies[i-1] == cur {
+				continue
+			}
+			want := expected[cur]
+			got, _ := b.Total(cur)
+			if got.SalesCount == want.SalesCount && got.SalesAmount == want.SalesAmount &&
+				got.RefundsCount == want.RefundsCount && got.RefundsAmount == want.RefundsAmount {
+				continue
+			}
+			r.Discrepancies = append(r.Discrepancies, Discrepancy{
+				ReconKey:      ReconKey{MerchantID: b.MerchantID, TerminalID: b.TerminalID, Currency: cur},
+				Kind:          DiscrepancyBatchTotals,
+				BatchRef:      b.Reference,
+				TMSCount:      want.SalesCount + want.RefundsCount,
+				TMSNet:        Money{Amount: want.SalesAmount - want.RefundsAmount, Currency: cur},
+				AcquirerCount: got.SalesCount + got.RefundsCount,
+				AcquirerNet:   Money{Amount: got.SalesAmount - got.RefundsAmount, Currency: cur},
+				Description:   fmt.Sprintf("batch %d totals differ from its transactions", b.BatchNumber),
+			})
+		}
+	}
+}
+
+// Reconcile compares the report with an acquirer statement. Each record
+// is matched against the sum of the lines it covers; lines no record
+// covers are reported as missing at the acquirer.
+func (r *ReconReport) Reconcile(statement []SettlementRecord) {
+	covered := make([]bool, len(r.Lines))
+	for _, rec := range statement {
+		count, net := 0, Money{Currency: rec.Currency}
+		for i, line := range r.Lines {
+			if rec.matches(line.ReconKey) {
+				covered[i] = true
+				count += line.SalesCount + line.RefundsCount
+				net.Amount += line.Net.Amount
+			}
+		}
+
+		d := Discrepancy{ReconKey: rec.ReconKey, TMSCount: count, TMSNet: net, AcquirerCount: rec.Count, AcquirerNet: rec.Net}
+		switch {
+		case count == 0 && net.Amount == 0 && (rec.Count != 0 || rec.Net.Amount != 0):
+			d.Kind = DiscrepancyMissingInTMS
+			d.Description = "settled by the acquirer but not found in the TMS"
+		case net.Amount != rec.Net.Amount:
+			d.Kind = DiscrepancyAmount
+			d.Description = fmt.Sprintf("net differs by %s", Money{Amount: rec.Net.Amount - net.Amount, Currency: rec.Currency})
+		case rec.Count != 0 && count != rec.Count:
+			d.Kind = DiscrepancyCount
+			d.Description = fmt.Sprintf("count differs by %d", rec.Count-count)
+		default:
+			continue
+		}
+		r.Discrepancies = append(r.Discrepancies, d)
+	}
+
+	for i, line := range r.Lines {
+		if covered[i] || line.SalesCount+line.RefundsCount == 0 {
+			continue
+		}
+		r.Discrepancies = append(r.Discrepancies, Discrepancy{
+			ReconKey:    line.ReconKey,
+			Kind:        DiscrepancyNotAtAcquirer,
+			TMSCount:    line.SalesCount + line.RefundsCount,
+			TMSNet:      line.Net,
+			AcquirerNet: Money{Currency: line.Currency},
+			Description: "in the TMS but not on the acquirer statement",
+		})
+	}
+}
+
+// WriteJSON writes the whole report with amounts in minor units.
+func (r *ReconReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the totals, one line per group, with decimal amounts.
+func (r *ReconReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"merchant_id", "terminal_id", "currency", "scheme", "sales_count", "gross", "refunds_count", "refunds", "voids_count", "net"})
+	for _, l := range r.Lines {
+		places := DecimalPlaces(l.Currency)
+		cw.Write([]string{
+			l.MerchantID, l.TerminalID, fmt.Sprintf("%03d", l.Currency), l.Scheme,
+			strconv.Itoa(l.SalesCount), l.Gross.Decimal(places),
+			strconv.Itoa(l.RefundsCount), l.Refunds.Decimal(places),
+			strconv.Itoa(l.VoidsCount), l.Net.Decimal(places),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteDiscrepanciesCSV writes the discrepancies with decimal amounts.
+func (r *ReconReport) WriteDiscrepanciesCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kind", "merchant_id", "terminal_id", "currency", "scheme", "batch_ref", "tms_count", "tms_net", "acquirer_count", "acquirer_net", "description"})
+	for _, d := range r.Discrepancies {
+		places := DecimalPlaces(d.Currency)
+		currency := ""
+		if d.Currency != 0 {
+			currency = fmt.Sprintf("%03d", d.Currency)
+		}
+		cw.Write([]string{
+			d.Kind, d.MerchantID, d.TerminalID, currency, d.Scheme, d.BatchRef,
+			strconv.Itoa(d.TMSCount), d.TMSNet.Decimal(places),
+			strconv.Itoa(d.AcquirerCount), d.AcquirerNet.Decimal(places),
+			d.Description,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SettlementRecord is a line of an acquirer settlement statement.
+type SettlementRecord struct {
+	ReconKey
+	Count int
+	Net   Money
+}
+
+// SettlementLayout describes the columns of an acquirer settlement CSV.
+// Column indexes start at 0; -1 marks a column the file does not have.
+// Amounts are decimal in the record currency unless MinorUnits is set.
+type SettlementLayout struct {
+	Comma      rune
+	HeaderRows int
+	MerchantID int
+	TerminalID int
+	Currency   int
+	Scheme     int
+	Count      int
+	Amount     int
+	MinorUnits bool
+}
+
+// DefaultSettlementLayout reads
+// merchant_id,terminal_id,currency,scheme,count,net with one header row.
+var DefaultSettlementLayout = SettlementLayout{
+	Comma:      ',',
+	HeaderRows: 1,
+	MerchantID: 0,
+	TerminalID: 1,
+	Currency:   2,
+	Scheme:     3,
+	Count:      4,
+	Amount:     5,
+}
+
+// ReadSettlementFile parses an acquirer settlement statement. Currencies
+// must be ISO 4217 numeric codes.
+func ReadSettlementFile(r io.Reader, layout SettlementLayout) ([]SettlementRecord, error) {
+	if layout.Amount < 0 || layout.Currency < 0 {
+		return nil, fmt.Errorf("settlement layout needs amount and currency columns: %w", ErrIncorrect)
+	}
+	cr := csv.NewReader(r)
+	if layout.Comma != 0 {
+		cr.Comma = layout.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	records := []SettlementRecord{}
+	for row := 1; ; row++ {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row <= layout.HeaderRows || len(fields) == 1 && fields[0] == "" {
+			continue
+		}
+
+		col := func(i int) string {
+			if i < 0 || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+		rowErr := func(field, value string) error {
+			return fmt.Errorf("settlement row %d: %s %q: %w", row, field, value, ErrIncorrect)
+		}
+
+		rec := SettlementRecord{ReconKey: ReconKey{
+			MerchantID: col(layout.MerchantID),
+			TerminalID: col(layout.TerminalID),
+			Scheme:     strings.ToUpper(col(layout.Scheme)),
+		}}
+		if rec.Currency, err = strconv.Atoi(col(layout.Currency)); err != nil || !IsCurrencyCode(rec.Currency) {
+			return nil, rowErr("currency", col(layout.Currency))
+		}
+		if s := col(layout.Count); s != "" {
+			if rec.Count, err = strconv.Atoi(s); err != nil {
+				return nil, rowErr("count", s)
+			}
+		}
+
+		amount := col(layout.Amount)
+		rec.Net.Currency = rec.Currency
+		if layout.MinorUnits {
+			rec.Net.Amount, err = strconv.ParseInt(amount, 10, 64)
+		} else {
+			rec.Net.Amount, err = parseMinor(amount, DecimalPlaces(rec.Currency))
+		}
+		if err != nil {
+			return nil, rowErr("amount", amount)
+		}
+		records = append(records, rec)
+	}
+}
+
+// Reconciler pulls the transactions and batches of a period across all
+// merchants.
+type Reconciler struct {
+	client *Client
+}
+
+func NewReconciler(client *Client) *Reconciler {
+	return &Reconciler{client: client}
+}
+
+// Run builds the report for [from, to) and checks batches closed in the
+// period against their transactions. Pass an acquirer statement to
+// ReconReport.Reconcile to add statement discrepancies.
+func (r *Reconciler) Run(ctx context.Context, from, to time.Time) (*ReconReport, error) {
+	merchants, err := r.client.MerchantService.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	txns := []Transaction{}
+	batches := []Batch{}
+	batchTxns := []Transaction{}
+	for _, m := range merchants {
+		list, err := r.client.TransactionService.GetAll(ctx, &TransactionFilter{MerchantID: m.MerchantID, From: from, To: to})
+		if err != nil {
+			return nil, fmt.Errorf("merchant %s: %w", m.MerchantID, err)
+		}
+		txns = append(txns, list...)
+
+		terminals := []TemrinalDetails{}
+		if err := r.client.TerminalService.GetListByMerchnat(ctx, m.MerchantID, &terminals); err != nil {
+			return nil, fmt.Errorf("merchant %s: %w", m.MerchantID, err)
+		}
+		for _, t := range terminals {
+			list := []Batch{}
+			if err := r.client.BatchService.GetListByTerminal(ctx, m.MerchantID, t.TerminalID, &list); err != nil {
+				return nil, fmt.Errorf("terminal %s: %w", t.TerminalID, err)
+			}
+			for _, b := range list {
+				if !b.IsClosed() || b.Closed.Before(from) || !b.Closed.Before(to) {
+					continue
+				}
+				// A batch can span the period boundary, so its totals are
+				// checked against all of its transactions.
+				own, err := r.client.TransactionService.GetAll(ctx, &TransactionFilter{BatchRef: b.Reference})
+				if err != nil {
+					return nil, fmt.Errorf("batch %s: %w", b.Reference, err)
+				}
+				batches = append(batches, b)
+				batchTxns = append(batchTxns, own...)
+			}
+		}
+	}
+
+	report := NewReconReport(from, to, txns)
+	report.CheckBatches(batches, batchTxns)
+	return report, nil
+}
@@ -0,0 +1,177 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func reconTransactions() []Transaction {
+	txn := func(tid, scheme, typ, status, batch string, amount int64) Transaction {
+		return Transaction{MerchantID: "600086900", TerminalID: tid, BatchRef: batch, Type: typ, Status: status,
+			Scheme: scheme, Currency: 634, Amount: Money{Amount: amount, Currency: 634}}
+	}
+	return []Transaction{
+		txn("66770050", "VISA", TransactionSale, TransactionApproved, "b-1", 25000),
+		txn("66770050", "visa", TransactionSale, TransactionPartiallyRefunded, "b-1", 10000),
+		txn("66770050", "VISA", TransactionRefund, TransactionApproved, "b-1", 4000),
+		txn("66770050", "VISA", TransactionSale, TransactionVoided, "b-1", 999),
+		txn("66770050", "VISA", TransactionVoid, TransactionApproved, "b-1", 999),
+		txn("66770050", "VISA", TransactionSale, TransactionDeclined, "b-1", 5000),
+		txn("66770050", "MASTERCARD", TransactionSale, TransactionApproved, "b-1", 7050),
+		txn("66770051", "VISA", TransactionSale, TransactionApproved, "b-2", 1000),
+	}
+}
+
+func TestReconReportGrouping(t *testing.T) {
+	day := time.Date(2022, 3, 28, 0, 0, 0, 0, time.UTC)
+	r := NewReconReport(day, day.Add(24*time.Hour), reconTransactions())
+	if len(r.Lines) != 3 {
+		t.Fatalf("Lines = %+v", r.Lines)
+	}
+
+	visa := r.Lines[1]
+	if visa.Scheme != "VISA" || visa.SalesCount != 2 || visa.Gross.Amount != 35000 ||
+		visa.RefundsCount != 1 || visa.Refunds.Amount != 4000 || visa.VoidsCount != 1 || visa.Net.Amount != 31000 {
+		t.Errorf("VISA line = %+v", visa)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteCSV(buf); err != nil {
+		t.Fatalf("WriteCSV error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "600086900,66770050,634,VISA,2,350.00,1,40.00,1,310.00\n") {
+		t.Errorf("WriteCSV = \n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatalf("WriteJSON error = %v", err)
+	}
+	decoded := struct {
+		Lines []struct {
+			Net int64 `json:"net"`
+		} `json:"lines"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Lines[1].Net != 31000 {
+		t.Errorf("WriteJSON = %s, %v", buf.String(), err)
+	}
+}
+
+func TestReconReportReconcile(t *testing.T) {
+	statement := `MID;TID;CCY;BRAND;COUNT;NET
+600086900;66770050;634;VISA;3;310.00
+600086900;66770050;634;MASTERCARD;1;70.00
+600086900;99999999;634;VISA;1;5.00
+`
+	layout := DefaultSettlementLayout
+	layout.Comma = ';'
+	records, err := ReadSettlementFile(strings.NewReader(statement), layout)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("ReadSettlementFile = %+v, %v", records, err)
+	}
+
+	r := NewReconReport(time.Time{}, time.Time{}, reconTransactions())
+	r.Reconcile(records)
+
+	got := map[string]string{}
+	for _, d := range r.Discrepancies {
+		got[d.TerminalID+"/"+d.Scheme] = d.Kind
+	}
+	want := map[string]string{
+		"66770050/MASTERCARD": DiscrepancyAmount,
+		"99999999/VISA":       DiscrepancyMissingInTMS,
+		"66770051/VISA":       DiscrepancyNotAtAcquirer,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("discrepancies = %v, want %v", got, want)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteDiscrepanciesCSV(buf); err != nil || !strings.Contains(buf.String(), "amount,600086900,66770050,634,MASTERCARD,,1,70.50,1,70.00,net differs by -0.50 634") {
+		t.Errorf("WriteDiscrepanciesCSV = \n%s, %v", buf.String(), err)
+	}
+}
+
+func TestReadSettlementFileLayout(t *testing.T) {
+	layout := SettlementLayout{HeaderRows: 0, MerchantID: 1, TerminalID: -1, Currency: 0, Scheme: -1, Count: -1, Amount: 2, MinorUnits: true}
+	records, err := ReadSettlementFile(strings.NewReader("634,600086900,38050\n"), layout)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadSettlementFile = %+v, %v", records, err)
+	}
+	if rec := records[0]; rec.MerchantID != "600086900" || rec.TerminalID != "" || rec.Net.Amount != 38050 {
+		t.Errorf("record = %+v", rec)
+	}
+
+	r := NewReconReport(time.Time{}, time.Time{}, reconTransactions()[:7])
+	r.Reconcile(records)
+	if len(r.Discrepancies) != 0 {
+		t.Errorf("merchant level discrepancies = %+v", r.Discrepancies)
+	}
+
+	if _, err := ReadSettlementFile(strings.NewReader("999,600086900,1\n"), layout); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("unknown currency error = %v, want %v", err, ErrIncorrect)
+	}
+	layout.MinorUnits = false
+	if _, err := ReadSettlementFile(strings.NewReader("634,600086900,1.001\n"), layout); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("too many decimals error = %v, want %v", err, ErrIncorrect)
+	}
+}
+
+func TestReconcilerMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/merchants", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"index":2,"totalPages":2,"items":[{"merchantId":"999700163"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"index":1,"totalPages":2,"items":[{"merchantId":"600086900"}]}`)
+	})
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("batchRef") == "b-1":
+			fmt.Fprint(w, `{"totalPages":1,"items":[
+				{"merchantId":"600086900","terminalId":"66770050","batchRef":"b-1","type":"Sale","status":"Approved","amount":20000,"currency":634,"scheme":"VISA"},
+				{"merchantId":"600086900","terminalId":"66770050","batchRef":"b-1","type":"Sale","status":"Approved","amount":25000,"currency":634,"scheme":"VISA"}]}`)
+		case q.Get("merchantId") == "999700163":
+			fmt.Fprint(w, `{"totalPages":1,"items":[]}`)
+		case q.Get("merchantId") == "600086900" && q.Get("from") != "":
+			fmt.Fprint(w, `{"totalPages":1,"items":[
+				{"merchantId":"600086900","terminalId":"66770050","batchRef":"b-1","type":"Sale","status":"Approved","amount":25000,"currency":634,"scheme":"VISA"}]}`)
+		default:
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+	})
+	mux.HandleFunc("/merchants/600086900/terminals", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"terminalId":"66770050"}]`)
+	})
+	mux.HandleFunc("/merchants/999700163/terminals", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/merchants/600086900/terminals/66770050/batches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"reference":"b-1","batchNumber":1,"merchantId":"600086900","terminalId":"66770050","state":"Closed","closed":"2022-03-28T23:00:00Z",
+			"totals":[{"currency":634,"salesCount":2,"salesAmount":45000},{"currency":840,"salesCount":1,"salesAmount":100}]},
+			{"reference":"b-0","state":"Closed","closed":"2022-03-27T23:00:00Z","totals":[{"currency":634,"salesCount":9}]}]`)
+	})
+
+	day := time.Date(2022, 3, 28, 0, 0, 0, 0, time.UTC)
+	r, err := NewReconciler(c).Run(context.Background(), day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if len(r.Lines) != 1 || r.Lines[0].Net.Amount != 25000 {
+		t.Errorf("Lines = %+v", r.Lines)
+	}
+	if len(r.Discrepancies) != 1 || r.Discrepancies[0].Kind != DiscrepancyBatchTotals || r.Discrepancies[0].BatchRef != "b-1" || r.Discrepancies[0].Currency != 840 {
+		t.Errorf("Discrepancies = %+v", r.Discrepancies)
+	}
+}
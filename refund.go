@@ -0,0 +1,170 @@
+package softpos
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// IdempotencyHeader carries the key that lets the TMS recognise a retried
+// void or refund.
+const IdempotencyHeader = "Idempotency-Key"
+
+// businessErrors maps TMS rejection reasons to package errors.
+var businessErrors = map[string]error{
+	"AlreadySettled":        ErrAlreadySettled,
+	"AlreadyVoided":         ErrAlreadyVoided,
+	"AmountExceedsOriginal": ErrExceedsOriginal,
+	"NotReversible":         ErrNotReversible,
+	"IdempotencyKeyReused":  ErrIdempotencyKeyReused,
+}
+
+// BusinessError is a request the TMS rejected by its rules rather than for
+// its format, e.g. a void of a settled transaction. It unwraps to one of
+// the business errors and, for a 409 response, also matches ErrConflict.
+type BusinessError struct {
+	Reason string
+	Status int
+	Err    error
+}
+
+func (e *BusinessError) Error() string {
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *BusinessError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BusinessError) Is(target error) bool {
+	return target == ErrConflict && e.Status == http.StatusConflict
+}
+
+// VoidRequest cancels an unsettled sale. IdempotencyKey is generated when
+// empty and kept in the request, so retrying with the same request is
+// safe.
+type VoidRequest struct {
+	Reason         string `json:"reason,omitempty"`
+	IdempotencyKey string `json:"-"`
+}
+
+// RefundRequest returns money of a sale to the card. A zero Amount refunds
+// everything not refunded yet. IdempotencyKey works as in VoidRequest.
+type RefundRequest struct {
+	Amount         Money  `json:"amount"`
+	Currency       int    `json:"currency"`
+	Reason         string `json:"reason,omitempty"`
+	IdempotencyKey string `json:"-"`
+}
+
+// ParseRefundAmount parses a decimal amount such as "12.50" in the
+// currency of the transaction, rejecting more decimals than the currency
+// has. currency is the transaction currency from CurrencyService; when it
+// is nil the decimal places come from the DecimalPlaces fallback table.
+func ParseRefundAmount(txn *Transaction, currency *Currency, s string) (Money, error) {
+	places := DecimalPlaces(txn.Currency)
+	if currency != nil {
+		if currency.Code != txn.Currency {
+			return Money{}, fmt.Errorf("%03d for a %03d transaction: %w", currency.Code, txn.Currency, ErrCurrencyMismatch)
+		}
+		places = currency.DecimalPlaces
+	}
+	amount, err := parseMinor(s, places)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: txn.Currency}, nil
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0F | 0x40
+	b[8] = b[8]&0x3F | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func checkReversible(txn *Transaction) error {
+	switch {
+	case txn == nil:
+		return errors.New("nil transaction")
+	case txn.Status == TransactionVoided:
+		return fmt.Errorf("transaction %s: %w", txn.Reference, ErrAlreadyVoided)
+	case txn.Type != TransactionSale:
+		return fmt.Errorf("%s transaction %s: %w", txn.Type, txn.Reference, ErrNotReversible)
+	case txn.Status != TransactionApproved && txn.Status != TransactionPartiallyRefunded && txn.Status != TransactionRefunded:
+		return fmt.Errorf("%s transaction %s: %w", txn.Status, txn.Reference, ErrNotReversible)
+	}
+	return nil
+}
+
+// Void cancels an approved sale that is not settled yet. The resulting
+// void transaction is decoded into v.
+func (c *TransactionService) Void(ctx context.Context, txn *Transaction, data *VoidRequest, v interface{}) (err error) {
+	if err := checkReversible(txn); err != nil {
+		return fmt.Errorf("void: %w", err)
+	}
+	if txn.Status != TransactionApproved {
+		return fmt.Errorf("void: %s transaction %s: %w", txn.Status, txn.Reference, ErrNotReversible)
+	}
+	if txn.Settled {
+		return fmt.Errorf("void: transaction %s: %w", txn.Reference, ErrAlreadySettled)
+	}
+	if data == nil {
+		data = &VoidRequest{}
+	}
+	if data.IdempotencyKey == "" {
+		data.IdempotencyKey = newIdempotencyKey()
+	}
+
+	path := "transactions/%s/void"
+	rel := url.URL{Path: fmt.Sprintf(path, txn.Reference)}
+	return c.mutate(ctx, "void transaction", rel, data, data.IdempotencyKey, v)
+}
+
+// Refund refunds a sale in full or in part. The amount must be in the
+// transaction currency and no more than Transaction.Refundable. The
+// resulting refund transaction is decoded into v.
+func (c *TransactionService) Refund(ctx context.Context, txn *Transaction, data *RefundRequest, v interface{}) (err error) {
+	if err := checkReversible(txn); err != nil {
+		return fmt.Errorf("refund: %w", err)
+	}
+	if data == nil {
+		data = &RefundRequest{}
+	}
+
+	refundable := txn.Refundable()
+	if data.Amount.IsZero() {
+		data.Amount = refundable
+	}
+	switch {
+	case data.Amount.Currency != txn.Currency:
+		return fmt.Errorf("refund: %03d for %03d transaction: %w", data.Amount.Currency, txn.Currency, ErrCurrencyMismatch)
+	case data.Amount.Amount <= 0 && refundable.Amount > 0:
+		return fmt.Errorf("refund: %v: %w", data.Amount, ErrInvalidAmount)
+	case data.Amount.Amount <= 0 || data.Amount.Amount > refundable.Amount:
+		return fmt.Errorf("refund: %v of %v refundable: %w", data.Amount, refundable, ErrExceedsOriginal)
+	}
+	data.Currency = txn.Currency
+	if data.IdempotencyKey == "" {
+		data.IdempotencyKey = newIdempotencyKey()
+	}
+
+	path := "transactions/%s/refund"
+	rel := url.URL{Path: fmt.Sprintf(path, txn.Reference)}
+	return c.mutate(ctx, "refund transaction", rel, data, data.IdempotencyKey, v)
+}
+
+func (c *TransactionService) mutate(ctx context.Context, op string, rel url.URL, body interface{}, key string, v interface{}) error {
+	req, err := c.client.newRequestCtx(ctx, http.MethodPost, rel, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(IdempotencyHeader, key)
+	return c.client.do(req, op, v)
+}
@@ -0,0 +1,153 @@
+package softpos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func sale() *Transaction {
+	return &Transaction{
+		Reference: "t-1",
+		Type:      TransactionSale,
+		Status:    TransactionApproved,
+		Currency:  634,
+		Amount:    Money{Amount: 25000, Currency: 634},
+	}
+}
+
+func TestParseRefundAmount(t *testing.T) {
+	txn := sale()
+	if m, err := ParseRefundAmount(txn, nil, "12.5"); err != nil || m != (Money{Amount: 1250, Currency: 634}) {
+		t.Errorf("ParseRefundAmount(12.5) = %v, %v", m, err)
+	}
+	if _, err := ParseRefundAmount(txn, nil, "12.505"); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("ParseRefundAmount(12.505) error = %v, want %v", err, ErrInvalidAmount)
+	}
+	txn.Currency = 414 // KWD has 3 decimals
+	if m, err := ParseRefundAmount(txn, nil, "12.505"); err != nil || m.Amount != 12505 {
+		t.Errorf("ParseRefundAmount(12.505 KWD) = %v, %v", m, err)
+	}
+
+	txn.Currency = 634
+	cur := &Currency{Name: "QAR", Code: 634, DecimalPlaces: 3}
+	if m, err := ParseRefundAmount(txn, cur, "12.505"); err != nil || m.Amount != 12505 {
+		t.Errorf("ParseRefundAmount(12.505, TMS currency) = %v, %v", m, err)
+	}
+	if _, err := ParseRefundAmount(txn, &Currency{Code: 840, DecimalPlaces: 2}, "12.50"); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("ParseRefundAmount(USD) error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+}
+
+func TestRefundValidation(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	})
+
+	ctx := context.Background()
+	settled := sale()
+	settled.Settled = true
+	voided := sale()
+	voided.Status = TransactionVoided
+	refund := sale()
+	refund.Type = TransactionRefund
+	refunded := sale()
+	refunded.Status = TransactionRefunded
+	refunded.RefundedAmount = refunded.Amount
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"void settled", c.TransactionService.Void(ctx, settled, nil, nil), ErrAlreadySettled},
+		{"void voided", c.TransactionService.Void(ctx, voided, nil, nil), ErrAlreadyVoided},
+		{"void refund", c.TransactionService.Void(ctx, refund, nil, nil), ErrNotReversible},
+		{"refund refund", c.TransactionService.Refund(ctx, refund, nil, nil), ErrNotReversible},
+		{"refund too much", c.TransactionService.Refund(ctx, sale(), &RefundRequest{Amount: Money{Amount: 25001, Currency: 634}}, nil), ErrExceedsOriginal},
+		{"refund negative", c.TransactionService.Refund(ctx, sale(), &RefundRequest{Amount: Money{Amount: -1, Currency: 634}}, nil), ErrInvalidAmount},
+		{"refund currency", c.TransactionService.Refund(ctx, sale(), &RefundRequest{Amount: Money{Amount: 100, Currency: 840}}, nil), ErrCurrencyMismatch},
+		{"refund refunded", c.TransactionService.Refund(ctx, refunded, nil, nil), ErrExceedsOriginal},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s error = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+}
+
+func TestRefundMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	keys := []string{}
+	mux.HandleFunc("/transactions/t-1/refund", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		keys = append(keys, r.Header.Get(IdempotencyHeader))
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["amount"] != 5000.0 || body["currency"] != 634.0 {
+			t.Errorf("request body = %v", body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"reference":"t-9","originalReference":"t-1","type":"Refund","status":"Approved","amount":5000,"currency":634}`)
+	})
+
+	txn := sale()
+	txn.Status = TransactionPartiallyRefunded
+	txn.RefundedAmount = Money{Amount: 20000, Currency: 634}
+
+	req := &RefundRequest{}
+	got := &Transaction{}
+	if err := c.TransactionService.Refund(context.Background(), txn, req, got); err != nil {
+		t.Fatalf("Refund error = %v", err)
+	}
+	if got.OriginalReference != "t-1" || got.Amount != (Money{Amount: 5000, Currency: 634}) {
+		t.Errorf("Refund = %+v", got)
+	}
+	if err := c.TransactionService.Refund(context.Background(), txn, req, got); err != nil {
+		t.Fatalf("Refund retry error = %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] || keys[0] != req.IdempotencyKey {
+		t.Errorf("idempotency keys = %v, request key %q", keys, req.IdempotencyKey)
+	}
+}
+
+func TestVoidBusinessError(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/transactions/t-1/void", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		if r.Header.Get(IdempotencyHeader) != "k-1" {
+			t.Errorf("%s = %q", IdempotencyHeader, r.Header.Get(IdempotencyHeader))
+		}
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, `{"reason":"AlreadySettled"}`)
+	})
+	mux.HandleFunc("/transactions/t-2/void", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"reason":"SomethingElse"}`)
+	})
+
+	err := c.TransactionService.Void(context.Background(), sale(), &VoidRequest{IdempotencyKey: "k-1"}, nil)
+	var be *BusinessError
+	if !errors.As(err, &be) || be.Reason != "AlreadySettled" {
+		t.Fatalf("Void error = %v, want BusinessError", err)
+	}
+	if !errors.Is(err, ErrAlreadySettled) || !errors.Is(err, ErrConflict) {
+		t.Errorf("Void error = %v, want %v and %v", err, ErrAlreadySettled, ErrConflict)
+	}
+
+	txn := sale()
+	txn.Reference = "t-2"
+	if err := c.TransactionService.Void(context.Background(), txn, nil, nil); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Void error = %v, want %v", err, ErrUnknown)
+	}
+}
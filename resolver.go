@@ -0,0 +1,271 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// PreferenceLayer is a level of terminal configuration. Later layers
+// override earlier ones.
+type PreferenceLayer int
+
+const (
+	LayerAcquirer PreferenceLayer = iota
+	LayerMerchantProfile
+	LayerTerminalProfile
+	LayerTerminal
+)
+
+func (l PreferenceLayer) String() string {
+	switch l {
+	case LayerAcquirer:
+		return "acquirer"
+	case LayerMerchantProfile:
+		return "merchant profile"
+	case LayerTerminalProfile:
+		return "terminal profile"
+	case LayerTerminal:
+		return "terminal"
+	}
+	return fmt.Sprintf("layer %d", int(l))
+}
+
+// PreferenceOrigin is a preference as set on one layer. Source is the
+// acquirer code, profile name or terminal ID.
+type PreferenceOrigin struct {
+	Layer  PreferenceLayer
+	Source string
+	Preferences
+}
+
+func (o PreferenceOrigin) String() string {
+	return fmt.Sprintf("%s %q", o.Layer, o.Source)
+}
+
+// EffectivePreference is the value in force for a tag and payment system.
+// Overridden lists the values it shadows, highest precedence first.
+type EffectivePreference struct {
+	PreferenceOrigin
+	Overridden []PreferenceOrigin
+}
+
+// ResolvedPreferences is the merged configuration of a terminal.
+//
+// For a tag and payment system the terminal layer wins over the terminal
+// profile, then the merchant profile, then the acquirer. Within a layer a
+// value for the payment system wins over one without a payment system, so
+// a terminal-wide limit overrides an acquirer VISA limit.
+type ResolvedPreferences struct {
+	MerchantID string
+	TerminalID string
+	Currency   int
+
+	origins []PreferenceOrigin
+}
+
+// NewResolvedPreferences merges the layers of a terminal configuration.
+func NewResolvedPreferences(layers ...PreferenceOrigin) *ResolvedPreferences {
+	r := &ResolvedPreferences{origins: append([]PreferenceOrigin(nil), layers...)}
+	sort.SliceStable(r.origins, func(i, j int) bool {
+		return r.origins[i].Layer > r.origins[j].Layer
+	})
+	return r
+}
+
+// preferenceKey identifies a preference regardless of whether it is set by
+// tag or TMS name.
+func preferenceKey(tag string) string {
+	if t, ok := LookupEMVTag(tag); ok {
+		return t.Name
+	}
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Lookup returns the effective value of a preference by tag or name.
+func (r *ResolvedPreferences) Lookup(tag, paymentSystem string) (EffectivePreference, bool) {
+	key := preferenceKey(tag)
+	candidates := []PreferenceOrigin{}
+	for _, specific := range []bool{true, false} {
+		for _, o := range r.origins {
+			if preferenceKey(o.Tag) != key {
+				continue
+			}
+			if specific && paymentSystem != "" && strings.EqualFold(o.PaymentSystem, paymentSystem) ||
+				!specific && o.PaymentSystem == "" {
+				candidates = append(candidates, o)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return EffectivePreference{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Layer > candidates[j].Layer
+	})
+	return EffectivePreference{PreferenceOrigin: candidates[0], Overridden: candidates[1:]}, true
+}
+
+// Effective returns the value in force for every tag and payment system
+// set on any layer, sorted by tag and payment system.
+func (r *ResolvedPreferences) Effective() []EffectivePreference {
+	type pair struct{ key, paymentSystem string }
+	seen := map[pair]bool{}
+	list := []EffectivePreference{}
+	for _, o := range r.origins {
+		p := pair{preferenceKey(o.Tag), strings.ToUpper(o.PaymentSystem)}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if e, ok := r.Lookup(o.Tag, o.PaymentSystem); ok {
+			// A generic value can win over one for the payment system; it
+			// is listed under the payment system so each row is distinct.
+			e.PaymentSystem = o.PaymentSystem
+			list = append(list, e)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if a, b := preferenceKey(list[i].Tag), preferenceKey(list[j].Tag); a != b {
+			return a < b
+		}
+		return list[i].PaymentSystem < list[j].PaymentSystem
+	})
+	return list
+}
+
+// List returns the effective values as a PreferenceList. Entries for a
+// payment system carry the resolved value, even when it comes from a
+// generic preference, so the typed accessors such as ContactlessLimit give
+// the effective result.
+func (r *ResolvedPreferences) List() PreferenceList {
+	list := PreferenceList{}
+	for _, e := range r.Effective() {
+		list = append(list, e.Preferences)
+	}
+	return list
+}
+
+// ContactlessLimit is the effective PreferenceList.ContactlessLimit in the
+// terminal currency.
+func (r *ResolvedPreferences) ContactlessLimit(paymentSystem string) (Money, error) {
+	return r.List().amount("DF8124", paymentSystem, r.Currency)
+}
+
+// Explain describes where the effective value of a preference comes from
+// and what it overrides.
+func (r *ResolvedPreferences) Explain(tag, paymentSystem string) string {
+	e, ok := r.Lookup(tag, paymentSystem)
+	if !ok {
+		return fmt.Sprintf("%s is not set for %q on any layer", tag, paymentSystem)
+	}
+	s := fmt.Sprintf("%s = %v from %s", describeTag(e.Tag, e.PaymentSystem), e.Value, e.PreferenceOrigin)
+	for i, o := range e.Overridden {
+		if i == 0 {
+			s += ", overriding "
+		} else {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s %v from %s", describeTag(o.Tag, o.PaymentSystem), o.Value, o)
+	}
+	return s
+}
+
+func describeTag(tag, paymentSystem string) string {
+	if t, ok := LookupEMVTag(tag); ok && t.Tag != "" {
+		tag = t.Tag + " " + t.Name
+	}
+	if paymentSystem == "" {
+		return tag
+	}
+	return tag + " [" + paymentSystem + "]"
+}
+
+// WriteText renders the effective preferences with their sources.
+func (r *ResolvedPreferences) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Effective preferences of terminal %s (merchant %s)\n\n", r.TerminalID, r.MerchantID)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TAG\tPAYMENT SYSTEM\tVALUE\tSOURCE\tOVERRIDES")
+	for _, e := range r.Effective() {
+		overrides := make([]string, len(e.Overridden))
+		for i, o := range e.Overridden {
+			overrides[i] = fmt.Sprintf("%s=%v", o, o.Value)
+		}
+		ps := e.PaymentSystem
+		if ps == "" {
+			ps = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n", describeTag(e.Tag, ""), ps, e.Value, e.PreferenceOrigin, strings.Join(overrides, ", "))
+	}
+	return tw.Flush()
+}
+
+// PreferenceResolver fetches every configuration layer of a terminal.
+type PreferenceResolver struct {
+	client *Client
+}
+
+func NewPreferenceResolver(client *Client) *PreferenceResolver {
+	return &PreferenceResolver{client: client}
+}
+
+// Resolve fetches the terminal and resolves its preferences.
+func (r *PreferenceResolver) Resolve(ctx context.Context, mid, tid string) (*ResolvedPreferences, error) {
+	term := &TemrinalDetails{}
+	if err := r.client.TerminalService.GetDetailsByMerchant(ctx, mid, tid, term); err != nil {
+		return nil, err
+	}
+	return r.ResolveTerminal(ctx, term)
+}
+
+// ResolveTerminal fetches the acquirer, merchant profile and terminal
+// profile of a terminal and merges them with its own preferences. Layers
+// the terminal does not refer to are skipped.
+func (r *PreferenceResolver) ResolveTerminal(ctx context.Context, t *TemrinalDetails) (*ResolvedPreferences, error) {
+	origins := []PreferenceOrigin{}
+	add := func(layer PreferenceLayer, source string, list PreferenceList) {
+		for _, p := range list {
+			origins = append(origins, PreferenceOrigin{Layer: layer, Source: source, Preferences: p})
+		}
+	}
+
+	if code := t.Merchant.Acquirer; code != "" {
+		acq := &Acquirer{}
+		if err := r.client.AcquirerService.GetByCode(ctx, code, acq); err != nil {
+			return nil, fmt.Errorf("acquirer %s: %w", code, err)
+		}
+		add(LayerAcquirer, code, acq.Preferences)
+	}
+
+	profile := t.Merchant.Profile
+	if profile == "" {
+		profile = t.Profile
+	}
+	if profile != "" {
+		p := &Profile{}
+		if err := r.client.ProfileService.GetDetails(ctx, profile, p); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile, err)
+		}
+		add(LayerMerchantProfile, profile, p.Preferences)
+	}
+
+	if name := t.TerminalProfile; name != "" {
+		p := &Profile{}
+		if err := r.client.ProfileService.GetTerminalProfile(ctx, name, p); err != nil {
+			return nil, fmt.Errorf("terminal profile %s: %w", name, err)
+		}
+		add(LayerTerminalProfile, name, p.Preferences)
+	}
+
+	add(LayerTerminal, t.TerminalID, t.Preferences)
+
+	res := NewResolvedPreferences(origins...)
+	res.MerchantID = t.Merchant.MerchantID
+	res.TerminalID = t.TerminalID
+	res.Currency = t.terminalCurrency()
+	return res, nil
+}
@@ -0,0 +1,152 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResolvedPreferencesPrecedence(t *testing.T) {
+	res := NewResolvedPreferences(
+		PreferenceOrigin{LayerTerminal, "66770050", Preferences{Tag: "DF8124", Value: 10000.0}},
+		PreferenceOrigin{LayerAcquirer, "cbq", Preferences{Tag: "readerContactlessTransactionLimit", Value: 50000.0, PaymentSystem: "VISA"}},
+		PreferenceOrigin{LayerAcquirer, "cbq", Preferences{Tag: "readerContactlessTransactionLimit", Value: 30000.0}},
+		PreferenceOrigin{LayerMerchantProfile, "retail", Preferences{Tag: "DF8126", Value: 20000.0, PaymentSystem: "MASTERCARD"}},
+		PreferenceOrigin{LayerTerminalProfile, "kiosk", Preferences{Tag: "DF8126", Value: 15000.0}},
+		PreferenceOrigin{LayerTerminalProfile, "kiosk", Preferences{Tag: "DF8126", Value: 25000.0, PaymentSystem: "MASTERCARD"}},
+	)
+	res.Currency = 634
+
+	e, ok := res.Lookup("DF8124", "VISA")
+	if !ok || e.Layer != LayerTerminal || e.Value != 10000.0 || len(e.Overridden) != 2 {
+		t.Fatalf("Lookup(DF8124, VISA) = %+v, %v", e, ok)
+	}
+	if e.Overridden[0].Layer != LayerAcquirer || e.Overridden[0].PaymentSystem != "VISA" {
+		t.Errorf("Overridden[0] = %+v, want acquirer VISA", e.Overridden[0])
+	}
+
+	e, _ = res.Lookup("readerCvmRequiredLimit", "MASTERCARD")
+	if e.Source != "kiosk" || e.Value != 25000.0 {
+		t.Errorf("Lookup(DF8126, MASTERCARD) = %+v", e)
+	}
+	e, _ = res.Lookup("DF8126", "VISA")
+	if e.Source != "kiosk" || e.Value != 15000.0 {
+		t.Errorf("Lookup(DF8126, VISA) = %+v", e)
+	}
+	if _, ok := res.Lookup("9F1B", "VISA"); ok {
+		t.Error("Lookup(9F1B) found")
+	}
+
+	limit, err := res.ContactlessLimit("VISA")
+	if err != nil || limit != (Money{Amount: 10000, Currency: 634}) {
+		t.Errorf("ContactlessLimit(VISA) = %v, %v", limit, err)
+	}
+	limit, err = append(res.List(), Preferences{Tag: "5F2A", Value: 634.0}).CVMRequiredLimit("MASTERCARD")
+	if err != nil || limit != (Money{Amount: 25000, Currency: 634}) {
+		t.Errorf("CVMRequiredLimit(MASTERCARD) = %v, %v", limit, err)
+	}
+
+	if n := len(res.Effective()); n != 4 {
+		t.Errorf("Effective() has %d entries, want 4", n)
+	}
+
+	why := res.Explain("DF8124", "VISA")
+	for _, want := range []string{`= 10000 from terminal "66770050"`, `50000 from acquirer "cbq"`, `30000 from acquirer "cbq"`} {
+		if !strings.Contains(why, want) {
+			t.Errorf("Explain() = %q, missing %q", why, want)
+		}
+	}
+}
+
+func TestResolvedPreferencesGenericOverride(t *testing.T) {
+	res := NewResolvedPreferences(
+		PreferenceOrigin{LayerTerminal, "66770050", Preferences{Tag: "DF8124", Value: 10000.0}},
+		PreferenceOrigin{LayerAcquirer, "cbq", Preferences{Tag: "DF8124", Value: 50000.0, PaymentSystem: "VISA"}},
+	)
+
+	list := res.Effective()
+	if len(list) != 2 || list[0].PaymentSystem != "" || list[1].PaymentSystem != "VISA" {
+		t.Fatalf("Effective() = %+v", list)
+	}
+	if e := list[1]; e.Layer != LayerTerminal || e.Value != 10000.0 || len(e.Overridden) != 1 {
+		t.Errorf("Effective() VISA = %+v", e)
+	}
+	if p, _ := res.List().Find("DF8124", "VISA"); p.Value != 10000.0 {
+		t.Errorf("List() VISA value = %v, want 10000", p.Value)
+	}
+
+	buf := &bytes.Buffer{}
+	res.WriteText(buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	seen := map[string]bool{}
+	for _, l := range lines {
+		if seen[l] {
+			t.Errorf("WriteText repeats %q", l)
+		}
+		seen[l] = true
+	}
+}
+
+func TestPreferenceResolverMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/merchants/600086900/terminals/66770050", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"terminalId":"66770050","terminalCurrency":634,"terminalProfile":"kiosk",
+			"merchant":{"merchantId":"600086900","acquirer":"cbq","profile":"retail"},
+			"preferences":[{"tag":"9F1B","value":0,"paymentSystem":""}]}`)
+	})
+	mux.HandleFunc("/acquirers/cbq", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":"cbq","preferences":[{"tag":"DF8124","value":50000,"paymentSystem":"VISA"},{"tag":"9F1B","value":5000,"paymentSystem":""}]}`)
+	})
+	mux.HandleFunc("/profiles/retail", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"retail","preferences":[{"tag":"DF8124","value":20000,"paymentSystem":""}]}`)
+	})
+	mux.HandleFunc("/terminalProfiles/kiosk", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"kiosk","preferences":[{"tag":"DF8124","value":10000,"paymentSystem":"VISA"}]}`)
+	})
+
+	res, err := NewPreferenceResolver(c).Resolve(context.Background(), "600086900", "66770050")
+	if err != nil {
+		t.Fatalf("Resolve error = %v", err)
+	}
+
+	limit, err := res.ContactlessLimit("VISA")
+	if err != nil || limit.String() != "100.00 634" {
+		t.Errorf("ContactlessLimit(VISA) = %v, %v", limit, err)
+	}
+	if e, _ := res.Lookup("DF8124", "VISA"); e.Layer != LayerTerminalProfile || e.Source != "kiosk" {
+		t.Errorf("DF8124 VISA source = %v", e.PreferenceOrigin)
+	}
+	if e, _ := res.Lookup("DF8124", "MASTERCARD"); e.Layer != LayerMerchantProfile {
+		t.Errorf("DF8124 MASTERCARD source = %v", e.PreferenceOrigin)
+	}
+	if e, _ := res.Lookup("9F1B", ""); e.Layer != LayerTerminal || len(e.Overridden) != 1 {
+		t.Errorf("9F1B = %+v", e)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := res.WriteText(buf); err != nil || !strings.Contains(buf.String(), `terminal profile "kiosk"`) {
+		t.Errorf("WriteText = %q, %v", buf.String(), err)
+	}
+}
+
+func TestPreferenceResolverMissingProfile(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/terminalProfiles/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	term := &TemrinalDetails{TerminalID: "66770050", TerminalProfile: "gone"}
+	_, err := NewPreferenceResolver(c).ResolveTerminal(context.Background(), term)
+	if !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("ResolveTerminal error = %v, want %v", err, ErrEntityNotFound)
+	}
+}
@@ -1,8 +1,15 @@
 package softpos
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,3 +30,227 @@ func (l LoggingRoundTripper) RoundTrip(req *http.Request) (res *http.Response, e
 
 	return res, err
 }
+
+// CassetteMode selects whether a CassetteRoundTripper sends requests or
+// answers them from the cassette.
+type CassetteMode int
+
+const (
+	// CassetteReplay answers requests from the recorded interactions.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends requests with Wrapped and records them.
+	CassetteRecord
+)
+
+// MatchOn selects the request fields compared when replaying.
+type MatchOn int
+
+const (
+	MatchMethod MatchOn = 1 << iota
+	MatchPath
+	MatchQuery
+	// MatchBody compares JSON bodies by value, after redaction.
+	MatchBody
+
+	DefaultMatch = MatchMethod | MatchPath | MatchQuery | MatchBody
+)
+
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// redactedHeaders are replaced in recorded requests and responses.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// CassetteRoundTripper records request and response pairs to a file and
+// replays them, so tests run against captured TMS traffic. Authorization
+// and key material are redacted before anything is stored.
+//
+// In replay mode every request must match an unused interaction in the
+// cassette; otherwise RoundTrip fails with ErrCassetteMismatch.
+type CassetteRoundTripper struct {
+	Wrapped http.RoundTripper
+	Mode    CassetteMode
+	Match   MatchOn
+
+	path         string
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewCassetteRecorder records the traffic sent with wrapped, or
+// http.DefaultTransport when nil. Call Save to write the cassette to path.
+func NewCassetteRecorder(path string, wrapped http.RoundTripper) *CassetteRoundTripper {
+	if wrapped == nil {
+		wrapped = http.DefaultTransport
+	}
+	return &CassetteRoundTripper{Wrapped: wrapped, Mode: CassetteRecord, Match: DefaultMatch, path: path}
+}
+
+// LoadCassette reads a cassette written by Save for replay.
+func LoadCassette(path string) (*CassetteRoundTripper, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &CassetteRoundTripper{Mode: CassetteReplay, Match: DefaultMatch, path: path}
+	if err := json.Unmarshal(b, &c.interactions); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+func (c *CassetteRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	recorded := CassetteRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: redactHeader(req.Header),
+		Body:   redactCassetteBody(body),
+	}
+
+	if c.Mode == CassetteReplay {
+		return c.replay(req, recorded)
+	}
+
+	res, err := c.Wrapped.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, Interaction{
+		Request: recorded,
+		Response: CassetteResponse{
+			Status: res.StatusCode,
+			Header: redactHeader(res.Header),
+			Body:   redactCassetteBody(resBody),
+		},
+	})
+	c.used = append(c.used, true)
+	return res, nil
+}
+
+func (c *CassetteRoundTripper) replay(req *http.Request, recorded CassetteRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, in := range c.interactions {
+		if c.used[i] || !c.matches(in.Request, recorded) {
+			continue
+		}
+		c.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s: %s %s with body %q: %w",
+		c.path, recorded.Method, recorded.URL, recorded.Body, ErrCassetteMismatch)
+}
+
+func (c *CassetteRoundTripper) matches(in, req CassetteRequest) bool {
+	a, _ := url.Parse(in.URL)
+	b, _ := url.Parse(req.URL)
+	if a == nil || b == nil {
+		return false
+	}
+	switch {
+	case c.Match&MatchMethod != 0 && in.Method != req.Method:
+		return false
+	case c.Match&MatchPath != 0 && a.Path != b.Path:
+		return false
+	case c.Match&MatchQuery != 0 && a.Query().Encode() != b.Query().Encode():
+		return false
+	case c.Match&MatchBody != 0 && in.Body != req.Body:
+		return false
+	}
+	return true
+}
+
+// Unused returns the interactions not replayed yet, for tests to check
+// that every recorded call was made.
+func (c *CassetteRoundTripper) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := []Interaction{}
+	for i, in := range c.interactions {
+		if !c.used[i] {
+			list = append(list, in)
+		}
+	}
+	return list
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (c *CassetteRoundTripper) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(b, '\n'), 0o600)
+}
+
+// readBody reads a request or response body and replaces it with a copy.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range redactedHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(k)]; ok {
+			h.Set(k, redacted)
+		}
+	}
+	return h
+}
+
+func redactCassetteBody(body []byte) string {
+	if b, ok := redactJSON(body); ok {
+		return string(b)
+	}
+	return string(body)
+}
@@ -2,8 +2,12 @@ package softpos
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -31,3 +35,81 @@ func TestGetListMock_withLogging(t *testing.T) {
 	}
 
 }
+
+func TestCassetteRoundTripper(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+	c.SetAPIKey("secret-api-key")
+
+	mux.HandleFunc("/merchants/600086900/terminals/66770050/keys", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"keyType":"TMK","encoding":"LMK","keyValue":"U0123456789ABCDEF0123456789ABCDEF","keyCheckValue":"BAA397"}]`)
+	})
+	mux.HandleFunc("/terminals/ref-1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPatch)
+	})
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec := NewCassetteRecorder(path, nil)
+	c.SetTransport(rec)
+
+	ctx := context.Background()
+	keys := []Keys{}
+	if err := c.TerminalService.GetKeys(ctx, "600086900", "66770050", &keys); err != nil || len(keys) != 1 {
+		t.Fatalf("GetKeys while recording = %v, %v", keys, err)
+	}
+	if keys[0].KeyValue == redacted {
+		t.Error("recording redacted the live response")
+	}
+	if err := c.TerminalService.Update(ctx, "ref-1", map[string]interface{}{"name": "front desk"}); err != nil {
+		t.Fatalf("Update while recording error = %v", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-api-key", "0123456789ABCDEF"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette error = %v", err)
+	}
+	teardown()
+	c.SetTransport(replay)
+
+	keys = nil
+	if err := c.TerminalService.GetKeys(ctx, "600086900", "66770050", &keys); err != nil || len(keys) != 1 || keys[0].KeyCheckValue != "BAA397" {
+		t.Errorf("GetKeys replay = %v, %v", keys, err)
+	}
+	if err := c.TerminalService.Update(ctx, "ref-1", map[string]interface{}{"name": "back office"}); !errors.Is(err, ErrCassetteMismatch) {
+		t.Errorf("Update with another body error = %v, want %v", err, ErrCassetteMismatch)
+	}
+	if n := len(replay.Unused()); n != 1 {
+		t.Errorf("Unused = %d interactions, want 1", n)
+	}
+
+	replay.Match = MatchMethod | MatchPath
+	if err := c.TerminalService.Update(ctx, "ref-1", map[string]interface{}{"name": "back office"}); err != nil {
+		t.Errorf("Update without body matching error = %v", err)
+	}
+	if err := c.TerminalService.GetKeys(ctx, "600086900", "66770050", &keys); !errors.Is(err, ErrCassetteMismatch) {
+		t.Errorf("GetKeys replayed twice error = %v, want %v", err, ErrCassetteMismatch)
+	}
+}
+
+func TestRedactCassetteBodyNumbers(t *testing.T) {
+	got := redactCassetteBody([]byte(`{"id":9007199254740993,"total":1000000000000000000000,"amount":12.50,"keyValue":"U0123"}`))
+	if want := `{"amount":12.50,"id":9007199254740993,"keyValue":"[REDACTED]","total":1000000000000000000000}`; got != want {
+		t.Errorf("redactCassetteBody = %s, want %s", got, want)
+	}
+	if got := redactCassetteBody([]byte(`{"a":1} {"b":2}`)); got != `{"a":1} {"b":2}` {
+		t.Errorf("redactCassetteBody of two values = %s", got)
+	}
+}
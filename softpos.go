@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 )
 
 const (
@@ -32,10 +34,14 @@ func NewClient(defaultBaseURL string, httpClient *http.Client) *Client {
 		client:    httpClient,
 	}
 
+	c.AcquirerService = &AcquirerService{client: c}
+	c.BatchService = &BatchService{client: c}
 	c.CountryService = &CountryService{client: c}
 	c.CurrencyService = &CurrencyService{client: c}
 	c.MerchantService = &MerchantService{client: c}
+	c.ProfileService = &ProfileService{client: c}
 	c.TerminalService = &TerminalService{client: c}
+	c.TransactionService = &TransactionService{client: c}
 	return c
 }
 
@@ -53,11 +59,21 @@ type Client struct {
 	BaseURL   *url.URL
 	UserAgent string
 	apiKey    string
+	auditor   Auditor
 
-	CountryService  *CountryService
-	CurrencyService *CurrencyService
-	MerchantService *MerchantService
-	TerminalService *TerminalService
+	decodeMode DecodeMode
+	drift      *DriftReport
+
+	keysPollInterval time.Duration
+
+	AcquirerService    *AcquirerService
+	BatchService       *BatchService
+	CountryService     *CountryService
+	CurrencyService    *CurrencyService
+	MerchantService    *MerchantService
+	ProfileService     *ProfileService
+	TerminalService    *TerminalService
+	TransactionService *TransactionService
 }
 
 type service struct {
@@ -117,7 +133,7 @@ func (c *Client) processRequest(ctx context.Context, method string, path url.URL
 		return err
 	}
 
-	res, err := c.client.Do(req)
+	res, err := c.Do(req)
 	if err != nil {
 		return err
 	}
@@ -125,8 +141,7 @@ func (c *Client) processRequest(ctx context.Context, method string, path url.URL
 
 	switch res.StatusCode {
 	case http.StatusOK:
-		resp := result
-		err = json.NewDecoder(res.Body).Decode(&resp)
+		err = c.decode(res, result)
 		if err != nil {
 			return err
 		}
@@ -147,6 +162,66 @@ func (c *Client) processRequest(ctx context.Context, method string, path url.URL
 	return err
 }
 
+// send performs a request expecting a 2xx response, decoding its body into
+// result when both are present. Other statuses are mapped to package errors
+// prefixed with op.
+func (c *Client) send(ctx context.Context, op, method string, path url.URL, body interface{}, result interface{}) error {
+	req, err := c.newRequestCtx(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	return c.do(req, op, result)
+}
+
+// do is send for a prepared request.
+func (c *Client) do(req *http.Request, op string, result interface{}) error {
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+		if result == nil {
+			return nil
+		}
+		err = c.decode(res, result)
+		if err == io.EOF {
+			err = nil
+		}
+		return err
+	case http.StatusNoContent:
+		return nil
+	case http.StatusBadRequest:
+		err = ErrIncorrect
+	case http.StatusUnauthorized:
+		err = ErrIvalidToken
+	case http.StatusForbidden:
+		err = ErrNoPermission
+	case http.StatusNotFound:
+		err = ErrEntityNotFound
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		reason := &conflict{}
+		decoded := json.NewDecoder(res.Body).Decode(reason) == nil && reason.Reason != ""
+		switch {
+		case decoded && businessErrors[reason.Reason] != nil:
+			err = &BusinessError{Reason: reason.Reason, Status: res.StatusCode, Err: businessErrors[reason.Reason]}
+		case res.StatusCode == http.StatusUnprocessableEntity:
+			err = ErrUnknown
+		case decoded:
+			apierr := fmt.Sprintf("%s:%s:%s:%d", reason.Reason, reason.Field, reason.Value, reason.Type)
+			err = fmt.Errorf(apierr+"- %w", ErrConflict)
+		default:
+			err = ErrConflict
+		}
+	default:
+		err = ErrUnknown
+	}
+
+	return fmt.Errorf("%s: %w", op, err)
+}
+
 // func (c *Client) processBulkRequest(ctx context.Context, method string, path url.URL, params map[string]string, paramfiles map[string]string, u, f interface{}) error {
 // 	body := &bytes.Buffer{}
 // 	writer := multipart.NewWriter(body)
@@ -205,15 +280,41 @@ func (c *Client) processRequest(ctx context.Context, method string, path url.URL
 // 	return err
 // }
 
+// Do sends the request. With an auditor set, mutating requests are
+// recorded once they complete; if recording fails the response is
+// discarded and the error returned, although the TMS may have applied the
+// change.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
+
+	a := c.getAuditor()
+	var body []byte
+	if a != nil && audited(req.Method) && req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			err = ctx.Err()
 		default:
 		}
+	}
+	if a != nil && audited(req.Method) {
+		if auditErr := c.audit(a, req, body, resp, err); auditErr != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, fmt.Errorf("audit: %w", auditErr)
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
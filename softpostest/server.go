@@ -0,0 +1,764 @@
+// Package softpostest provides an in-memory TMS for testing code built on
+// the softpos client.
+//
+// The server keeps merchants, terminals, countries, currencies and
+// acquirers in memory and answers the endpoints the client uses with the
+// status codes of the real TMS: 401 for a wrong API key, 400 for invalid
+// data, 404 for unknown entities and 409 for duplicates.
+//
+//	srv := softpostest.NewServer()
+//	defer srv.Close()
+//	client := srv.Client()
+package softpostest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrei-cloud/softpos"
+)
+
+// DefaultAPIKey is the API key accepted by a new server.
+const DefaultAPIKey = "softpostest-api-key"
+
+// Merchant and terminal states accepted by the status endpoints. New
+// entities start Inactive.
+const (
+	StateActive    = "Active"
+	StateInactive  = "Inactive"
+	StateSuspended = "Suspended"
+	StateBlocked   = "Blocked"
+)
+
+var states = map[string]bool{StateActive: true, StateInactive: true, StateSuspended: true, StateBlocked: true}
+
+// Server is a fake TMS. Set APIKey and ReadOnlyAPIKey before sending
+// requests.
+type Server struct {
+	*httptest.Server
+
+	// APIKey is the key required in the Authorization header.
+	APIKey string
+	// ReadOnlyAPIKey, if set, is a key allowed to read but answered with
+	// 403 on changes.
+	ReadOnlyAPIKey string
+
+	mu         sync.Mutex
+	countries  map[int]softpos.Country
+	currencies map[int]softpos.Currency
+	acquirers  map[string]softpos.Acquirer
+	merchants  []*softpos.MerchantListItem
+	terminals  []*terminal
+	seq        int
+	now        func() time.Time
+}
+
+// terminal is a stored terminal; its merchant is filled in when it is
+// returned so merchant changes show up in terminal details.
+type terminal struct {
+	merchantRef string
+	details     softpos.TemrinalDetails
+}
+
+// NewServer starts a server seeded with Qatar, the Qatari riyal and the
+// "cbq" acquirer. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:     DefaultAPIKey,
+		countries:  map[int]softpos.Country{},
+		currencies: map[int]softpos.Currency{},
+		acquirers:  map[string]softpos.Acquirer{},
+		now:        func() time.Time { return time.Now().UTC().Truncate(time.Microsecond) },
+	}
+	s.AddCountry(softpos.Country{Name: "Qatar", NameNative: "قطر", Alpha2: "QA", Alpha3: "QAT", Code: 634})
+	s.AddCurrency(softpos.Currency{Name: "QAR", Code: 634, DecimalPlaces: 2, Sign: "QR"})
+	s.AddAcquirer(softpos.Acquirer{Code: "cbq", Name: "CBQ", Country: 634, Currency: 634, Preferences: softpos.PreferenceList{}})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", http.HandlerFunc(s.serve)))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Client returns a softpos client for the server using APIKey.
+func (s *Server) Client() *softpos.Client {
+	c := softpos.NewClient(s.URL+"/api/", s.Server.Client())
+	c.SetAPIKey(s.APIKey)
+	return c
+}
+
+// AddCountry stores a country, replacing one with the same code.
+func (s *Server) AddCountry(c softpos.Country) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.countries[c.Code] = c
+}
+
+// AddCurrency stores a currency, replacing one with the same code.
+func (s *Server) AddCurrency(c softpos.Currency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currencies[c.Code] = c
+}
+
+// AddAcquirer stores an acquirer, replacing one with the same code in any
+// case.
+func (s *Server) AddAcquirer(a softpos.Acquirer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acquirers[strings.ToLower(a.Code)] = a
+}
+
+// AddMerchant stores a merchant as the create endpoint would and returns
+// its reference.
+func (s *Server) AddMerchant(m softpos.MerchantDetails) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, apiErr := s.createMerchant(&m)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	return item.Reference, nil
+}
+
+// AddTerminal stores a terminal of the merchant as the create endpoint
+// would and returns its reference.
+func (s *Server) AddTerminal(mid string, t softpos.Terminal) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.merchant(mid)
+	if m == nil {
+		return "", &apiError{status: http.StatusNotFound, Reason: "merchant not found", Field: "merchantId", Value: mid}
+	}
+	term, apiErr := s.createTerminal(m, &t)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	return term.details.Reference, nil
+}
+
+// Merchant returns a merchant by merchant id or reference.
+func (s *Server) Merchant(id string) (softpos.MerchantListItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.merchant(id); m != nil {
+		return *m, true
+	}
+	return softpos.MerchantListItem{}, false
+}
+
+// Terminal returns a terminal of a merchant by terminal id.
+func (s *Server) Terminal(mid, tid string) (softpos.TemrinalDetails, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.merchant(mid)
+	if m == nil {
+		return softpos.TemrinalDetails{}, false
+	}
+	if t := s.terminal(m, tid); t != nil {
+		return s.terminalDetails(t), true
+	}
+	return softpos.TemrinalDetails{}, false
+}
+
+// apiError is an error response. Its body has the shape of the TMS
+// conflict responses.
+type apiError struct {
+	status int
+	Reason string `json:"reason"`
+	Field  string `json:"field,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s %s", e.status, http.StatusText(e.status), e.Reason, e.Field)
+}
+
+func notFound(what, id string) *apiError {
+	return &apiError{status: http.StatusNotFound, Reason: what + " not found", Value: id}
+}
+
+func badRequest(field, reason string) *apiError {
+	return &apiError{status: http.StatusBadRequest, Reason: reason, Field: field}
+}
+
+func invalid(err error) *apiError {
+	e := &apiError{status: http.StatusBadRequest, Reason: err.Error()}
+	if v, ok := err.(softpos.ValidationError); ok {
+		fields := make([]string, 0, len(v))
+		for f := range v {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		e.Field = strings.Join(fields, ",")
+	}
+	return e
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Authorization")
+	readOnly := s.ReadOnlyAPIKey != "" && key == s.ReadOnlyAPIKey
+	if key != s.APIKey && !readOnly {
+		writeError(w, &apiError{status: http.StatusUnauthorized, Reason: "invalid token"})
+		return
+	}
+	if readOnly && r.Method != http.MethodGet {
+		writeError(w, &apiError{status: http.StatusForbidden, Reason: "no permission"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, v, apiErr := s.route(r, strings.Split(strings.Trim(r.URL.Path, "/"), "/"))
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if v != nil {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// route dispatches a request by its path segments, returning the status
+// and body of a successful response.
+func (s *Server) route(r *http.Request, p []string) (int, interface{}, *apiError) {
+	method := r.Method + " "
+	switch {
+	case len(p) == 1 && p[0] == "countries" && r.Method == http.MethodGet:
+		return s.listCountries()
+	case len(p) == 2 && p[0] == "countries" && r.Method == http.MethodGet:
+		return s.getCountry(p[1])
+	case len(p) == 1 && p[0] == "currencies" && r.Method == http.MethodGet:
+		return s.listCurrencies()
+	case len(p) == 2 && p[0] == "currencies" && r.Method == http.MethodGet:
+		return s.getCurrency(p[1])
+	case len(p) == 1 && p[0] == "acquirers" && r.Method == http.MethodGet:
+		return s.listAcquirers()
+	case len(p) == 2 && p[0] == "acquirers" && r.Method == http.MethodGet:
+		return s.getAcquirer(p[1])
+	case len(p) == 2 && p[0] == "terminals" && r.Method == http.MethodPatch:
+		return s.updateTerminal(r, p[1])
+	case len(p) >= 1 && p[0] == "merchants":
+		switch method + strings.Join(pattern(p), "/") {
+		case "GET merchants":
+			return s.listMerchants(r)
+		case "POST merchants":
+			return s.postMerchant(r)
+		case "GET merchants/*":
+			return s.getMerchant(p[1])
+		case "PATCH merchants/*":
+			return s.updateMerchant(r, p[1])
+		case "PUT merchants/*/status":
+			return s.merchantStatus(r, p[1])
+		case "GET merchants/*/terminals":
+			return s.listTerminals(p[1])
+		case "POST merchants/*/terminals":
+			return s.postTerminal(r, p[1])
+		case "GET merchants/*/terminals/*":
+			return s.getTerminal(p[1], p[3])
+		case "PUT merchants/*/terminals/*/status":
+			return s.terminalStatus(r, p[1], p[3])
+		}
+	}
+	return 0, nil, &apiError{status: http.StatusNotFound, Reason: "no route for " + r.Method + " " + r.URL.Path}
+}
+
+// pattern replaces the identifiers in a merchants path with "*".
+func pattern(p []string) []string {
+	out := append([]string(nil), p...)
+	for i := 1; i < len(out); i += 2 {
+		out[i] = "*"
+	}
+	return out
+}
+
+func decode(r *http.Request, v interface{}) *apiError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("", "invalid request body: "+err.Error())
+	}
+	return nil
+}
+
+func (s *Server) nextReference() string {
+	s.seq++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.seq)
+}
+
+func (s *Server) listCountries() (int, interface{}, *apiError) {
+	list := softpos.CountryList{}
+	for _, c := range s.countries {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) getCountry(code string) (int, interface{}, *apiError) {
+	n, _ := strconv.Atoi(code)
+	c, ok := s.countries[n]
+	if !ok {
+		return 0, nil, notFound("country", code)
+	}
+	return http.StatusOK, c, nil
+}
+
+func (s *Server) listCurrencies() (int, interface{}, *apiError) {
+	list := softpos.CurrencyList{}
+	for _, c := range s.currencies {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) getCurrency(code string) (int, interface{}, *apiError) {
+	n, _ := strconv.Atoi(code)
+	c, ok := s.currencies[n]
+	if !ok {
+		return 0, nil, notFound("currency", code)
+	}
+	return http.StatusOK, c, nil
+}
+
+func (s *Server) listAcquirers() (int, interface{}, *apiError) {
+	list := []softpos.Acquirer{}
+	for _, a := range s.acquirers {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) getAcquirer(code string) (int, interface{}, *apiError) {
+	a, ok := s.acquirers[strings.ToLower(code)]
+	if !ok {
+		return 0, nil, notFound("acquirer", code)
+	}
+	return http.StatusOK, a, nil
+}
+
+// merchant finds a merchant by merchant id or reference.
+func (s *Server) merchant(id string) *softpos.MerchantListItem {
+	for _, m := range s.merchants {
+		if m.MerchantID == id || m.Reference == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// checkMerchant validates a merchant against the server tables.
+func (s *Server) checkMerchant(m *softpos.MerchantDetails) *apiError {
+	if err := m.Validate(); err != nil {
+		return invalid(err)
+	}
+	if _, ok := s.acquirers[strings.ToLower(m.Acquirer)]; !ok {
+		return badRequest("acquirer", "acquirer does not exist")
+	}
+	if _, ok := s.countries[m.Country]; !ok {
+		return badRequest("country", "country does not exist")
+	}
+	if _, ok := s.currencies[m.Currency]; !ok {
+		return badRequest("currency", "currency does not exist")
+	}
+	return nil
+}
+
+func (s *Server) createMerchant(m *softpos.MerchantDetails) (*softpos.MerchantListItem, *apiError) {
+	if apiErr := s.checkMerchant(m); apiErr != nil {
+		return nil, apiErr
+	}
+	if s.merchant(m.MerchantID) != nil {
+		return nil, &apiError{status: http.StatusConflict, Reason: "duplicate", Field: "MID", Value: m.MerchantID}
+	}
+
+	now := s.now()
+	item := &softpos.MerchantListItem{
+		State:              StateInactive,
+		Reference:          s.nextReference(),
+		MerchantID:         m.MerchantID,
+		IsLocationRequired: m.IsLocationRequired,
+		Name:               m.Name,
+		TaxRefNumber:       m.TaxRefNumber,
+		Country:            m.Country,
+		City:               m.City,
+		Region:             m.Region,
+		Address:            m.Address,
+		PostalCode:         m.PostalCode,
+		Phone:              m.Phone,
+		Email:              m.Email,
+		Created:            now,
+		Updated:            now,
+		Acquirer:           strings.ToLower(m.Acquirer),
+		Currency:           m.Currency,
+		Mcc:                m.Mcc,
+		Language:           m.Language,
+		Profile:            m.Profile,
+		Flags:              "None",
+	}
+	if item.Profile == "" {
+		item.Profile = "default"
+	}
+	s.merchants = append(s.merchants, item)
+	return item, nil
+}
+
+// merchantDetails is the details response of a merchant.
+func (s *Server) merchantDetails(m *softpos.MerchantListItem) softpos.MerchantDetails {
+	d := softpos.MerchantDetails{}
+	b, _ := json.Marshal(m)
+	json.Unmarshal(b, &d)
+	d.CurrencyName = s.currencies[m.Currency].Name
+	d.AcquirerName = s.acquirers[m.Acquirer].Name
+	d.CountryName = s.countries[m.Country].Name
+	d.CountryNativeName = s.countries[m.Country].NameNative
+	return d
+}
+
+// defaultPerPage is the merchants page size when the request has none.
+const defaultPerPage = 20
+
+// listMerchants returns the page of merchants selected by the 1-based page
+// and perPage query parameters.
+func (s *Server) listMerchants(r *http.Request) (int, interface{}, *apiError) {
+	q := r.URL.Query()
+	page, perPage := 1, defaultPerPage
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, nil, badRequest("page", "page must be a positive number")
+		}
+		page = n
+	}
+	if v := q.Get("perPage"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, nil, badRequest("perPage", "perPage must be a positive number")
+		}
+		perPage = n
+	}
+
+	list := softpos.MerchnatList{
+		Index:      page,
+		TotalCount: len(s.merchants),
+		PerPage:    perPage,
+		Offset:     (page - 1) * perPage,
+		TotalPages: (len(s.merchants) + perPage - 1) / perPage,
+		Items:      []softpos.MerchantListItem{},
+	}
+	if list.TotalPages == 0 {
+		list.TotalPages = 1
+	}
+	for i := list.Offset; i < len(s.merchants) && i < list.Offset+perPage; i++ {
+		list.Items = append(list.Items, *s.merchants[i])
+	}
+	list.Count = len(list.Items)
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) postMerchant(r *http.Request) (int, interface{}, *apiError) {
+	m := softpos.MerchantDetails{}
+	if apiErr := decode(r, &m); apiErr != nil {
+		return 0, nil, apiErr
+	}
+	item, apiErr := s.createMerchant(&m)
+	if apiErr != nil {
+		return 0, nil, apiErr
+	}
+	return http.StatusCreated, softpos.CreateResponse{Reference: item.Reference}, nil
+}
+
+func (s *Server) getMerchant(id string) (int, interface{}, *apiError) {
+	m := s.merchant(id)
+	if m == nil {
+		return 0, nil, notFound("merchant", id)
+	}
+	return http.StatusOK, s.merchantDetails(m), nil
+}
+
+func (s *Server) updateMerchant(r *http.Request, id string) (int, interface{}, *apiError) {
+	m := s.merchant(id)
+	if m == nil {
+		return 0, nil, notFound("merchant", id)
+	}
+	patch := json.RawMessage{}
+	if apiErr := decode(r, &patch); apiErr != nil {
+		return 0, nil, apiErr
+	}
+
+	updated := *m
+	if err := json.Unmarshal(patch, &updated); err != nil {
+		return 0, nil, badRequest("", "invalid request body: "+err.Error())
+	}
+	if updated.MerchantID != m.MerchantID || updated.Reference != m.Reference {
+		return 0, nil, badRequest("merchantId", "merchant id and reference can't be changed")
+	}
+	d := s.merchantDetails(&updated)
+	if apiErr := s.checkMerchant(&d); apiErr != nil {
+		return 0, nil, apiErr
+	}
+	updated.State, updated.Created = m.State, m.Created
+	updated.Updated = s.now()
+	*m = updated
+	return http.StatusOK, nil, nil
+}
+
+type stateChange struct {
+	State string `json:"state"`
+	Note  string `json:"note,omitempty"`
+}
+
+func decodeState(r *http.Request) (string, *apiError) {
+	sc := stateChange{}
+	if apiErr := decode(r, &sc); apiErr != nil {
+		return "", apiErr
+	}
+	if !states[sc.State] {
+		return "", badRequest("state", fmt.Sprintf("unknown state %q", sc.State))
+	}
+	return sc.State, nil
+}
+
+func (s *Server) merchantStatus(r *http.Request, id string) (int, interface{}, *apiError) {
+	m := s.merchant(id)
+	if m == nil {
+		return 0, nil, notFound("merchant", id)
+	}
+	state, apiErr := decodeState(r)
+	if apiErr != nil {
+		return 0, nil, apiErr
+	}
+	m.State = state
+	m.Updated = s.now()
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) terminal(m *softpos.MerchantListItem, tid string) *terminal {
+	for _, t := range s.terminals {
+		if t.merchantRef == m.Reference && (t.details.TerminalID == tid || t.details.Reference == tid) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) createTerminal(m *softpos.MerchantListItem, req *softpos.Terminal) (*terminal, *apiError) {
+	if err := req.Validate(); err != nil {
+		return nil, invalid(err)
+	}
+	if req.Currency != 0 {
+		if _, ok := s.currencies[req.Currency]; !ok {
+			return nil, badRequest("currency", "currency does not exist")
+		}
+	}
+	for _, t := range s.terminals {
+		if t.merchantRef == m.Reference && t.details.TerminalID == req.TerminalID {
+			return nil, &apiError{status: http.StatusConflict, Reason: "duplicate", Field: "TID", Value: req.TerminalID}
+		}
+	}
+
+	now := s.now()
+	t := &terminal{merchantRef: m.Reference}
+	d := &t.details
+	d.Reference = s.nextReference()
+	d.TerminalID = req.TerminalID
+	d.State = StateInactive
+	d.Name, d.Phone, d.Email = req.Name, req.Phone, req.Email
+	d.Currency, d.Country, d.Mcc, d.Profile, d.Language = m.Currency, m.Country, m.Mcc.MCC(), m.Profile, m.Language
+	d.TerminalCurrency, d.TerminalMcc, d.TerminalProfile, d.TerminalLanguage = m.Currency, m.Mcc, m.Profile, m.Language
+	if req.Currency != 0 {
+		d.TerminalCurrency = req.Currency
+	}
+	if req.Mcc != 0 {
+		d.TerminalMcc = softpos.MCCString(req.Mcc.String())
+	}
+	if req.Profile != "" {
+		d.TerminalProfile = req.Profile
+	}
+	if req.Language != "" {
+		d.TerminalLanguage = req.Language
+	}
+	d.InputMethods = append(softpos.InputMethods{}, req.InputMethods...)
+	d.Preferences = softpos.PreferenceList{}
+	d.Keys = []softpos.Keys{}
+	d.MasterKeyID = "0"
+	d.Created, d.Updated = now, now
+	s.terminals = append(s.terminals, t)
+	return t, nil
+}
+
+// terminalDetails is the details response of a terminal, with the
+// current state of its merchant.
+func (s *Server) terminalDetails(t *terminal) softpos.TemrinalDetails {
+	d := t.details
+	d.InputMethods = append(softpos.InputMethods{}, d.InputMethods...)
+	d.Preferences = append(softpos.PreferenceList{}, d.Preferences...)
+	d.Keys = append([]softpos.Keys{}, d.Keys...)
+	d.CurrencyName = s.currencies[d.Currency].Name
+	d.TerminalCurrencyName = s.currencies[d.TerminalCurrency].Name
+	if m := s.merchant(t.merchantRef); m != nil {
+		b, _ := json.Marshal(s.merchantDetails(m))
+		json.Unmarshal(b, &d.Merchant)
+		d.Merchant.Created, d.Merchant.Updated = m.Created, m.Updated
+	}
+	return d
+}
+
+func (s *Server) listTerminals(mid string) (int, interface{}, *apiError) {
+	m := s.merchant(mid)
+	if m == nil {
+		return 0, nil, notFound("merchant", mid)
+	}
+	list := []softpos.TemrinalDetails{}
+	for _, t := range s.terminals {
+		if t.merchantRef == m.Reference {
+			list = append(list, s.terminalDetails(t))
+		}
+	}
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) postTerminal(r *http.Request, mid string) (int, interface{}, *apiError) {
+	m := s.merchant(mid)
+	if m == nil {
+		return 0, nil, notFound("merchant", mid)
+	}
+	req := softpos.Terminal{}
+	if apiErr := decode(r, &req); apiErr != nil {
+		return 0, nil, apiErr
+	}
+	t, apiErr := s.createTerminal(m, &req)
+	if apiErr != nil {
+		return 0, nil, apiErr
+	}
+	return http.StatusCreated, softpos.CreateResponse{Reference: t.details.Reference}, nil
+}
+
+func (s *Server) getTerminal(mid, tid string) (int, interface{}, *apiError) {
+	m := s.merchant(mid)
+	if m == nil {
+		return 0, nil, notFound("merchant", mid)
+	}
+	t := s.terminal(m, tid)
+	if t == nil {
+		return 0, nil, notFound("terminal", tid)
+	}
+	return http.StatusOK, s.terminalDetails(t), nil
+}
+
+func (s *Server) terminalStatus(r *http.Request, mid, tid string) (int, interface{}, *apiError) {
+	m := s.merchant(mid)
+	if m == nil {
+		return 0, nil, notFound("merchant", mid)
+	}
+	t := s.terminal(m, tid)
+	if t == nil {
+		return 0, nil, notFound("terminal", tid)
+	}
+	state, apiErr := decodeState(r)
+	if apiErr != nil {
+		return 0, nil, apiErr
+	}
+	t.details.State = state
+	t.details.Updated = s.now()
+	return http.StatusOK, nil, nil
+}
+
+// terminalPatch is a terminal update. Fields are those of softpos.Terminal
+// and apply to the terminal settings, not to the merchant defaults.
+type terminalPatch struct {
+	TerminalID   *string                 `json:"terminalId"`
+	Currency     *int                    `json:"currency"`
+	Phone        *string                 `json:"phone"`
+	Email        *string                 `json:"email"`
+	Profile      *string                 `json:"profile"`
+	Name         *string                 `json:"name"`
+	Mcc          *softpos.MCC            `json:"mcc"`
+	Language     *string                 `json:"language"`
+	InputMethods *softpos.InputMethods   `json:"inputMethods"`
+	Preferences  *softpos.PreferenceList `json:"preferences"`
+}
+
+func (s *Server) updateTerminal(r *http.Request, ref string) (int, interface{}, *apiError) {
+	var t *terminal
+	for _, c := range s.terminals {
+		if c.details.Reference == ref {
+			t = c
+		}
+	}
+	if t == nil {
+		return 0, nil, notFound("terminal", ref)
+	}
+	p := terminalPatch{}
+	if apiErr := decode(r, &p); apiErr != nil {
+		return 0, nil, apiErr
+	}
+	if p.TerminalID != nil && *p.TerminalID != t.details.TerminalID {
+		return 0, nil, badRequest("terminalId", "terminal id can't be changed")
+	}
+
+	d := t.details
+	if p.Currency != nil {
+		d.TerminalCurrency = *p.Currency
+	}
+	if p.Phone != nil {
+		d.Phone = *p.Phone
+	}
+	if p.Email != nil {
+		d.Email = *p.Email
+	}
+	if p.Profile != nil {
+		d.TerminalProfile = *p.Profile
+	}
+	if p.Name != nil {
+		d.Name = *p.Name
+	}
+	if p.Mcc != nil {
+		d.TerminalMcc = softpos.MCCString(p.Mcc.String())
+	}
+	if p.Language != nil {
+		d.TerminalLanguage = *p.Language
+	}
+	if p.InputMethods != nil {
+		d.InputMethods = append(softpos.InputMethods{}, *p.InputMethods...)
+	}
+	if p.Preferences != nil {
+		d.Preferences = append(softpos.PreferenceList{}, *p.Preferences...)
+	}
+
+	check := softpos.Terminal{
+		TerminalID:   d.TerminalID,
+		Currency:     d.TerminalCurrency,
+		Phone:        d.Phone,
+		Email:        d.Email,
+		Name:         d.Name,
+		Mcc:          d.TerminalMcc.MCC(),
+		Language:     d.TerminalLanguage,
+		InputMethods: d.InputMethods,
+	}
+	if err := check.Validate(); err != nil {
+		return 0, nil, invalid(err)
+	}
+	if _, ok := s.currencies[d.TerminalCurrency]; !ok {
+		return 0, nil, badRequest("currency", "currency does not exist")
+	}
+	d.Updated = s.now()
+	t.details = d
+	return http.StatusOK, nil, nil
+}
@@ -0,0 +1,190 @@
+package softpostest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/andrei-cloud/softpos"
+)
+
+func merchant() *softpos.MerchantDetails {
+	return &softpos.MerchantDetails{
+		MerchantID: "600086900",
+		Name:       "Merchant Test",
+		Country:    634,
+		City:       "Doha",
+		Phone:      "+97465743782",
+		Email:      "zak.exemple@cbq.qa",
+		Acquirer:   "cbq",
+		Currency:   634,
+		Mcc:        "5812",
+		Language:   "en",
+	}
+}
+
+type state struct {
+	State string `json:"state"`
+}
+
+func TestServerMerchantsAndTerminals(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	c := srv.Client()
+	c.SetDecodeMode(softpos.DecodeStrict)
+	ctx := context.Background()
+
+	ref := softpos.CreateResponse{}
+	if err := c.MerchantService.Create(ctx, merchant(), &ref); err != nil || ref.Reference == "" {
+		t.Fatalf("Create merchant = %+v, %v", ref, err)
+	}
+	if err := c.MerchantService.Create(ctx, merchant(), &ref); !errors.Is(err, softpos.ErrConflict) {
+		t.Errorf("Create duplicate merchant error = %v, want %v", err, softpos.ErrConflict)
+	}
+	unknown := merchant()
+	unknown.MerchantID, unknown.Acquirer = "600086901", "qnb"
+	if err := c.MerchantService.Create(ctx, unknown, &ref); !errors.Is(err, softpos.ErrAcqNotExist) {
+		t.Errorf("Create merchant of unknown acquirer error = %v, want %v", err, softpos.ErrAcqNotExist)
+	}
+
+	term := &softpos.Terminal{TerminalID: "66770050", Name: "front desk", InputMethods: softpos.InputMethods{softpos.InputContactless}}
+	tref := softpos.CreateResponse{}
+	if err := c.TerminalService.Create(ctx, "600086900", term, &tref); err != nil {
+		t.Fatalf("Create terminal error = %v", err)
+	}
+	if err := c.TerminalService.Create(ctx, "600086900", term, &tref); !errors.Is(err, softpos.ErrConflict) {
+		t.Errorf("Create duplicate terminal error = %v, want %v", err, softpos.ErrConflict)
+	}
+	if err := c.TerminalService.Create(ctx, "999999999", term, &tref); !errors.Is(err, softpos.ErrEntityNotFound) {
+		t.Errorf("Create terminal of unknown merchant error = %v, want %v", err, softpos.ErrEntityNotFound)
+	}
+
+	if err := c.MerchantService.ChangeStatus(ctx, "600086900", &state{StateSuspended}); err != nil {
+		t.Fatalf("ChangeStatus error = %v", err)
+	}
+	if err := c.MerchantService.ChangeStatus(ctx, "600086900", &state{"Sleeping"}); err == nil {
+		t.Error("ChangeStatus to unknown state succeeded")
+	}
+
+	list := []softpos.TemrinalDetails{}
+	if err := c.TerminalService.GetListByMerchnat(ctx, "600086900", &list); err != nil || len(list) != 1 {
+		t.Fatalf("GetListByMerchnat = %d terminals, %v", len(list), err)
+	}
+	got := list[0]
+	if got.Reference != tref.Reference || got.State != StateInactive || got.Merchant.State != StateSuspended ||
+		got.Merchant.Reference != ref.Reference || got.TerminalCurrency != 634 || got.CurrencyName != "QAR" ||
+		!got.InputMethods.Has(softpos.InputContactless) {
+		t.Errorf("terminal = %+v", got)
+	}
+
+	patch := map[string]interface{}{"language": "ar", "inputMethods": []string{"Chip"}}
+	if err := c.TerminalService.Update(ctx, tref.Reference, patch); err != nil {
+		t.Fatalf("Update terminal error = %v", err)
+	}
+	if err := c.TerminalService.Update(ctx, tref.Reference, map[string]interface{}{"currency": 999}); !errors.Is(err, softpos.ErrIncorrect) {
+		t.Errorf("Update terminal currency error = %v, want %v", err, softpos.ErrIncorrect)
+	}
+	if err := c.TerminalService.ChangeStatus(ctx, "600086900", "66770050", &state{StateActive}); err != nil {
+		t.Fatalf("ChangeStatus terminal error = %v", err)
+	}
+	details := softpos.TemrinalDetails{}
+	if err := c.TerminalService.GetDetailsByMerchant(ctx, "600086900", "66770050", &details); err != nil {
+		t.Fatalf("GetDetailsByMerchant error = %v", err)
+	}
+	if details.TerminalLanguage != "ar" || details.State != StateActive || !details.InputMethods.Equal(softpos.InputMethods{softpos.InputChip}) {
+		t.Errorf("updated terminal = %+v", details)
+	}
+	if err := c.TerminalService.GetDetailsByMerchant(ctx, "600086900", "66770059", &details); !errors.Is(err, softpos.ErrEntityNotFound) {
+		t.Errorf("GetDetailsByMerchant of unknown terminal error = %v, want %v", err, softpos.ErrEntityNotFound)
+	}
+
+	if err := c.MerchantService.Update(ctx, ref.Reference, map[string]interface{}{"city": "Lusail"}); err != nil {
+		t.Fatalf("Update merchant error = %v", err)
+	}
+	md := softpos.MerchantDetails{}
+	if err := c.MerchantService.GetDetails(ctx, "600086900", &md); err != nil || md.City != "Lusail" || md.AcquirerName != "CBQ" {
+		t.Errorf("GetDetails = %+v, %v", md, err)
+	}
+	ml := softpos.MerchnatList{}
+	if err := c.MerchantService.GetList(ctx, &ml); err != nil || ml.TotalCount != 1 || ml.Items[0].State != StateSuspended {
+		t.Errorf("GetList = %+v, %v", ml, err)
+	}
+}
+
+func TestServerMerchantPages(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	for i := 0; i < 25; i++ {
+		m := merchant()
+		m.MerchantID = fmt.Sprintf("6000869%02d", i)
+		if _, err := srv.AddMerchant(*m); err != nil {
+			t.Fatalf("AddMerchant error = %v", err)
+		}
+	}
+	c := srv.Client()
+	ctx := context.Background()
+
+	ml := softpos.MerchnatList{}
+	if err := c.MerchantService.GetPage(ctx, 3, 10, &ml); err != nil || ml.Index != 3 || ml.TotalPages != 3 || ml.Count != 5 || ml.Items[0].MerchantID != "600086920" {
+		t.Errorf("GetPage = %+v, %v", ml, err)
+	}
+	all, err := c.MerchantService.GetAll(ctx)
+	if err != nil || len(all) != 25 || all[24].MerchantID != "600086924" {
+		t.Errorf("GetAll = %d merchants, %v", len(all), err)
+	}
+	if err := c.MerchantService.GetPage(ctx, 0, 10, &ml); !errors.Is(err, softpos.ErrIncorrect) {
+		t.Errorf("GetPage(0) error = %v, want %v", err, softpos.ErrIncorrect)
+	}
+}
+
+func TestServerReferenceData(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.AddCurrency(softpos.Currency{Name: "USD", Code: 840, DecimalPlaces: 2, Sign: "$"})
+	c := srv.Client()
+	ctx := context.Background()
+
+	currencies := softpos.CurrencyList{}
+	if err := c.CurrencyService.GetList(ctx, &currencies); err != nil || len(currencies) != 2 || currencies[1].Code != 840 {
+		t.Errorf("Currencies = %+v, %v", currencies, err)
+	}
+	country := softpos.Country{}
+	if err := c.CountryService.GetDetails(ctx, 634, &country); err != nil || country.Alpha2 != "QA" {
+		t.Errorf("Country = %+v, %v", country, err)
+	}
+	if err := c.CountryService.GetDetails(ctx, 248, &country); !errors.Is(err, softpos.ErrEntityNotFound) {
+		t.Errorf("unknown country error = %v, want %v", err, softpos.ErrEntityNotFound)
+	}
+	acq := softpos.Acquirer{}
+	if err := c.AcquirerService.GetByCode(ctx, "CBQ", &acq); err != nil || acq.Name != "CBQ" {
+		t.Errorf("Acquirer = %+v, %v", acq, err)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.ReadOnlyAPIKey = "viewer"
+	if _, err := srv.AddMerchant(*merchant()); err != nil {
+		t.Fatalf("AddMerchant error = %v", err)
+	}
+	ctx := context.Background()
+
+	c := srv.Client()
+	c.SetAPIKey("wrong")
+	if err := c.MerchantService.GetList(ctx, &softpos.MerchnatList{}); !errors.Is(err, softpos.ErrIvalidToken) {
+		t.Errorf("GetList with wrong key error = %v, want %v", err, softpos.ErrIvalidToken)
+	}
+
+	c.SetAPIKey("viewer")
+	if err := c.MerchantService.GetDetails(ctx, "600086900", &softpos.MerchantDetails{}); err != nil {
+		t.Errorf("GetDetails with read-only key error = %v", err)
+	}
+	if err := c.MerchantService.ChangeStatus(ctx, "600086900", &state{StateActive}); !errors.Is(err, softpos.ErrNoPermission) {
+		t.Errorf("ChangeStatus with read-only key error = %v, want %v", err, softpos.ErrNoPermission)
+	}
+	if m, _ := srv.Merchant("600086900"); m.State != StateInactive {
+		t.Errorf("merchant state = %s, want %s", m.State, StateInactive)
+	}
+}
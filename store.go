@@ -0,0 +1,334 @@
+package softpos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store persists the mirrored fleet. Terminals are keyed by the ID of the
+// merchant they were listed under and TerminalID, since the merchant
+// embedded in terminal responses may be incomplete.
+type Store interface {
+	PutMerchant(m MerchantListItem) error
+	DeleteMerchant(mid string) error
+	PutTerminal(mid string, t TemrinalDetails) error
+	DeleteTerminal(mid, tid string) error
+	Merchants() ([]MerchantListItem, error)
+	// Terminals returns the terminals by merchant ID.
+	Terminals() (map[string][]TemrinalDetails, error)
+	SetLastSync(t time.Time) error
+	LastSync() (time.Time, error)
+}
+
+func terminalKey(mid, tid string) string {
+	return mid + "/" + tid
+}
+
+// MemoryStore is a Store kept in memory only.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	merchants map[string]MerchantListItem
+	terminals map[string]map[string]TemrinalDetails
+	lastSync  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{merchants: map[string]MerchantListItem{}, terminals: map[string]map[string]TemrinalDetails{}}
+}
+
+func (s *MemoryStore) PutMerchant(m MerchantListItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.merchants[m.MerchantID] = m
+	return nil
+}
+
+func (s *MemoryStore) DeleteMerchant(mid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.merchants, mid)
+	return nil
+}
+
+func (s *MemoryStore) PutTerminal(mid string, t TemrinalDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.terminals[mid] == nil {
+		s.terminals[mid] = map[string]TemrinalDetails{}
+	}
+	s.terminals[mid][t.TerminalID] = t
+	return nil
+}
+
+func (s *MemoryStore) DeleteTerminal(mid, tid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.terminals[mid], tid)
+	if len(s.terminals[mid]) == 0 {
+		delete(s.terminals, mid)
+	}
+	return nil
+}
+
+// Merchants returns the merchants ordered by ID.
+func (s *MemoryStore) Merchants() ([]MerchantListItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]MerchantListItem, 0, len(s.merchants))
+	for _, m := range s.merchants {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MerchantID < list[j].MerchantID })
+	return list, nil
+}
+
+// Terminals returns the terminals by merchant ID, each ordered by
+// terminal ID.
+func (s *MemoryStore) Terminals() (map[string][]TemrinalDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(map[string][]TemrinalDetails, len(s.terminals))
+	for mid, terminals := range s.terminals {
+		list := make([]TemrinalDetails, 0, len(terminals))
+		for _, t := range terminals {
+			list = append(list, t)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].TerminalID < list[j].TerminalID })
+		all[mid] = list
+	}
+	return all, nil
+}
+
+func (s *MemoryStore) SetLastSync(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSync = t
+	return nil
+}
+
+func (s *MemoryStore) LastSync() (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSync, nil
+}
+
+// Operations of the FileStore log.
+const (
+	opPutMerchant    = "put-merchant"
+	opDeleteMerchant = "delete-merchant"
+	opPutTerminal    = "put-terminal"
+	opDeleteTerminal = "delete-terminal"
+	opSync           = "sync"
+)
+
+type storeRecord struct {
+	Op         string            `json:"op"`
+	MerchantID string            `json:"merchantId,omitempty"`
+	TerminalID string            `json:"terminalId,omitempty"`
+	Merchant   *MerchantListItem `json:"merchant,omitempty"`
+	Terminal   *TemrinalDetails  `json:"terminalDetails,omitempty"`
+	Time       time.Time         `json:"time,omitempty"`
+}
+
+// FileStore is a Store backed by an append-only file of JSON records, one
+// per line, replayed on open. Compact rewrites the file with the current
+// state only.
+type FileStore struct {
+	*MemoryStore
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	enc  *json.Encoder
+}
+
+// OpenFileStore opens or creates the store file at path.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replay(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("store %s: %w", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.file, s.enc = f, json.NewEncoder(f)
+	return s, nil
+}
+
+// replay applies the records of the file. A torn last record, as left by a
+// crash during an append, is truncated; a bad record before it is an
+// error.
+func (s *FileStore) replay(f *os.File) error {
+	r := bufio.NewReader(f)
+	var good int64
+	var bad error
+	torn := false
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(b) == 0 {
+			break
+		}
+		if bad != nil {
+			return bad
+		}
+		if b[len(b)-1] != '\n' {
+			torn = true
+			break
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			rec := storeRecord{}
+			if err := json.Unmarshal(b, &rec); err != nil {
+				bad, torn = fmt.Errorf("line %d: %w", line, err), true
+				continue
+			}
+			s.apply(rec)
+		}
+		good += int64(len(b))
+	}
+	if torn {
+		return f.Truncate(good)
+	}
+	return nil
+}
+
+func (s *FileStore) apply(rec storeRecord) {
+	switch rec.Op {
+	case opPutMerchant:
+		if rec.Merchant != nil {
+			s.MemoryStore.PutMerchant(*rec.Merchant)
+		}
+	case opDeleteMerchant:
+		s.MemoryStore.DeleteMerchant(rec.MerchantID)
+	case opPutTerminal:
+		if rec.Terminal != nil {
+			s.MemoryStore.PutTerminal(rec.MerchantID, *rec.Terminal)
+		}
+	case opDeleteTerminal:
+		s.MemoryStore.DeleteTerminal(rec.MerchantID, rec.TerminalID)
+	case opSync:
+		s.MemoryStore.SetLastSync(rec.Time)
+	}
+}
+
+func (s *FileStore) append(rec storeRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if err := s.enc.Encode(rec); err != nil {
+		return err
+	}
+	s.apply(rec)
+	return nil
+}
+
+func (s *FileStore) PutMerchant(m MerchantListItem) error {
+	return s.append(storeRecord{Op: opPutMerchant, Merchant: &m})
+}
+
+func (s *FileStore) DeleteMerchant(mid string) error {
+	return s.append(storeRecord{Op: opDeleteMerchant, MerchantID: mid})
+}
+
+func (s *FileStore) PutTerminal(mid string, t TemrinalDetails) error {
+	return s.append(storeRecord{Op: opPutTerminal, MerchantID: mid, Terminal: &t})
+}
+
+func (s *FileStore) DeleteTerminal(mid, tid string) error {
+	return s.append(storeRecord{Op: opDeleteTerminal, MerchantID: mid, TerminalID: tid})
+}
+
+// SetLastSync records a finished sync and flushes the file to disk.
+func (s *FileStore) SetLastSync(t time.Time) error {
+	if err := s.append(storeRecord{Op: opSync, Time: t}); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Compact replaces the log with one record per merchant and terminal.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	merchants, _ := s.MemoryStore.Merchants()
+	terminals, _ := s.MemoryStore.Terminals()
+	last, _ := s.MemoryStore.LastSync()
+	for i := range merchants {
+		if err := enc.Encode(storeRecord{Op: opPutMerchant, Merchant: &merchants[i]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	mids := make([]string, 0, len(terminals))
+	for mid := range terminals {
+		mids = append(mids, mid)
+	}
+	sort.Strings(mids)
+	for _, mid := range mids {
+		for i := range terminals[mid] {
+			if err := enc.Encode(storeRecord{Op: opPutTerminal, MerchantID: mid, Terminal: &terminals[mid][i]}); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if !last.IsZero() {
+		enc.Encode(storeRecord{Op: opSync, Time: last})
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	s.file.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		s.file = nil
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	s.file, s.enc = f, json.NewEncoder(f)
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
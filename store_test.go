@@ -0,0 +1,103 @@
+package softpos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.jsonl")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore error = %v", err)
+	}
+
+	term := TemrinalDetails{TerminalID: "66770050", State: "Active"}
+	synced := time.Date(2022, 3, 28, 9, 0, 0, 0, time.UTC)
+	for _, err := range []error{
+		s.PutMerchant(MerchantListItem{MerchantID: "600086900", State: "Active"}),
+		s.PutMerchant(MerchantListItem{MerchantID: "999700163"}),
+		s.PutTerminal("600086900", term),
+		s.DeleteMerchant("999700163"),
+		s.PutMerchant(MerchantListItem{MerchantID: "600086900", State: "Suspended"}),
+		s.SetLastSync(synced),
+	} {
+		if err != nil {
+			t.Fatalf("write error = %v", err)
+		}
+	}
+	s.Close()
+	if err := s.PutMerchant(MerchantListItem{}); err == nil {
+		t.Error("write after Close succeeded")
+	}
+
+	check := func(s *FileStore) {
+		t.Helper()
+		merchants, _ := s.Merchants()
+		terminals, _ := s.Terminals()
+		last, _ := s.LastSync()
+		if len(merchants) != 1 || merchants[0].State != "Suspended" {
+			t.Errorf("Merchants() = %+v", merchants)
+		}
+		if l := terminals["600086900"]; len(terminals) != 1 || len(l) != 1 || l[0].TerminalID != "66770050" {
+			t.Errorf("Terminals() = %+v", terminals)
+		}
+		if !last.Equal(synced) {
+			t.Errorf("LastSync() = %v", last)
+		}
+	}
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	check(s)
+
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact error = %v", err)
+	}
+	if err := s.DeleteTerminal("600086900", "66770051"); err != nil {
+		t.Fatalf("write after Compact error = %v", err)
+	}
+	s.Close()
+
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 4 {
+		t.Errorf("compacted file has %d records, want 4:\n%s", n, data)
+	}
+	s, _ = OpenFileStore(path)
+	defer s.Close()
+	check(s)
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fleet.jsonl")
+	os.WriteFile(path, []byte("{\"op\":\"sync\"}\nnot json\n{\"op\":\"sync\"}\n"), 0o600)
+	if _, err := OpenFileStore(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("OpenFileStore error = %v, want line 2", err)
+	}
+
+	for _, torn := range []string{`{"op":"put-merch`, "not json\n"} {
+		os.WriteFile(path, []byte(`{"op":"put-merchant","merchant":{"merchantId":"600086900"}}`+"\n"+torn), 0o600)
+		s, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileStore with torn %q error = %v", torn, err)
+		}
+		if err := s.PutMerchant(MerchantListItem{MerchantID: "999700163"}); err != nil {
+			t.Fatalf("write after torn record error = %v", err)
+		}
+		s.Close()
+
+		s, err = OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("reopen error = %v", err)
+		}
+		if merchants, _ := s.Merchants(); len(merchants) != 2 {
+			t.Errorf("Merchants() = %+v, want 2", merchants)
+		}
+		s.Close()
+	}
+}
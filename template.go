@@ -0,0 +1,226 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ProfileTemplate is a standard terminal configuration. Zero fields are
+// not enforced; preferences not listed in the template are left alone.
+type ProfileTemplate struct {
+	Name         string         `json:"name"`
+	Language     string         `json:"language,omitempty"`
+	Currency     int            `json:"currency,omitempty"`
+	InputMethods InputMethods   `json:"inputMethods,omitempty"`
+	Preferences  PreferenceList `json:"preferences,omitempty"`
+}
+
+// FieldChange is a terminal field that differs from the template. Field
+// is the JSON name, with the tag and payment system for preferences, e.g.
+// "preferences[DF8124/VISA]". Old is nil when the field is not set.
+type FieldChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// TemplateDiff lists the changes needed to bring a terminal in line with a
+// template. Patch is the TerminalService.Update body making them.
+type TemplateDiff struct {
+	MerchantID string
+	TerminalID string
+	Reference  string
+	Changes    []FieldChange
+	Patch      map[string]interface{} `json:"-"`
+}
+
+func (d TemplateDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Diff compares the terminal against the template.
+func (p ProfileTemplate) Diff(t *TemrinalDetails) TemplateDiff {
+	d := TemplateDiff{
+		MerchantID: t.Merchant.MerchantID,
+		TerminalID: t.TerminalID,
+		Reference:  t.Reference,
+		Patch:      map[string]interface{}{},
+	}
+
+	if lang := t.terminalLanguage(); p.Language != "" && !strings.EqualFold(p.Language, lang) {
+		d.Changes = append(d.Changes, FieldChange{"language", lang, p.Language})
+		d.Patch["language"] = p.Language
+	}
+	if cur := t.terminalCurrency(); p.Currency != 0 && p.Currency != cur {
+		d.Changes = append(d.Changes, FieldChange{"currency", cur, p.Currency})
+		d.Patch["currency"] = p.Currency
+	}
+	if p.InputMethods != nil && !p.InputMethods.Equal(t.InputMethods) {
+		d.Changes = append(d.Changes, FieldChange{"inputMethods", t.InputMethods, p.InputMethods})
+		d.Patch["inputMethods"] = p.InputMethods
+	}
+
+	merged := append(PreferenceList(nil), t.Preferences...)
+	changed := false
+	for _, want := range p.Preferences {
+		i := merged.index(want.Tag, want.PaymentSystem)
+		if i >= 0 && samePreferenceValue(merged[i], want) {
+			continue
+		}
+
+		field := fmt.Sprintf("preferences[%s/%s]", want.Tag, want.PaymentSystem)
+		if want.PaymentSystem == "" {
+			field = fmt.Sprintf("preferences[%s]", want.Tag)
+		}
+		if i < 0 {
+			d.Changes = append(d.Changes, FieldChange{field, nil, want.Value})
+			merged = append(merged, want)
+		} else {
+			d.Changes = append(d.Changes, FieldChange{field, merged[i].Value, want.Value})
+			merged[i].Value = want.Value
+		}
+		changed = true
+	}
+	if changed {
+		d.Patch["preferences"] = merged
+	}
+
+	if len(d.Patch) == 0 {
+		d.Patch = nil
+	}
+	return d
+}
+
+// index returns the position of the preference set for exactly this
+// payment system, or -1.
+func (l PreferenceList) index(tag, paymentSystem string) int {
+	key := preferenceKey(tag)
+	for i, p := range l {
+		if preferenceKey(p.Tag) == key && strings.EqualFold(p.PaymentSystem, paymentSystem) {
+			return i
+		}
+	}
+	return -1
+}
+
+// samePreferenceValue compares values by their type, so the number 10000
+// equals the n12 string "000000010000".
+func samePreferenceValue(a, b Preferences) bool {
+	switch b.Kind() {
+	case PreferenceAmount, PreferenceNumeric:
+		x, errA := a.Amount(0)
+		y, errB := b.Amount(0)
+		if errA == nil && errB == nil {
+			return x == y
+		}
+	case PreferenceBoolean:
+		x, errA := a.Bool()
+		y, errB := b.Bool()
+		if errA == nil && errB == nil {
+			return x == y
+		}
+	case PreferenceHex:
+		x, errA := a.Bytes()
+		y, errB := b.Bytes()
+		if errA == nil && errB == nil {
+			return bytes.Equal(x, y)
+		}
+	}
+	return fmt.Sprint(a.Value) == fmt.Sprint(b.Value)
+}
+
+func (t *TemrinalDetails) terminalLanguage() string {
+	if t.TerminalLanguage != "" {
+		return t.TerminalLanguage
+	}
+	return t.Language
+}
+
+// TemplatePlan is the dry-run output of a template apply.
+type TemplatePlan struct {
+	Template string
+	Diffs    []TemplateDiff
+}
+
+// Pending returns the diffs that need an update.
+func (p *TemplatePlan) Pending() []TemplateDiff {
+	list := []TemplateDiff{}
+	for _, d := range p.Diffs {
+		if !d.Empty() {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+// WriteText renders the planned changes for review before applying.
+func (p *TemplatePlan) WriteText(w io.Writer) error {
+	pending := p.Pending()
+	fmt.Fprintf(w, "Template %s: %d terminals, %d to update\n\n", p.Template, len(p.Diffs), len(pending))
+	if len(pending) == 0 {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MERCHANT\tTERMINAL\tFIELD\tCURRENT\tTEMPLATE")
+	for _, d := range pending {
+		for _, c := range d.Changes {
+			old := "-"
+			if c.Old != nil {
+				old = fmt.Sprint(c.Old)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\n", d.MerchantID, d.TerminalID, c.Field, old, c.New)
+		}
+	}
+	return tw.Flush()
+}
+
+// ApplyResult is the outcome of updating one terminal.
+type ApplyResult struct {
+	TemplateDiff
+	Err error
+}
+
+// TemplateApplier converges terminals on a template.
+type TemplateApplier struct {
+	client   *Client
+	Template ProfileTemplate
+}
+
+func NewTemplateApplier(client *Client, template ProfileTemplate) *TemplateApplier {
+	return &TemplateApplier{client: client, Template: template}
+}
+
+// Plan diffs the selected terminals against the template without changing
+// anything.
+func (a *TemplateApplier) Plan(terminals []TemrinalDetails) *TemplatePlan {
+	plan := &TemplatePlan{Template: a.Template.Name}
+	for i := range terminals {
+		plan.Diffs = append(plan.Diffs, a.Template.Diff(&terminals[i]))
+	}
+	return plan
+}
+
+// Apply issues one update per terminal that differs, with only the fields
+// that changed. It carries on after a failure; check each result's Err.
+func (a *TemplateApplier) Apply(ctx context.Context, plan *TemplatePlan) []ApplyResult {
+	results := []ApplyResult{}
+	for _, d := range plan.Pending() {
+		res := ApplyResult{TemplateDiff: d}
+		if d.Reference == "" {
+			res.Err = errors.New("terminal has no reference")
+		} else if err := ctx.Err(); err != nil {
+			res.Err = err
+		} else {
+			res.Err = a.client.TerminalService.Update(ctx, d.Reference, d.Patch)
+		}
+		results = append(results, res)
+	}
+	return results
+}
@@ -0,0 +1,122 @@
+package softpos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var kioskTemplate = ProfileTemplate{
+	Name:         "kiosk",
+	Language:     "en",
+	Currency:     634,
+	InputMethods: InputMethods{InputContactless, InputManual},
+	Preferences: PreferenceList{
+		{Tag: "DF8124", Value: 10000.0, PaymentSystem: "VISA"},
+		{Tag: "9F33", Value: "E0F8C8", Type: "Hex"},
+	},
+}
+
+func TestProfileTemplateDiff(t *testing.T) {
+	term := &TemrinalDetails{
+		TerminalID:       "66770050",
+		Reference:        "ref-1",
+		TerminalLanguage: "EN",
+		TerminalCurrency: 634,
+		InputMethods:     InputMethods{InputManual, InputContactless},
+		Preferences: PreferenceList{
+			{Tag: "readerContactlessTransactionLimit", Value: "000000010000", PaymentSystem: "VISA"},
+			{Tag: "9F33", Value: "e0f8c8"},
+			{Tag: "9F1B", Value: 0.0},
+		},
+	}
+	if d := kioskTemplate.Diff(term); !d.Empty() || d.Patch != nil {
+		t.Fatalf("Diff of compliant terminal = %+v", d)
+	}
+
+	term.TerminalLanguage = "ar"
+	term.InputMethods = InputMethods{InputContactless}
+	term.Preferences[0].Value = 50000.0
+	term.Preferences = term.Preferences[:1]
+
+	d := kioskTemplate.Diff(term)
+	fields := []string{}
+	for _, c := range d.Changes {
+		fields = append(fields, c.Field)
+	}
+	if got := strings.Join(fields, ","); got != "language,inputMethods,preferences[DF8124/VISA],preferences[9F33]" {
+		t.Errorf("Diff fields = %s", got)
+	}
+	if _, ok := d.Patch["currency"]; ok {
+		t.Error("Patch includes unchanged currency")
+	}
+	prefs := d.Patch["preferences"].(PreferenceList)
+	if len(prefs) != 2 || prefs[0].Value != 10000.0 || prefs[0].Tag != "readerContactlessTransactionLimit" {
+		t.Errorf("Patch preferences = %+v", prefs)
+	}
+	if term.Preferences[0].Value != 50000.0 {
+		t.Error("Diff modified the terminal")
+	}
+}
+
+func TestTemplateApplierMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	var mu sync.Mutex
+	patched := map[string]map[string]interface{}{}
+	mux.HandleFunc("/terminals/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPatch)
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		patched[strings.TrimPrefix(r.URL.Path, "/terminals/")] = body
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "ref-3") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+
+	terminals := []TemrinalDetails{
+		{TerminalID: "66770050", Reference: "ref-1", Language: "ar", TerminalCurrency: 634, InputMethods: InputMethods{InputContactless, InputManual}},
+		{TerminalID: "66770051", Reference: "ref-2", Language: "en", TerminalCurrency: 634, InputMethods: InputMethods{InputContactless, InputManual},
+			Preferences: PreferenceList{{Tag: "DF8124", Value: 10000.0, PaymentSystem: "VISA"}, {Tag: "9F33", Value: "E0F8C8"}}},
+		{TerminalID: "66770052", Reference: "ref-3", Language: "en", Currency: 840, InputMethods: InputMethods{InputContactless, InputManual},
+			Preferences: PreferenceList{{Tag: "DF8124", Value: 10000.0, PaymentSystem: "VISA"}, {Tag: "9F33", Value: "E0F8C8"}}},
+	}
+
+	a := NewTemplateApplier(c, kioskTemplate)
+	plan := a.Plan(terminals)
+	if n := len(plan.Pending()); n != 2 {
+		t.Fatalf("Pending() = %d, want 2", n)
+	}
+	buf := &bytes.Buffer{}
+	if err := plan.WriteText(buf); err != nil {
+		t.Fatalf("WriteText error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "3 terminals, 2 to update") || !strings.Contains(buf.String(), "66770052  currency") {
+		t.Errorf("WriteText = \n%s", buf.String())
+	}
+	if len(patched) != 0 {
+		t.Fatal("Plan issued updates")
+	}
+
+	results := a.Apply(context.Background(), plan)
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("Apply results = %+v", results)
+	}
+	if _, ok := patched["ref-2"]; ok {
+		t.Error("compliant terminal updated")
+	}
+	if got := fmt.Sprint(patched["ref-3"]); got != "map[currency:634]" {
+		t.Errorf("ref-3 patch = %s", got)
+	}
+	if len(patched["ref-1"]) != 2 {
+		t.Errorf("ref-1 patch = %v", patched["ref-1"])
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type TerminalService service
 
+// DefaultKeysPollInterval is how often WaitForKeysConfirmed checks the
+// terminal unless the client sets another interval.
+const DefaultKeysPollInterval = 2 * time.Second
+
 func (c *TerminalService) GetListByMerchnat(ctx context.Context, mid string, v interface{}) (err error) {
 	path := "merchants/%s/terminals"
 	url := url.URL{Path: fmt.Sprintf(path, mid)}
@@ -29,6 +34,9 @@ func (c *TerminalService) Create(ctx context.Context, mid string, data *Terminal
 	if data == nil {
 		return errors.New("can't create terminal on nil data")
 	}
+	if err := data.InputMethods.Validate(); err != nil {
+		return fmt.Errorf("create terminal: %w", err)
+	}
 
 	req, err := c.client.newRequestCtx(ctx, http.MethodPost, *rel, data)
 	if err != nil {
@@ -42,7 +50,7 @@ func (c *TerminalService) Create(ctx context.Context, mid string, data *Terminal
 	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusCreated {
-		err = json.NewDecoder(res.Body).Decode(v)
+		err = c.client.decode(res, v)
 		if err != nil {
 			return err
 		}
@@ -78,6 +86,9 @@ func (c *TerminalService) Update(ctx context.Context, ref string, data interface
 	if data == nil {
 		return errors.New("can't update on nil data")
 	}
+	if err := validateUpdateInputMethods(data); err != nil {
+		return fmt.Errorf("update terminal: %w", err)
+	}
 
 	req, err := c.client.newRequestCtx(ctx, http.MethodPatch, *rel, data)
 	if err != nil {
@@ -149,3 +160,68 @@ func (c *TerminalService) ChangeStatus(ctx context.Context, mid, tid string, sta
 
 	return err
 }
+
+// GenerateKeys requests new keys for the terminal, rotating the current
+// ones. The new keys are not usable until confirmed with ConfirmKeys.
+func (c *TerminalService) GenerateKeys(ctx context.Context, mid, tid string, data *KeysRequest, v interface{}) (err error) {
+	path := "merchants/%s/terminals/%s/keys"
+	rel := url.URL{Path: fmt.Sprintf(path, mid, tid)}
+	if data == nil {
+		data = &KeysRequest{}
+	}
+	return c.client.send(ctx, "generate terminal keys", http.MethodPost, rel, data, v)
+}
+
+// GetKeys downloads the keys of the terminal.
+func (c *TerminalService) GetKeys(ctx context.Context, mid, tid string, v interface{}) (err error) {
+	path := "merchants/%s/terminals/%s/keys"
+	rel := url.URL{Path: fmt.Sprintf(path, mid, tid)}
+	return c.client.send(ctx, "get terminal keys", http.MethodGet, rel, nil, v)
+}
+
+// ConfirmKeys confirms the keys were installed on the device.
+func (c *TerminalService) ConfirmKeys(ctx context.Context, mid, tid string, data *KeysConfirmation) (err error) {
+	path := "merchants/%s/terminals/%s/keys/confirm"
+	rel := url.URL{Path: fmt.Sprintf(path, mid, tid)}
+	if data == nil {
+		return errors.New("can't confirm keys on nil data")
+	}
+	return c.client.send(ctx, "confirm terminal keys", http.MethodPut, rel, data, nil)
+}
+
+// SetKeysPollInterval sets how often WaitForKeysConfirmed checks the
+// terminal. A non-positive interval restores DefaultKeysPollInterval.
+func (c *Client) SetKeysPollInterval(interval time.Duration) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
+	c.keysPollInterval = interval
+}
+
+// WaitForKeysConfirmed polls the terminal until its keys are confirmed or
+// ctx is done.
+func (c *TerminalService) WaitForKeysConfirmed(ctx context.Context, mid, tid string) (*TemrinalDetails, error) {
+	c.client.clientMu.Lock()
+	interval := c.client.keysPollInterval
+	c.client.clientMu.Unlock()
+	if interval <= 0 {
+		interval = DefaultKeysPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		term := &TemrinalDetails{}
+		if err := c.GetDetailsByMerchant(ctx, mid, tid, term); err != nil {
+			return nil, err
+		}
+		if term.KeysConfirmed {
+			return term, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package softpos
+
+import (
+	"strings"
+
+	"github.com/andrei-cloud/softpos/keys"
+	"github.com/andrei-cloud/softpos/tr31"
+)
+
+// Key value encodings reported in Keys.Encoding.
+const (
+	EncodingLMK  = "LMK"
+	EncodingTR31 = "TR31"
+)
+
+// KeysRequest asks the TMS to generate keys for a terminal. Empty fields
+// let the TMS apply the acquirer defaults.
+type KeysRequest struct {
+	KeyTypes    []string `json:"keyTypes,omitempty"`
+	MasterKeyID string   `json:"masterKeyId,omitempty"`
+}
+
+// KeysConfirmation reports the keys installed on a device by their check
+// values.
+type KeysConfirmation struct {
+	MasterKeyID string            `json:"masterKeyId,omitempty"`
+	Keys        []KeyConfirmation `json:"keys"`
+}
+
+type KeyConfirmation struct {
+	KeyType       string `json:"keyType"`
+	KeyCheckValue string `json:"keyCheckValue"`
+}
+
+// NewKeysConfirmation confirms the keys with the check values the TMS
+// reported for them.
+func NewKeysConfirmation(masterKeyID string, list []Keys) *KeysConfirmation {
+	kc := &KeysConfirmation{MasterKeyID: masterKeyID, Keys: make([]KeyConfirmation, 0, len(list))}
+	for _, k := range list {
+		kc.Keys = append(kc.Keys, KeyConfirmation{KeyType: k.KeyType, KeyCheckValue: k.KeyCheckValue})
+	}
+	return kc
+}
+
+// VerifyKCV checks a clear value of the key against its KeyCheckValue.
+func (k Keys) VerifyKCV(alg keys.Algorithm, clear []byte) error {
+	return keys.Verify(alg, clear, k.KeyCheckValue)
+}
+
+// IsKeyBlock reports whether KeyValue holds a TR-31 key block.
+func (k Keys) IsKeyBlock() bool {
+	switch strings.ToUpper(strings.NewReplacer("-", "", ".", "", " ", "").Replace(k.Encoding)) {
+	case "TR31", "X9143", "KEYBLOCK":
+		return true
+	}
+	return false
+}
+
+// KeyBlock decodes the clear header of a key block value.
+func (k Keys) KeyBlock() (tr31.Header, error) {
+	if !k.IsKeyBlock() {
+		return tr31.Header{}, ErrNotKeyBlock
+	}
+	h, _, err := tr31.ParseHeader(k.KeyValue)
+	return h, err
+}
+
+// UnwrapKeyBlock verifies and decrypts a key block value under the key block
+// protection key.
+func (k Keys) UnwrapKeyBlock(kbpk []byte) (tr31.Header, []byte, error) {
+	if !k.IsKeyBlock() {
+		return tr31.Header{}, nil, ErrNotKeyBlock
+	}
+	return tr31.Unwrap(kbpk, k.KeyValue)
+}
@@ -0,0 +1,55 @@
+package softpos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/andrei-cloud/softpos/keys"
+	"github.com/andrei-cloud/softpos/tr31"
+)
+
+func TestKeysVerifyKCV(t *testing.T) {
+	clear, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+	k := Keys{KeyType: "TMK", Encoding: "LMK", KeyCheckValue: "08D7B4"}
+	if err := k.VerifyKCV(keys.TDES, clear); err != nil {
+		t.Errorf("VerifyKCV error = %v", err)
+	}
+
+	k.KeyCheckValue = "BAA397"
+	if err := k.VerifyKCV(keys.TDES, clear); !errors.Is(err, keys.ErrKCVMismatch) {
+		t.Errorf("VerifyKCV error = %v, want %v", err, keys.ErrKCVMismatch)
+	}
+}
+
+func TestKeysKeyBlock(t *testing.T) {
+	kbpk := bytes.Repeat([]byte{0xAB}, 16)
+	k := Keys{
+		KeyType:  "TPK",
+		Encoding: "TR-31",
+		KeyValue: "B0096P0TE00N0000471D4FBE35E5865BDE20DBF4C15503161F55D681170BF8DD14D01B6822EF8550CB67C569DE8AC048",
+	}
+
+	h, err := k.KeyBlock()
+	if err != nil {
+		t.Fatalf("KeyBlock error = %v", err)
+	}
+	if h.KeyUsage != tr31.UsagePIN {
+		t.Errorf("KeyBlock usage = %v, want %v", h.KeyUsage, tr31.UsagePIN)
+	}
+
+	_, key, err := k.UnwrapKeyBlock(kbpk)
+	if err != nil {
+		t.Fatalf("UnwrapKeyBlock error = %v", err)
+	}
+	if !bytes.Equal(key, bytes.Repeat([]byte{0xCD}, 16)) {
+		t.Errorf("UnwrapKeyBlock key = %X", key)
+	}
+
+	k.Encoding = EncodingLMK
+	if _, err := k.KeyBlock(); !errors.Is(err, ErrNotKeyBlock) {
+		t.Errorf("KeyBlock error = %v, want %v", err, ErrNotKeyBlock)
+	}
+}
@@ -3,12 +3,15 @@ package softpos
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var (
@@ -178,3 +181,114 @@ func TestTerminaltChangeStatusMock(t *testing.T) {
 		t.Errorf("Error occured = %v", err)
 	}
 }
+
+func TestTerminalGenerateKeysMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	c.client.Transport = LoggingRoundTripper{http.DefaultTransport}
+
+	mid := "600086900"
+	tid := "66770050"
+	mux.HandleFunc(fmt.Sprintf("/merchants/%s/terminals/%s/keys", mid, tid), func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			req := KeysRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Error occured = %v", err)
+			}
+			if len(req.KeyTypes) != 1 || req.KeyTypes[0] != "TPK" {
+				t.Errorf("Error occured = want [TPK], got %v", req.KeyTypes)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"masterKeyId":"1"}`)
+		case http.MethodGet:
+			fmt.Fprint(w, `[{"keyType":"TPK","encoding":"LMK","keyValue":"UAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA","keyCheckValue":"083CA1","keyId":1}]`)
+		default:
+			t.Errorf("Request method: %v", r.Method)
+		}
+	})
+
+	res := struct {
+		MasterKeyID string `json:"masterKeyId"`
+	}{}
+	err := c.TerminalService.GenerateKeys(context.Background(), mid, tid, &KeysRequest{KeyTypes: []string{"TPK"}}, &res)
+	if err != nil {
+		t.Errorf("Error occured = %v", err)
+	}
+	if res.MasterKeyID != "1" {
+		t.Errorf("want 1 got = %v", res.MasterKeyID)
+	}
+
+	keys := []Keys{}
+	err = c.TerminalService.GetKeys(context.Background(), mid, tid, &keys)
+	if err != nil {
+		t.Errorf("Error occured = %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyCheckValue != "083CA1" {
+		t.Errorf("Keys = %+v", keys)
+	}
+}
+
+func TestTerminalConfirmKeysMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	c.client.Transport = LoggingRoundTripper{http.DefaultTransport}
+
+	mid := "600086900"
+	tid := "66770050"
+	mux.HandleFunc(fmt.Sprintf("/merchants/%s/terminals/%s/keys/confirm", mid, tid), func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPut)
+		kc := KeysConfirmation{}
+		if err := json.NewDecoder(r.Body).Decode(&kc); err != nil {
+			t.Errorf("Error occured = %v", err)
+		}
+		if len(kc.Keys) != 1 || kc.Keys[0].KeyCheckValue != "083CA1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	confirm := NewKeysConfirmation("0", []Keys{{KeyType: "TPK", KeyCheckValue: "083CA1"}})
+	if err := c.TerminalService.ConfirmKeys(context.Background(), mid, tid, confirm); err != nil {
+		t.Errorf("Error occured = %v", err)
+	}
+
+	confirm.Keys[0].KeyCheckValue = "000000"
+	err := c.TerminalService.ConfirmKeys(context.Background(), mid, tid, confirm)
+	if !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Error occured = %v, want %v", err, ErrIncorrect)
+	}
+}
+
+func TestTerminalWaitForKeysConfirmedMock(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+	c.SetKeysPollInterval(time.Millisecond)
+
+	mid := "600086900"
+	tid := "66770050"
+	var calls int32
+	mux.HandleFunc(fmt.Sprintf("/merchants/%s/terminals/%s", mid, tid), func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"terminalId":"%s","keysConfirmed":%v}`, tid, n == 3)
+	})
+
+	term, err := c.TerminalService.WaitForKeysConfirmed(context.Background(), mid, tid)
+	if err != nil {
+		t.Fatalf("Error occured = %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); !term.KeysConfirmed || n != 3 {
+		t.Errorf("KeysConfirmed = %v after %d calls", term.KeysConfirmed, n)
+	}
+
+	atomic.StoreInt32(&calls, -100)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.TerminalService.WaitForKeysConfirmed(ctx, mid, tid); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error occured = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,139 @@
+package tlv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Names maps common EMV tags to their names and is used by Fprint.
+var Names = map[Tag]string{
+	0x42:     "Issuer Identification Number",
+	0x4F:     "Application Identifier (AID)",
+	0x50:     "Application Label",
+	0x57:     "Track 2 Equivalent Data",
+	0x5A:     "Application PAN",
+	0x61:     "Application Template",
+	0x6F:     "File Control Information (FCI) Template",
+	0x70:     "READ RECORD Response Message Template",
+	0x77:     "Response Message Template Format 2",
+	0x80:     "Response Message Template Format 1",
+	0x82:     "Application Interchange Profile",
+	0x84:     "Dedicated File (DF) Name",
+	0x87:     "Application Priority Indicator",
+	0x88:     "Short File Identifier (SFI)",
+	0x8A:     "Authorisation Response Code",
+	0x8C:     "CDOL1",
+	0x8D:     "CDOL2",
+	0x8E:     "CVM List",
+	0x8F:     "Certification Authority Public Key Index",
+	0x94:     "Application File Locator (AFL)",
+	0x95:     "Terminal Verification Results",
+	0x9A:     "Transaction Date",
+	0x9C:     "Transaction Type",
+	0xA5:     "FCI Proprietary Template",
+	0xBF0C:   "FCI Issuer Discretionary Data",
+	0x5F20:   "Cardholder Name",
+	0x5F24:   "Application Expiration Date",
+	0x5F25:   "Application Effective Date",
+	0x5F28:   "Issuer Country Code",
+	0x5F2A:   "Transaction Currency Code",
+	0x5F2D:   "Language Preference",
+	0x5F34:   "PAN Sequence Number",
+	0x5F36:   "Transaction Currency Exponent",
+	0x9F02:   "Amount, Authorised",
+	0x9F03:   "Amount, Other",
+	0x9F06:   "Application Identifier (AID) - terminal",
+	0x9F07:   "Application Usage Control",
+	0x9F09:   "Application Version Number",
+	0x9F0D:   "Issuer Action Code - Default",
+	0x9F0E:   "Issuer Action Code - Denial",
+	0x9F0F:   "Issuer Action Code - Online",
+	0x9F10:   "Issuer Application Data",
+	0x9F15:   "Merchant Category Code",
+	0x9F16:   "Merchant Identifier",
+	0x9F1A:   "Terminal Country Code",
+	0x9F1B:   "Terminal Floor Limit",
+	0x9F1C:   "Terminal Identification",
+	0x9F1E:   "Interface Device Serial Number",
+	0x9F21:   "Transaction Time",
+	0x9F26:   "Application Cryptogram",
+	0x9F27:   "Cryptogram Information Data",
+	0x9F33:   "Terminal Capabilities",
+	0x9F34:   "CVM Results",
+	0x9F35:   "Terminal Type",
+	0x9F36:   "Application Transaction Counter",
+	0x9F37:   "Unpredictable Number",
+	0x9F38:   "PDOL",
+	0x9F40:   "Additional Terminal Capabilities",
+	0x9F41:   "Transaction Sequence Counter",
+	0x9F4E:   "Merchant Name and Location",
+	0x9F66:   "Terminal Transaction Qualifiers",
+	0x9F6C:   "Card Transaction Qualifiers",
+	0x9F6D:   "Mag-stripe Application Version Number (Reader)",
+	0xDF8117: "Card Data Input Capability",
+	0xDF8118: "CVM Capability - CVM Required",
+	0xDF8119: "CVM Capability - No CVM Required",
+	0xDF811B: "Kernel Configuration",
+	0xDF811F: "Security Capability",
+	0xDF8120: "Terminal Action Code - Default",
+	0xDF8121: "Terminal Action Code - Denial",
+	0xDF8122: "Terminal Action Code - Online",
+	0xDF8123: "Reader Contactless Floor Limit",
+	0xDF8124: "Reader Contactless Transaction Limit (No On-device CVM)",
+	0xDF8125: "Reader Contactless Transaction Limit (On-device CVM)",
+	0xDF8126: "Reader CVM Required Limit",
+}
+
+// Fprint writes an indented dump of the data objects with tag names from
+// Names. Printable values are also shown as text.
+func Fprint(w io.Writer, list List) error {
+	return fprint(w, list, 0)
+}
+
+func fprint(w io.Writer, list List, depth int) error {
+	indent := strings.Repeat("  ", depth)
+	for _, t := range list {
+		name := Names[t.Tag]
+		if name == "" {
+			name = "Unknown"
+		}
+		if t.Tag.Constructed() {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", indent, t.Tag, name); err != nil {
+				return err
+			}
+			if err := fprint(w, t.Children, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line := fmt.Sprintf("%s%s %s: %X", indent, t.Tag, name, t.Value)
+		if printable(t.Value) {
+			line += fmt.Sprintf(" %q", t.Value)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printable(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func (l List) String() string {
+	buf := &bytes.Buffer{}
+	_ = Fprint(buf, l)
+	return buf.String()
+}
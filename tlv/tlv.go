@@ -0,0 +1,241 @@
+// Package tlv encodes and decodes BER-TLV data objects as used by EMV.
+package tlv
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrTruncated error = errors.New("truncated TLV data")
+	ErrTag       error = errors.New("invalid tag")
+	ErrLength    error = errors.New("invalid length")
+	ErrPadding   error = errors.New("padding between data objects")
+)
+
+// Tag is a BER-TLV tag of up to 4 bytes, e.g. 0x9F1B.
+type Tag uint32
+
+// ParseTag parses a hex tag such as "9F1B".
+func ParseTag(s string) (Tag, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) == 0 || len(b) > 4 {
+		return 0, fmt.Errorf("%q: %w", s, ErrTag)
+	}
+	t, n, err := readTag(b)
+	if err != nil || n != len(b) {
+		return 0, fmt.Errorf("%q: %w", s, ErrTag)
+	}
+	return t, nil
+}
+
+func (t Tag) Bytes() []byte {
+	b := []byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)}
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func (t Tag) String() string {
+	return strings.ToUpper(hex.EncodeToString(t.Bytes()))
+}
+
+// Constructed reports whether the tag denotes a template holding other
+// data objects.
+func (t Tag) Constructed() bool {
+	return t.Bytes()[0]&0x20 != 0
+}
+
+// TLV is a data object. Constructed objects hold their decoded content in
+// Children; Value is used for primitive objects.
+type TLV struct {
+	Tag      Tag
+	Value    []byte
+	Children List
+}
+
+// List is a sequence of data objects.
+type List []TLV
+
+// Find returns the first object with the tag, searching templates depth
+// first.
+func (l List) Find(tag Tag) (TLV, bool) {
+	for _, t := range l {
+		if t.Tag == tag {
+			return t, true
+		}
+		if found, ok := t.Children.Find(tag); ok {
+			return found, true
+		}
+	}
+	return TLV{}, false
+}
+
+// Mode controls how strictly data is decoded.
+type Mode int
+
+const (
+	// Strict rejects padding, indefinite and non minimal lengths and
+	// trailing data.
+	Strict Mode = iota
+	// Lenient skips 0x00 and 0xFF padding between objects and accepts non
+	// minimal length encodings.
+	Lenient
+)
+
+// Decode parses BER-TLV data.
+func Decode(data []byte, mode Mode) (List, error) {
+	list := List{}
+	for pos := 0; pos < len(data); {
+		if data[pos] == 0x00 || data[pos] == 0xFF {
+			if mode == Strict {
+				return nil, fmt.Errorf("offset %d: %w", pos, ErrPadding)
+			}
+			pos++
+			continue
+		}
+
+		tag, n, err := readTag(data[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", pos, err)
+		}
+		pos += n
+
+		length, n, err := readLength(data[pos:], mode)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		pos += n
+		if length > len(data)-pos {
+			return nil, fmt.Errorf("tag %s needs %d bytes, %d left: %w", tag, length, len(data)-pos, ErrTruncated)
+		}
+
+		obj := TLV{Tag: tag, Value: data[pos : pos+length]}
+		if tag.Constructed() {
+			if obj.Children, err = Decode(obj.Value, mode); err != nil {
+				return nil, fmt.Errorf("template %s: %w", tag, err)
+			}
+		}
+		list = append(list, obj)
+		pos += length
+	}
+	return list, nil
+}
+
+// DecodeHex parses hex encoded BER-TLV data.
+func DecodeHex(s string, mode Mode) (List, error) {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, err
+	}
+	return Decode(b, mode)
+}
+
+func readTag(b []byte) (Tag, int, error) {
+	if len(b) == 0 {
+		return 0, 0, ErrTruncated
+	}
+	t := Tag(b[0])
+	n := 1
+	if b[0]&0x1F == 0x1F {
+		for {
+			if n >= len(b) {
+				return 0, 0, ErrTruncated
+			}
+			if n == 4 {
+				return 0, 0, ErrTag
+			}
+			t = t<<8 | Tag(b[n])
+			n++
+			if b[n-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	return t, n, nil
+}
+
+func readLength(b []byte, mode Mode) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, ErrTruncated
+	}
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+	n := int(b[0] & 0x7F)
+	if n == 0 || n > 3 {
+		return 0, 0, fmt.Errorf("length form %#02x: %w", b[0], ErrLength)
+	}
+	if len(b) < 1+n {
+		return 0, 0, ErrTruncated
+	}
+	length := 0
+	for _, c := range b[1 : 1+n] {
+		length = length<<8 | int(c)
+	}
+	if mode == Strict && (length < 0x80 || b[1] == 0) {
+		return 0, 0, fmt.Errorf("non minimal length %d: %w", length, ErrLength)
+	}
+	return length, 1 + n, nil
+}
+
+// Encode serializes data objects. Constructed objects with Children are
+// encoded from them, otherwise from Value.
+func Encode(list ...TLV) ([]byte, error) {
+	out := []byte{}
+	for _, t := range list {
+		b, err := t.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// Bytes serializes the data object.
+func (t TLV) Bytes() ([]byte, error) {
+	if _, n, err := readTag(t.Tag.Bytes()); err != nil || n != len(t.Tag.Bytes()) || t.Tag == 0 {
+		return nil, fmt.Errorf("%s: %w", t.Tag, ErrTag)
+	}
+
+	value := t.Value
+	if len(t.Children) > 0 {
+		if !t.Tag.Constructed() {
+			return nil, fmt.Errorf("children in primitive tag %s: %w", t.Tag, ErrTag)
+		}
+		var err error
+		if value, err = Encode(t.Children...); err != nil {
+			return nil, err
+		}
+	}
+	if len(value) > 0xFFFFFF {
+		return nil, fmt.Errorf("tag %s: %w", t.Tag, ErrLength)
+	}
+
+	out := append([]byte{}, t.Tag.Bytes()...)
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xFFFF:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, value...), nil
+}
+
+// New returns a primitive data object.
+func New(tag Tag, value []byte) TLV {
+	return TLV{Tag: tag, Value: value}
+}
+
+// NewTemplate returns a constructed data object.
+func NewTemplate(tag Tag, children ...TLV) TLV {
+	return TLV{Tag: tag, Children: children}
+}
@@ -0,0 +1,152 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+const fci = "6F1D840E315041592E5359532E4444463031A50B880102BF0C059F4D020B0A"
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Tag
+		wantErr bool
+	}{
+		{"5A", 0x5A, false},
+		{"9F1B", 0x9F1B, false},
+		{"df8124", 0xDF8124, false},
+		{"9F", 0, true},
+		{"5A01", 0, true},
+		{"zz", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTag(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTag(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+	if !Tag(0xBF0C).Constructed() || Tag(0x9F1B).Constructed() {
+		t.Error("Constructed() mismatch")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	list, err := DecodeHex(fci, Strict)
+	if err != nil {
+		t.Fatalf("DecodeHex error = %v", err)
+	}
+	if len(list) != 1 || list[0].Tag != 0x6F || len(list[0].Children) != 2 {
+		t.Fatalf("DecodeHex = %+v", list)
+	}
+	df, ok := list.Find(0x84)
+	if !ok || string(df.Value) != "1PAY.SYS.DDF01" {
+		t.Errorf("Find(84) = %+v, %v", df, ok)
+	}
+	if _, ok := list.Find(0xBF0C); !ok {
+		t.Error("Find(BF0C) not found")
+	}
+	if _, ok := list.Find(0x5A); ok {
+		t.Error("Find(5A) found")
+	}
+}
+
+func TestDecodeLongLength(t *testing.T) {
+	value := bytes.Repeat([]byte{0xAB}, 300)
+	data := append(unhex("7082012C"), value...)
+	list, err := Decode(data, Strict)
+	if err == nil {
+		t.Fatalf("Decode of non TLV content in template succeeded: %+v", list)
+	}
+
+	data = append(unhex("9F4E82012C"), value...)
+	list, err = Decode(data, Strict)
+	if err != nil || len(list) != 1 || !bytes.Equal(list[0].Value, value) {
+		t.Fatalf("Decode = %+v, %v", list, err)
+	}
+}
+
+func TestDecodeModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		strict  error
+		lenient error
+	}{
+		{"padding", "5A0212340000", ErrPadding, nil},
+		{"non minimal length", "5A81021234", ErrLength, nil},
+		{"indefinite length", "5A801234", ErrLength, ErrLength},
+		{"truncated value", "5A051234", ErrTruncated, ErrTruncated},
+		{"truncated tag", "9F", ErrTruncated, ErrTruncated},
+		{"long tag", "9F818181010100", ErrTag, ErrTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeHex(tt.in, Strict); !errors.Is(err, tt.strict) || err == nil && tt.strict != nil {
+				t.Errorf("Strict error = %v, want %v", err, tt.strict)
+			}
+			_, err := DecodeHex(tt.in, Lenient)
+			if tt.lenient == nil && err != nil || tt.lenient != nil && !errors.Is(err, tt.lenient) {
+				t.Errorf("Lenient error = %v, want %v", err, tt.lenient)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	list := List{
+		NewTemplate(0x6F,
+			New(0x84, []byte("1PAY.SYS.DDF01")),
+			NewTemplate(0xA5,
+				New(0x88, []byte{0x02}),
+				NewTemplate(0xBF0C, New(0x61, nil), New(0x9F, nil)),
+			),
+		),
+	}
+	if _, err := Encode(list...); !errors.Is(err, ErrTag) {
+		t.Errorf("Encode with bad tag error = %v, want %v", err, ErrTag)
+	}
+
+	decoded, _ := DecodeHex(fci, Strict)
+	b, err := Encode(decoded...)
+	if err != nil || !bytes.Equal(b, unhex(fci)) {
+		t.Errorf("Encode = %X, %v", b, err)
+	}
+
+	b, err = New(0x9F4E, bytes.Repeat([]byte{'A'}, 200)).Bytes()
+	if err != nil || !bytes.Equal(b[:4], unhex("9F4E81C8")) {
+		t.Errorf("Bytes() = %X, %v", b[:4], err)
+	}
+	if _, err := New(0x5A, nil).Bytes(); err != nil {
+		t.Errorf("Bytes() of empty value error = %v", err)
+	}
+	if _, err := NewTemplate(0x5A, New(0x84, nil)).Bytes(); !errors.Is(err, ErrTag) {
+		t.Errorf("children in primitive error = %v, want %v", err, ErrTag)
+	}
+}
+
+func TestFprint(t *testing.T) {
+	list, _ := DecodeHex(fci, Strict)
+	out := list.String()
+	for _, want := range []string{
+		"6F File Control Information (FCI) Template\n",
+		"  84 Dedicated File (DF) Name: 315041592E5359532E4444463031 \"1PAY.SYS.DDF01\"\n",
+		"    88 Short File Identifier (SFI): 02\n",
+		"    BF0C FCI Issuer Discretionary Data\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("String() missing %q in\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+// Package tr31 parses, builds and unwraps TR-31 (ANSI X9.143) key blocks of
+// version B (TDES key derivation binding) and D (AES key derivation binding).
+package tr31
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andrei-cloud/softpos/keys"
+)
+
+var (
+	ErrFormat      error = errors.New("malformed key block")
+	ErrVersion     error = errors.New("unsupported key block version")
+	ErrMAC         error = errors.New("key block MAC verification failed")
+	ErrKBPK        error = errors.New("invalid key block protection key")
+	ErrKeyLength   error = errors.New("invalid wrapped key length")
+	ErrHeaderField error = errors.New("invalid key block header field")
+)
+
+const (
+	VersionB byte = 'B'
+	VersionD byte = 'D'
+)
+
+// Key usages defined by ANSI X9.143.
+const (
+	UsageBDK         = "B0"
+	UsageIPEK        = "B1"
+	UsageCVK         = "C0"
+	UsageData        = "D0"
+	UsageIV          = "I0"
+	UsageKEK         = "K0"
+	UsageKBPK        = "K1"
+	UsageMACGeneric  = "M0"
+	UsageMACISO9797  = "M1"
+	UsageMACCMAC     = "M6"
+	UsagePIN         = "P0"
+	UsagePINVerify   = "V0"
+	UsagePINVerifyIB = "V1"
+)
+
+// Key algorithms.
+const (
+	AlgorithmAES  byte = 'A'
+	AlgorithmDES  byte = 'D'
+	AlgorithmTDES byte = 'T'
+	AlgorithmHMAC byte = 'H'
+)
+
+// Modes of use.
+const (
+	ModeEncDec  byte = 'B'
+	ModeMACBoth byte = 'C'
+	ModeDecrypt byte = 'D'
+	ModeEncrypt byte = 'E'
+	ModeMACGen  byte = 'G'
+	ModeNone    byte = 'N'
+	ModeSign    byte = 'S'
+	ModeVerify  byte = 'V'
+	ModeDerive  byte = 'X'
+	ModeVariant byte = 'Y'
+)
+
+// Exportability.
+const (
+	ExportTrusted   byte = 'E'
+	ExportNone      byte = 'N'
+	ExportSensitive byte = 'S'
+)
+
+const headerLen = 16
+
+// Header is the clear part of a key block.
+type Header struct {
+	VersionID     byte
+	KeyUsage      string
+	Algorithm     byte
+	ModeOfUse     byte
+	KeyVersion    string
+	Exportability byte
+	// Blocks are the optional header blocks. The padding block "PB" is
+	// handled internally and never appears here.
+	Blocks []OptionalBlock
+}
+
+type OptionalBlock struct {
+	ID   string
+	Data string
+}
+
+// Block returns the data of the optional block with the given ID.
+func (h Header) Block(id string) (string, bool) {
+	for _, b := range h.Blocks {
+		if b.ID == id {
+			return b.Data, true
+		}
+	}
+	return "", false
+}
+
+func (h Header) blockSize() (int, error) {
+	switch h.VersionID {
+	case VersionB:
+		return 8, nil
+	case VersionD:
+		return 16, nil
+	}
+	return 0, fmt.Errorf("%q: %w", h.VersionID, ErrVersion)
+}
+
+func (h Header) macLen() int {
+	if h.VersionID == VersionD {
+		return 16
+	}
+	return 8
+}
+
+// encode renders the header with the given total key block length,
+// including a padding block when needed.
+func (h Header) encode(total int) (string, error) {
+	bs, err := h.blockSize()
+	if err != nil {
+		return "", err
+	}
+	if len(h.KeyUsage) != 2 || !printable(h.KeyUsage) {
+		return "", fmt.Errorf("key usage %q: %w", h.KeyUsage, ErrHeaderField)
+	}
+	kv := h.KeyVersion
+	if kv == "" {
+		kv = "00"
+	}
+	if len(kv) != 2 || !printable(kv) {
+		return "", fmt.Errorf("key version %q: %w", kv, ErrHeaderField)
+	}
+	for _, c := range []byte{h.Algorithm, h.ModeOfUse, h.Exportability} {
+		if !printable(string(c)) {
+			return "", fmt.Errorf("%q: %w", c, ErrHeaderField)
+		}
+	}
+
+	var opt strings.Builder
+	for _, b := range h.Blocks {
+		if len(b.ID) != 2 || b.ID == "PB" || !printable(b.ID) || !printable(b.Data) {
+			return "", fmt.Errorf("optional block %q: %w", b.ID, ErrHeaderField)
+		}
+		n := 4 + len(b.Data)
+		if n <= 0xFF {
+			fmt.Fprintf(&opt, "%s%02X%s", b.ID, n, b.Data)
+		} else {
+			fmt.Fprintf(&opt, "%s0004%04X%s", b.ID, n+6, b.Data)
+		}
+	}
+	count := len(h.Blocks)
+	if opt.Len() > 0 {
+		if rem := (headerLen + opt.Len()) % bs; rem != 0 {
+			pad := bs - rem
+			if pad < 4 {
+				pad += bs
+			}
+			fmt.Fprintf(&opt, "PB%02X%s", pad, strings.Repeat("0", pad-4))
+			count++
+		}
+	}
+	if total > 9999 || count > 99 {
+		return "", fmt.Errorf("key block too long: %w", ErrFormat)
+	}
+
+	return fmt.Sprintf("%c%04d%s%c%c%s%c%02d00%s",
+		h.VersionID, total, h.KeyUsage, h.Algorithm, h.ModeOfUse, kv, h.Exportability, count, opt.String()), nil
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseHeader decodes the clear header of a key block and returns it along
+// with the length of the encoded header.
+func ParseHeader(kb string) (Header, int, error) {
+	h := Header{}
+	if len(kb) < headerLen || !printable(kb) {
+		return h, 0, ErrFormat
+	}
+
+	h.VersionID = kb[0]
+	bs, err := h.blockSize()
+	if err != nil {
+		return h, 0, err
+	}
+	total, err := strconv.Atoi(kb[1:5])
+	if err != nil || total != len(kb) {
+		return h, 0, fmt.Errorf("length %q for %d characters: %w", kb[1:5], len(kb), ErrFormat)
+	}
+	h.KeyUsage = kb[5:7]
+	h.Algorithm = kb[7]
+	h.ModeOfUse = kb[8]
+	h.KeyVersion = kb[9:11]
+	h.Exportability = kb[11]
+	count, err := strconv.Atoi(kb[12:14])
+	if err != nil {
+		return h, 0, fmt.Errorf("optional blocks %q: %w", kb[12:14], ErrFormat)
+	}
+
+	pos := headerLen
+	for i := 0; i < count; i++ {
+		if pos+4 > len(kb) {
+			return h, 0, fmt.Errorf("optional block %d: %w", i+1, ErrFormat)
+		}
+		id := kb[pos : pos+2]
+		n, err := strconv.ParseUint(kb[pos+2:pos+4], 16, 8)
+		if err != nil {
+			return h, 0, fmt.Errorf("optional block %s: %w", id, ErrFormat)
+		}
+		start := pos + 4
+		if n == 0 {
+			// extended length: length of length followed by the length
+			if pos+6 > len(kb) {
+				return h, 0, fmt.Errorf("optional block %s: %w", id, ErrFormat)
+			}
+			ll, err := strconv.ParseUint(kb[pos+4:pos+6], 16, 8)
+			if err != nil || pos+6+int(ll) > len(kb) {
+				return h, 0, fmt.Errorf("optional block %s: %w", id, ErrFormat)
+			}
+			n, err = strconv.ParseUint(kb[pos+6:pos+6+int(ll)], 16, 32)
+			if err != nil {
+				return h, 0, fmt.Errorf("optional block %s: %w", id, ErrFormat)
+			}
+			start = pos + 6 + int(ll)
+		}
+		end := pos + int(n)
+		if end < start || end > len(kb) {
+			return h, 0, fmt.Errorf("optional block %s: %w", id, ErrFormat)
+		}
+		if id != "PB" {
+			h.Blocks = append(h.Blocks, OptionalBlock{ID: id, Data: kb[start:end]})
+		}
+		pos = end
+	}
+	if pos%bs != 0 {
+		return h, 0, fmt.Errorf("header length %d: %w", pos, ErrFormat)
+	}
+	return h, pos, nil
+}
+
+// deriveKeys derives the key block encryption and MAC keys from the KBPK.
+func deriveKeys(version byte, kbpk []byte) (enc, mac []byte, err error) {
+	var alg keys.Algorithm
+	var indicator uint16
+	switch {
+	case version == VersionB && len(kbpk) == 16:
+		alg, indicator = keys.TDES, 0x0000
+	case version == VersionB && len(kbpk) == 24:
+		alg, indicator = keys.TDES, 0x0001
+	case version == VersionD && len(kbpk) == 16:
+		alg, indicator = keys.AES, 0x0002
+	case version == VersionD && len(kbpk) == 24:
+		alg, indicator = keys.AES, 0x0003
+	case version == VersionD && len(kbpk) == 32:
+		alg, indicator = keys.AES, 0x0004
+	default:
+		return nil, nil, fmt.Errorf("%d byte KBPK for version %c: %w", len(kbpk), version, ErrKBPK)
+	}
+
+	b, err := keys.NewCipher(alg, kbpk)
+	if err != nil {
+		return nil, nil, err
+	}
+	derive := func(usage uint16) []byte {
+		bits := len(kbpk) * 8
+		out := make([]byte, 0, len(kbpk)+b.BlockSize())
+		data := make([]byte, 8)
+		for counter := byte(1); len(out) < len(kbpk); counter++ {
+			data[0] = counter
+			data[1], data[2] = byte(usage>>8), byte(usage)
+			data[3] = 0
+			data[4], data[5] = byte(indicator>>8), byte(indicator)
+			data[6], data[7] = byte(bits>>8), byte(bits)
+			out = append(out, keys.CMAC(b, data)...)
+		}
+		return out[:len(kbpk)]
+	}
+	return derive(0x0000), derive(0x0001), nil
+}
+
+func cipherFor(version byte, key []byte) (cipher.Block, error) {
+	if version == VersionD {
+		return keys.NewCipher(keys.AES, key)
+	}
+	return keys.NewCipher(keys.TDES, key)
+}
+
+// maxKeyLen is the length keys are padded to so the block does not reveal
+// the actual key length.
+func maxKeyLen(algorithm byte, keyLen int) int {
+	switch algorithm {
+	case AlgorithmTDES, AlgorithmDES:
+		if keyLen < 24 {
+			return 24
+		}
+	case AlgorithmAES:
+		if keyLen < 32 {
+			return 32
+		}
+	}
+	return keyLen
+}
+
+// Wrap builds a key block protecting key under kbpk. Padding is read from
+// rand.
+func Wrap(kbpk []byte, h Header, key []byte, rand io.Reader) (string, error) {
+	bs, err := h.blockSize()
+	if err != nil {
+		return "", err
+	}
+	if len(key) == 0 || len(key) > 0xFFFF/8 {
+		return "", ErrKeyLength
+	}
+	encKey, macKey, err := deriveKeys(h.VersionID, kbpk)
+	if err != nil {
+		return "", err
+	}
+
+	n := 2 + maxKeyLen(h.Algorithm, len(key))
+	n += (bs - n%bs) % bs
+	data := make([]byte, n)
+	data[0], data[1] = byte(len(key)*8>>8), byte(len(key)*8)
+	copy(data[2:], key)
+	if _, err := io.ReadFull(rand, data[2+len(key):]); err != nil {
+		return "", err
+	}
+
+	// header length does not depend on the total, so encode it twice
+	hdr, err := h.encode(0)
+	if err != nil {
+		return "", err
+	}
+	total := len(hdr) + 2*n + 2*h.macLen()
+	if hdr, err = h.encode(total); err != nil {
+		return "", err
+	}
+
+	mac, err := computeMAC(h.VersionID, macKey, hdr, data)
+	if err != nil {
+		return "", err
+	}
+	b, err := cipherFor(h.VersionID, encKey)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCEncrypter(b, mac[:bs]).CryptBlocks(data, data)
+
+	return hdr + strings.ToUpper(hex.EncodeToString(data)+hex.EncodeToString(mac)), nil
+}
+
+// Unwrap verifies the MAC of a key block and returns its header and the
+// clear key.
+func Unwrap(kbpk []byte, kb string) (Header, []byte, error) {
+	h, n, err := ParseHeader(kb)
+	if err != nil {
+		return h, nil, err
+	}
+	bs, _ := h.blockSize()
+	macHex := 2 * h.macLen()
+	if len(kb)-n < macHex+2*bs {
+		return h, nil, fmt.Errorf("no key data: %w", ErrFormat)
+	}
+
+	data, err := hex.DecodeString(kb[n : len(kb)-macHex])
+	if err != nil || len(data)%bs != 0 {
+		return h, nil, fmt.Errorf("key data: %w", ErrFormat)
+	}
+	mac, err := hex.DecodeString(kb[len(kb)-macHex:])
+	if err != nil {
+		return h, nil, fmt.Errorf("MAC: %w", ErrFormat)
+	}
+
+	encKey, macKey, err := deriveKeys(h.VersionID, kbpk)
+	if err != nil {
+		return h, nil, err
+	}
+	b, err := cipherFor(h.VersionID, encKey)
+	if err != nil {
+		return h, nil, err
+	}
+	cipher.NewCBCDecrypter(b, mac[:bs]).CryptBlocks(data, data)
+
+	want, err := computeMAC(h.VersionID, macKey, kb[:n], data)
+	if err != nil {
+		return h, nil, err
+	}
+	if subtle.ConstantTimeCompare(mac, want) != 1 {
+		return h, nil, ErrMAC
+	}
+
+	bits := int(data[0])<<8 | int(data[1])
+	if bits%8 != 0 || 2+bits/8 > len(data) {
+		return h, nil, ErrKeyLength
+	}
+	return h, data[2 : 2+bits/8], nil
+}
+
+func computeMAC(version byte, macKey []byte, header string, data []byte) ([]byte, error) {
+	b, err := cipherFor(version, macKey)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 0, len(header)+len(data))
+	msg = append(append(msg, header...), data...)
+	mac := keys.CMAC(b, msg)
+	if version == VersionD {
+		return mac, nil
+	}
+	return mac[:8], nil
+}
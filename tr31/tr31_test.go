@@ -0,0 +1,158 @@
+package tr31
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnwrapVersionB(t *testing.T) {
+	kbpk := bytes.Repeat([]byte{0xAB}, 16)
+	kb := "B0096P0TE00N0000471D4FBE35E5865BDE20DBF4C15503161F55D681170BF8DD14D01B6822EF8550CB67C569DE8AC048"
+
+	h, key, err := Unwrap(kbpk, kb)
+	if err != nil {
+		t.Fatalf("Unwrap error = %v", err)
+	}
+	if !bytes.Equal(key, bytes.Repeat([]byte{0xCD}, 16)) {
+		t.Errorf("Unwrap key = %X", key)
+	}
+	if h.KeyUsage != UsagePIN || h.Algorithm != AlgorithmTDES || h.ModeOfUse != ModeEncrypt || h.Exportability != ExportNone {
+		t.Errorf("Unwrap header = %+v", h)
+	}
+
+	tampered := kb[:len(kb)-1] + "9"
+	if _, _, err := Unwrap(kbpk, tampered); !errors.Is(err, ErrMAC) {
+		t.Errorf("Unwrap tampered error = %v, want %v", err, ErrMAC)
+	}
+	if _, _, err := Unwrap(bytes.Repeat([]byte{0xAC}, 16), kb); !errors.Is(err, ErrMAC) {
+		t.Errorf("Unwrap wrong KBPK error = %v, want %v", err, ErrMAC)
+	}
+}
+
+func TestUnwrapPublishedVersionB(t *testing.T) {
+	// ANSI X9.143 version B example.
+	kbpk, _ := hex.DecodeString("DD7515F2BFC17F85CE48F3CA25CB21F6")
+	kb := "B0080P0TE00E000094B420079CC80BA3461F86FE26EFC4A3B8E4FA4C5F5341176EED7B727B8A248E"
+
+	h, key, err := Unwrap(kbpk, kb)
+	if err != nil {
+		t.Fatalf("Unwrap error = %v", err)
+	}
+	if want, _ := hex.DecodeString("3F419E1CB7079442AA37474C2EFBF8B8"); !bytes.Equal(key, want) {
+		t.Errorf("Unwrap key = %X, want %X", key, want)
+	}
+	if h.KeyUsage != UsagePIN || h.Algorithm != AlgorithmTDES || h.ModeOfUse != ModeEncrypt || h.Exportability != ExportTrusted {
+		t.Errorf("Unwrap header = %+v", h)
+	}
+}
+
+func TestUnwrapVersionD(t *testing.T) {
+	// ANSI X9.143 version D example.
+	kbpk, _ := hex.DecodeString("88E1AB2A2E3DD38C1FA039A536500CC8A87AB9D62DC92C01058FA79F44657DE6")
+	kb := "D0112P0AE00E0000B82679114F470F540165EDFBF7E250FCEA43F810D215F8D207E2E417C07156A27E8E31DA05F7425509593D03A457DC34"
+
+	h, key, err := Unwrap(kbpk, kb)
+	if err != nil {
+		t.Fatalf("Unwrap error = %v", err)
+	}
+	if want, _ := hex.DecodeString("3F419E1CB7079442AA37474C2EFBF8B8"); !bytes.Equal(key, want) {
+		t.Errorf("Unwrap key = %X, want %X", key, want)
+	}
+	if h.KeyUsage != UsagePIN || h.Algorithm != AlgorithmAES || h.ModeOfUse != ModeEncrypt {
+		t.Errorf("Unwrap header = %+v", h)
+	}
+}
+
+func TestWrapRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		kbpk []byte
+		h    Header
+		key  []byte
+		len  int
+	}{
+		{
+			"B TDES", bytes.Repeat([]byte{0x11}, 24),
+			Header{VersionID: VersionB, KeyUsage: UsageKEK, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncDec, Exportability: ExportTrusted},
+			bytes.Repeat([]byte{0x22}, 16), 96,
+		},
+		{
+			"D AES-128", bytes.Repeat([]byte{0x33}, 32),
+			Header{VersionID: VersionD, KeyUsage: UsagePIN, Algorithm: AlgorithmAES, ModeOfUse: ModeEncrypt, Exportability: ExportTrusted},
+			bytes.Repeat([]byte{0x44}, 16), 144,
+		},
+		{
+			"D with blocks", bytes.Repeat([]byte{0x55}, 16),
+			Header{VersionID: VersionD, KeyUsage: UsageBDK, Algorithm: AlgorithmAES, ModeOfUse: ModeDerive, KeyVersion: "01", Exportability: ExportNone,
+				Blocks: []OptionalBlock{{ID: "KS", Data: "00604B120F9292800000"}, {ID: "DA", Data: strings.Repeat("X", 300)}}},
+			bytes.Repeat([]byte{0x66}, 32), 0,
+		},
+	}
+
+	for _, tt := range tests {
+		kb, err := Wrap(tt.kbpk, tt.h, tt.key, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s: Wrap error = %v", tt.name, err)
+		}
+		if tt.len != 0 && len(kb) != tt.len {
+			t.Errorf("%s: Wrap length = %d, want %d", tt.name, len(kb), tt.len)
+		}
+
+		h, key, err := Unwrap(tt.kbpk, kb)
+		if err != nil {
+			t.Fatalf("%s: Unwrap error = %v", tt.name, err)
+		}
+		if !bytes.Equal(key, tt.key) {
+			t.Errorf("%s: Unwrap key = %X, want %X", tt.name, key, tt.key)
+		}
+		if len(h.Blocks) != len(tt.h.Blocks) {
+			t.Fatalf("%s: Unwrap blocks = %+v", tt.name, h.Blocks)
+		}
+		for _, b := range tt.h.Blocks {
+			if got, ok := h.Block(b.ID); !ok || got != b.Data {
+				t.Errorf("%s: Block(%s) = %q, want %q", tt.name, b.ID, got, b.Data)
+			}
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	h, n, err := ParseHeader("D0048P0AE00E0200KS0E00604B120FPB12" + strings.Repeat("0", 14))
+	if err != nil {
+		t.Fatalf("ParseHeader error = %v", err)
+	}
+	if n != 48 {
+		t.Errorf("ParseHeader length = %d", n)
+	}
+	if ks, _ := h.Block("KS"); ks != "00604B120F" {
+		t.Errorf("Block(KS) = %q", ks)
+	}
+
+	bad := []string{
+		"",
+		"C0016P0AE00E0000",
+		"B0017P0TE00E0000",
+		"B0016P0TE00EXX00",
+		"B0024P0TE00E0100KS0F0000",
+	}
+	for _, kb := range bad {
+		if _, _, err := ParseHeader(kb); err == nil {
+			t.Errorf("ParseHeader(%q) error = nil", kb)
+		}
+	}
+}
+
+func TestWrapInvalid(t *testing.T) {
+	h := Header{VersionID: VersionB, KeyUsage: UsagePIN, Algorithm: AlgorithmTDES, ModeOfUse: ModeEncrypt, Exportability: ExportTrusted}
+	if _, err := Wrap(make([]byte, 32), h, make([]byte, 16), rand.Reader); !errors.Is(err, ErrKBPK) {
+		t.Errorf("Wrap error = %v, want %v", err, ErrKBPK)
+	}
+	h.KeyUsage = "P"
+	if _, err := Wrap(make([]byte, 16), h, make([]byte, 16), rand.Reader); !errors.Is(err, ErrHeaderField) {
+		t.Errorf("Wrap error = %v, want %v", err, ErrHeaderField)
+	}
+}
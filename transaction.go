@@ -0,0 +1,193 @@
+package softpos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type TransactionService service
+
+// Transaction types.
+const (
+	TransactionSale   = "Sale"
+	TransactionRefund = "Refund"
+	TransactionVoid   = "Void"
+)
+
+// Transaction statuses.
+const (
+	TransactionApproved          = "Approved"
+	TransactionDeclined          = "Declined"
+	TransactionVoided            = "Voided"
+	TransactionRefunded          = "Refunded"
+	TransactionPartiallyRefunded = "PartiallyRefunded"
+)
+
+// Transaction is a card payment, or a refund or void of one. Amounts are
+// in Currency; the wire format carries minor units.
+type Transaction struct {
+	Reference         string    `json:"reference"`
+	OriginalReference string    `json:"originalReference,omitempty"`
+	MerchantID        string    `json:"merchantId"`
+	TerminalID        string    `json:"terminalId"`
+	BatchRef          string    `json:"batchRef"`
+	Type              string    `json:"type"`
+	Status            string    `json:"status"`
+	Amount            Money     `json:"amount"`
+	RefundedAmount    Money     `json:"refundedAmount"`
+	Currency          int       `json:"currency"`
+	Scheme            string    `json:"scheme"`
+	MaskedPAN         string    `json:"maskedPan"`
+	AuthCode          string    `json:"authCode"`
+	RRN               string    `json:"rrn"`
+	ResponseCode      string    `json:"responseCode"`
+	Settled           bool      `json:"settled"`
+	Created           time.Time `json:"created"`
+}
+
+// UnmarshalJSON sets the currency of the amounts from the currency field.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type plain Transaction
+	if err := json.Unmarshal(data, (*plain)(t)); err != nil {
+		return err
+	}
+	t.Amount.Currency = t.Currency
+	t.RefundedAmount.Currency = t.Currency
+	return nil
+}
+
+// Refundable is the amount that can still be refunded.
+func (t *Transaction) Refundable() Money {
+	m := Money{Amount: t.Amount.Amount - t.RefundedAmount.Amount, Currency: t.Currency}
+	if m.IsNegative() {
+		m.Amount = 0
+	}
+	return m
+}
+
+type TransactionList struct {
+	Index      int           `json:"index"`
+	TotalPages int           `json:"totalPages"`
+	Count      int           `json:"count"`
+	TotalCount int           `json:"totalCount"`
+	PerPage    int           `json:"perPage"`
+	Offset     int           `json:"offset"`
+	Items      []Transaction `json:"items"`
+}
+
+// TransactionFilter selects transactions to list. Zero fields are not
+// filtered on. Amounts are in minor units; MaskedPAN matches either a
+// masked PAN such as "411111******1111" or its last four digits.
+type TransactionFilter struct {
+	MerchantID string
+	TerminalID string
+	BatchRef   string
+	From       time.Time
+	To         time.Time
+	MinAmount  int64
+	MaxAmount  int64
+	Status     string
+	Type       string
+	Scheme     string
+	MaskedPAN  string
+
+	Page    int
+	PerPage int
+}
+
+func (f *TransactionFilter) validate() error {
+	switch {
+	case !f.From.IsZero() && !f.To.IsZero() && f.From.After(f.To):
+		return errors.New("transaction filter: from is after to")
+	case f.MaxAmount != 0 && f.MinAmount > f.MaxAmount:
+		return errors.New("transaction filter: min amount is above max amount")
+	case f.Page < 0 || f.PerPage < 0:
+		return errors.New("transaction filter: negative page")
+	}
+	return nil
+}
+
+func (f *TransactionFilter) values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("merchantId", f.MerchantID)
+	set("terminalId", f.TerminalID)
+	set("batchRef", f.BatchRef)
+	if !f.From.IsZero() {
+		v.Set("from", f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		v.Set("to", f.To.UTC().Format(time.RFC3339))
+	}
+	if f.MinAmount != 0 {
+		v.Set("minAmount", strconv.FormatInt(f.MinAmount, 10))
+	}
+	if f.MaxAmount != 0 {
+		v.Set("maxAmount", strconv.FormatInt(f.MaxAmount, 10))
+	}
+	set("status", f.Status)
+	set("type", f.Type)
+	set("scheme", f.Scheme)
+	set("maskedPan", f.MaskedPAN)
+	if f.Page != 0 {
+		v.Set("page", strconv.Itoa(f.Page))
+	}
+	if f.PerPage != 0 {
+		v.Set("perPage", strconv.Itoa(f.PerPage))
+	}
+	return v
+}
+
+// GetList returns one page of transactions matching the filter, which may
+// be nil.
+func (c *TransactionService) GetList(ctx context.Context, filter *TransactionFilter, v interface{}) (err error) {
+	if filter == nil {
+		filter = &TransactionFilter{}
+	}
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	rel := url.URL{Path: "transactions", RawQuery: filter.values().Encode()}
+	return c.client.send(ctx, "list transactions", http.MethodGet, rel, nil, v)
+}
+
+// GetAll walks every page of transactions matching the filter, starting at
+// filter.Page.
+func (c *TransactionService) GetAll(ctx context.Context, filter *TransactionFilter) ([]Transaction, error) {
+	f := TransactionFilter{}
+	if filter != nil {
+		f = *filter
+	}
+	if f.Page == 0 {
+		f.Page = 1
+	}
+
+	all := []Transaction{}
+	for {
+		page := &TransactionList{}
+		if err := c.GetList(ctx, &f, page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Items...)
+		if len(page.Items) == 0 || f.Page >= page.TotalPages {
+			return all, nil
+		}
+		f.Page++
+	}
+}
+
+func (c *TransactionService) GetDetails(ctx context.Context, ref string, v interface{}) (err error) {
+	path := "transactions/%s"
+	rel := url.URL{Path: fmt.Sprintf(path, ref)}
+	return c.client.send(ctx, "get transaction", http.MethodGet, rel, nil, v)
+}
@@ -0,0 +1,106 @@
+package softpos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const transactionJSON = `{"reference":"%s","merchantId":"600086900","terminalId":"66770050","batchRef":"b-12","type":"Sale","status":"%s",
+	"amount":25000,"refundedAmount":%d,"currency":634,"scheme":"VISA","maskedPan":"411111******1111","authCode":"A1B2C3","rrn":"208812345678",
+	"responseCode":"00","settled":false,"created":"2022-03-28T09:16:29Z"}`
+
+func TestTransactionUnmarshal(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/transactions/t-1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, transactionJSON, "t-1", TransactionPartiallyRefunded, 5000)
+	})
+	mux.HandleFunc("/transactions/t-2", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	txn := &Transaction{}
+	if err := c.TransactionService.GetDetails(context.Background(), "t-1", txn); err != nil {
+		t.Fatalf("GetDetails error = %v", err)
+	}
+	if txn.Amount != (Money{Amount: 25000, Currency: 634}) || txn.RefundedAmount.Currency != 634 {
+		t.Errorf("Amount = %v, RefundedAmount = %v", txn.Amount, txn.RefundedAmount)
+	}
+	if got := txn.Refundable().Format(qar); got != "200.00 QR" {
+		t.Errorf("Refundable() = %s, want 200.00 QR", got)
+	}
+	if !txn.Created.Equal(time.Date(2022, 3, 28, 9, 16, 29, 0, time.UTC)) {
+		t.Errorf("Created = %v", txn.Created)
+	}
+
+	if err := c.TransactionService.GetDetails(context.Background(), "t-2", txn); !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("GetDetails error = %v, want %v", err, ErrEntityNotFound)
+	}
+}
+
+func TestTransactionFilterQuery(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	want := "batchRef=b-12&from=2022-03-28T00%3A00%3A00Z&maskedPan=1111&maxAmount=30000&minAmount=20000" +
+		"&page=2&scheme=VISA&status=Approved&terminalId=66770050&to=2022-03-29T00%3A00%3A00Z"
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.RawQuery != want {
+			t.Errorf("query = %s, want %s", r.URL.RawQuery, want)
+		}
+		fmt.Fprintf(w, `{"index":2,"totalPages":2,"count":1,"items":[`+transactionJSON+`]}`, "t-1", TransactionApproved, 0)
+	})
+
+	day := time.Date(2022, 3, 28, 0, 0, 0, 0, time.UTC)
+	f := &TransactionFilter{
+		TerminalID: "66770050",
+		BatchRef:   "b-12",
+		From:       day,
+		To:         day.Add(24 * time.Hour),
+		MinAmount:  20000,
+		MaxAmount:  30000,
+		Status:     TransactionApproved,
+		Scheme:     "VISA",
+		MaskedPAN:  "1111",
+		Page:       2,
+	}
+	list := &TransactionList{}
+	if err := c.TransactionService.GetList(context.Background(), f, list); err != nil {
+		t.Fatalf("GetList error = %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].Amount.Currency != 634 {
+		t.Errorf("GetList = %+v", list)
+	}
+
+	f.From, f.To = f.To, f.From
+	if err := c.TransactionService.GetList(context.Background(), f, list); err == nil {
+		t.Error("GetList with from after to succeeded")
+	}
+}
+
+func TestTransactionGetAll(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	pages := 0
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		page := r.URL.Query().Get("page")
+		fmt.Fprintf(w, `{"index":%s,"totalPages":3,"count":1,"items":[`+transactionJSON+`]}`, page, "t-"+page, TransactionApproved, 0)
+	})
+
+	all, err := c.TransactionService.GetAll(context.Background(), &TransactionFilter{MerchantID: "600086900"})
+	if err != nil {
+		t.Fatalf("GetAll error = %v", err)
+	}
+	if pages != 3 || len(all) != 3 || all[2].Reference != "t-3" {
+		t.Errorf("GetAll fetched %d pages, %d items", pages, len(all))
+	}
+}
@@ -0,0 +1,156 @@
+package softpos
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	phoneRe      = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	languageRe   = regexp.MustCompile(`^[a-z]{2}$`)
+	terminalIDRe = regexp.MustCompile(`^[A-Za-z0-9]{8}$`)
+	mccRe        = regexp.MustCompile(`^[0-9]{4}$`)
+	postalCodeRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]*$`)
+)
+
+// ValidationError maps JSON field names to a description of what is wrong
+// with them. It matches ErrIncorrect with errors.Is, the same as a 400
+// response from the TMS.
+type ValidationError map[string]string
+
+func (e ValidationError) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f, e[f]))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e ValidationError) Is(target error) bool {
+	return target == ErrIncorrect
+}
+
+func (e ValidationError) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		e[field] = "is required"
+		return false
+	}
+	return true
+}
+
+func (e ValidationError) maxLen(field, value string, n int) {
+	if utf8.RuneCountInString(value) > n {
+		e[field] = fmt.Sprintf("must be at most %d characters", n)
+	}
+}
+
+func (e ValidationError) match(field, value string, re *regexp.Regexp, msg string) {
+	if value != "" && !re.MatchString(value) {
+		e[field] = msg
+	}
+}
+
+func (e ValidationError) email(field, value string) {
+	if value == "" {
+		return
+	}
+	if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+		e[field] = "must be a valid email address"
+		return
+	}
+	e.maxLen(field, value, 254)
+}
+
+func (e ValidationError) country(field string, code int) {
+	if code != 0 && !IsCountryCode(code) {
+		e[field] = fmt.Sprintf("unknown country code %d", code)
+	}
+}
+
+func (e ValidationError) currency(field string, code int) {
+	if code != 0 && !IsCurrencyCode(code) {
+		e[field] = fmt.Sprintf("unknown currency code %d", code)
+	}
+}
+
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+const (
+	msgPhone    = "must be an E.164 phone number, e.g. +97444445555"
+	msgMcc      = "must be a 4 digit merchant category code"
+	msgLanguage = "must be a 2 letter ISO 639-1 language code"
+)
+
+// Validate checks the merchant before it is submitted to the TMS. The
+// returned error, if any, is a ValidationError.
+func (m *MerchantDetails) Validate() error {
+	e := ValidationError{}
+
+	if e.required("merchantId", m.MerchantID) {
+		e.maxLen("merchantId", m.MerchantID, 15)
+	}
+	if e.required("name", m.Name) {
+		e.maxLen("name", m.Name, 100)
+	}
+	e.required("acquirer", m.Acquirer)
+	if m.Country == 0 {
+		e["country"] = "is required"
+	}
+	e.country("country", m.Country)
+	if m.Currency == 0 {
+		e["currency"] = "is required"
+	}
+	e.currency("currency", m.Currency)
+	if e.required("mcc", string(m.Mcc)) {
+		e.match("mcc", string(m.Mcc), mccRe, msgMcc)
+	}
+
+	e.match("phone", m.Phone, phoneRe, msgPhone)
+	e.email("email", m.Email)
+	e.match("language", m.Language, languageRe, msgLanguage)
+	e.maxLen("taxRefNumber", m.TaxRefNumber, 50)
+	e.maxLen("city", m.City, 50)
+	e.maxLen("region", m.Region, 50)
+	e.maxLen("address", m.Address, 200)
+	e.match("postalCode", m.PostalCode, postalCodeRe, "must contain only letters, digits, spaces and dashes")
+	e.maxLen("postalCode", m.PostalCode, 10)
+
+	return e.err()
+}
+
+// Validate checks the terminal before it is submitted to the TMS. The
+// returned error, if any, is a ValidationError.
+func (t *Terminal) Validate() error {
+	e := ValidationError{}
+
+	if e.required("terminalId", t.TerminalID) {
+		e.match("terminalId", t.TerminalID, terminalIDRe, "must be 8 letters or digits")
+	}
+	e.currency("currency", t.Currency)
+	if t.Mcc != 0 && !t.Mcc.Valid() {
+		e["mcc"] = msgMcc
+	}
+	e.match("phone", t.Phone, phoneRe, msgPhone)
+	e.email("email", t.Email)
+	e.match("language", t.Language, languageRe, msgLanguage)
+	e.maxLen("name", t.Name, 100)
+	e.maxLen("note", t.Note, 255)
+	e.inputMethods("inputMethods", t.InputMethods)
+
+	return e.err()
+}
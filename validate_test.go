@@ -0,0 +1,101 @@
+package softpos
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func validMerchant() MerchantDetails {
+	return MerchantDetails{
+		State:      "Active",
+		MerchantID: "750074750",
+		Name:       "Merchant Test",
+		Country:    634,
+		City:       "Doha",
+		Address:    "west bay, doha",
+		PostalCode: "12300",
+		Phone:      "+97465743782",
+		Email:      "zak.exemple@cbq.qa",
+		Acquirer:   "cbq",
+		Currency:   634,
+		Mcc:        "5812",
+		Language:   "en",
+		Profile:    "default",
+	}
+}
+
+func validTerminal() Terminal {
+	return Terminal{
+		TerminalID: "66770050",
+		Currency:   634,
+		Phone:      "+97453627564",
+		Email:      "zak.example@cbq.qa",
+		Name:       "zak termname",
+		Mcc:        5812,
+		Language:   "en",
+	}
+}
+
+func fieldsOf(err error) []string {
+	var ve ValidationError
+	if !errors.As(err, &ve) {
+		return nil
+	}
+	fields := []string{}
+	for f := range ve {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestMerchantValidate(t *testing.T) {
+	m := validMerchant()
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+
+	m.MerchantID = ""
+	m.Phone = "44448888"
+	m.Email = "not an email"
+	m.Mcc = "581"
+	m.Country = 999
+	m.Currency = 1
+	m.Language = "english"
+	m.PostalCode = "12300/1"
+
+	err := m.Validate()
+	if !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrIncorrect)
+	}
+	want := []string{"country", "currency", "email", "language", "mcc", "merchantId", "phone", "postalCode"}
+	if got := fieldsOf(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() fields = %v, want %v", got, want)
+	}
+}
+
+func TestTerminalValidate(t *testing.T) {
+	term := validTerminal()
+	if err := term.Validate(); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+
+	term.TerminalID = "6677005"
+	term.Mcc = 58120
+	term.Email = "zak@"
+	term.Language = "EN"
+
+	want := []string{"email", "language", "mcc", "terminalId"}
+	if got := fieldsOf(term.Validate()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate() fields = %v, want %v", got, want)
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := ValidationError{"phone": "bad", "email": "bad"}
+	if got, want := err.Error(), "validation failed: email: bad; phone: bad"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
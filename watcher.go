@@ -0,0 +1,272 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change kinds.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Entities a ChangeEvent is about.
+const (
+	EntityMerchant = "merchant"
+	EntityTerminal = "terminal"
+)
+
+// ChangeEvent is a change the Watcher found between two snapshots. For a
+// deletion Merchant or Terminal holds the last known state. Fields lists
+// the changed fields of an update by JSON path, e.g. "merchant.state".
+type ChangeEvent struct {
+	Kind       string
+	Entity     string
+	MerchantID string
+	TerminalID string
+	Merchant   *MerchantListItem
+	Terminal   *TemrinalDetails
+	Fields     []FieldChange
+	Detected   time.Time
+}
+
+// DiffFields compares two values of the same struct type field by field
+// and returns the differences by JSON path. Nested structs are compared
+// field by field, slices and maps as a whole.
+func DiffFields(old, new interface{}) []FieldChange {
+	changes := []FieldChange{}
+	diffValue("", reflect.ValueOf(old), reflect.ValueOf(new), &changes)
+	return changes
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func diffValue(path string, a, b reflect.Value, out *[]FieldChange) {
+	for a.Kind() == reflect.Ptr && b.Kind() == reflect.Ptr && !a.IsNil() && !b.IsNil() {
+		a, b = a.Elem(), b.Elem()
+	}
+
+	switch {
+	case a.Type() == timeType:
+		if !a.Interface().(time.Time).Equal(b.Interface().(time.Time)) {
+			*out = append(*out, FieldChange{path, a.Interface(), b.Interface()})
+		}
+	case a.Kind() == reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValue(name, a.Field(i), b.Field(i), out)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, FieldChange{path, a.Interface(), b.Interface()})
+		}
+	}
+}
+
+// Watcher polls merchants and their terminals and reports what changed
+// since the previous poll. Entities whose Updated timestamp is unchanged
+// are not compared field by field.
+type Watcher struct {
+	client *Client
+
+	// Interval is the time between polls.
+	Interval time.Duration
+	// MaxBackoff caps the wait after failed polls, which doubles from
+	// Interval with each consecutive failure.
+	MaxBackoff time.Duration
+	// Terminals enables watching the terminals of every merchant.
+	Terminals bool
+	// OnError is called with the error of a failed poll.
+	OnError func(error)
+
+	primed    bool
+	merchants map[string]MerchantListItem
+	terminals map[string]TemrinalDetails
+	now       func() time.Time
+}
+
+func NewWatcher(client *Client) *Watcher {
+	return &Watcher{
+		client:     client,
+		Interval:   time.Minute,
+		MaxBackoff: 10 * time.Minute,
+		Terminals:  true,
+		now:        time.Now,
+	}
+}
+
+// Poll takes a snapshot and returns the changes since the previous one.
+// The first poll only records the snapshot. A failed poll leaves the
+// previous snapshot in place so no deletions are reported by mistake.
+func (w *Watcher) Poll(ctx context.Context) ([]ChangeEvent, error) {
+	items, err := w.client.MerchantService.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	merchants := map[string]MerchantListItem{}
+	for _, m := range items {
+		merchants[m.MerchantID] = m
+	}
+
+	terminals := map[string]TemrinalDetails{}
+	if w.Terminals {
+		for _, m := range items {
+			page := []TemrinalDetails{}
+			if err := w.client.TerminalService.GetListByMerchnat(ctx, m.MerchantID, &page); err != nil {
+				return nil, fmt.Errorf("merchant %s: %w", m.MerchantID, err)
+			}
+			for _, t := range page {
+				terminals[m.MerchantID+"/"+t.TerminalID] = t
+			}
+		}
+	}
+
+	events := []ChangeEvent{}
+	if w.primed {
+		now := w.now()
+		events = append(events, w.diffMerchants(merchants, now)...)
+		events = append(events, w.diffTerminals(terminals, now)...)
+	}
+	w.merchants, w.terminals, w.primed = merchants, terminals, true
+	return events, nil
+}
+
+func (w *Watcher) diffMerchants(current map[string]MerchantListItem, now time.Time) []ChangeEvent {
+	events := []ChangeEvent{}
+	for _, id := range sortedKeys(current, w.merchants) {
+		cur, inNew := current[id]
+		old, inOld := w.merchants[id]
+		e := ChangeEvent{Entity: EntityMerchant, MerchantID: id, Detected: now}
+		switch {
+		case !inOld:
+			e.Kind, e.Merchant = ChangeCreated, &cur
+		case !inNew:
+			e.Kind, e.Merchant = ChangeDeleted, &old
+		case !cur.Updated.IsZero() && cur.Updated.Equal(old.Updated):
+			continue
+		default:
+			if e.Fields = DiffFields(old, cur); len(e.Fields) == 0 {
+				continue
+			}
+			e.Kind, e.Merchant = ChangeUpdated, &cur
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func (w *Watcher) diffTerminals(current map[string]TemrinalDetails, now time.Time) []ChangeEvent {
+	events := []ChangeEvent{}
+	for _, key := range sortedKeys(current, w.terminals) {
+		cur, inNew := current[key]
+		old, inOld := w.terminals[key]
+		ids := strings.SplitN(key, "/", 2)
+		e := ChangeEvent{Entity: EntityTerminal, MerchantID: ids[0], TerminalID: ids[1], Detected: now}
+		switch {
+		case !inOld:
+			e.Kind, e.Terminal = ChangeCreated, &cur
+		case !inNew:
+			e.Kind, e.Terminal = ChangeDeleted, &old
+		case !cur.Updated.IsZero() && cur.Updated.Equal(old.Updated):
+			continue
+		default:
+			if e.Fields = DiffFields(old, cur); len(e.Fields) == 0 {
+				continue
+			}
+			e.Kind, e.Terminal = ChangeUpdated, &cur
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// sortedKeys returns the keys of both snapshots in order.
+func sortedKeys(a, b interface{}) []string {
+	seen := map[string]bool{}
+	for _, m := range []interface{}{a, b} {
+		for _, k := range reflect.ValueOf(m).MapKeys() {
+			seen[k.String()] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Watch polls until ctx is done and sends the changes on the returned
+// channel, which is closed when the watcher stops. The first poll happens
+// right away.
+func (w *Watcher) Watch(ctx context.Context) <-chan ChangeEvent {
+	ch := make(chan ChangeEvent)
+	go func() {
+		defer close(ch)
+		failures := 0
+		for {
+			events, err := w.Poll(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				failures++
+				if w.OnError != nil {
+					w.OnError(err)
+				}
+			} else {
+				failures = 0
+			}
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			timer := time.NewTimer(w.wait(failures))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+	return ch
+}
+
+func (w *Watcher) wait(failures int) time.Duration {
+	d := w.Interval
+	if d <= 0 {
+		d = time.Second
+	}
+	for i := 0; i < failures && d < w.MaxBackoff; i++ {
+		d *= 2
+	}
+	if failures > 0 && w.MaxBackoff > 0 && d > w.MaxBackoff {
+		d = w.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,181 @@
+package softpos
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffFields(t *testing.T) {
+	a := TemrinalDetails{TerminalID: "66770050", State: "Active", InputMethods: InputMethods{InputContactless}}
+	a.Merchant.State = "Active"
+	b := a
+	b.State = "Suspended"
+	b.Merchant.State = "Suspended"
+	b.InputMethods = InputMethods{InputContactless, InputManual}
+	b.Updated = time.Now()
+
+	got := []string{}
+	for _, c := range DiffFields(a, b) {
+		got = append(got, c.Field)
+	}
+	if strings.Join(got, ",") != "merchant.state,inputMethods,state,updated" {
+		t.Errorf("DiffFields = %v", got)
+	}
+	if d := DiffFields(&a, &a); len(d) != 0 {
+		t.Errorf("DiffFields of equal values = %v", d)
+	}
+}
+
+type fakeTMS struct {
+	mu        sync.Mutex
+	merchants string
+	pages     map[string]string
+	terminals map[string]string
+	fail      bool
+	listed    int
+}
+
+func (f *fakeTMS) register(t *testing.T, mux *http.ServeMux) {
+	mux.HandleFunc("/merchants", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if page, ok := f.pages[r.URL.Query().Get("page")]; ok {
+			fmt.Fprint(w, page)
+			return
+		}
+		fmt.Fprint(w, f.merchants)
+	})
+	mux.HandleFunc("/merchants/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.listed++
+		mid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/merchants/"), "/terminals")
+		fmt.Fprint(w, f.terminals[mid])
+	})
+}
+
+func (f *fakeTMS) set(merchants string, terminals map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.merchants, f.terminals = merchants, terminals
+}
+
+func TestWatcherPoll(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	tms := &fakeTMS{}
+	tms.register(t, mux)
+	tms.set(`{"items":[{"merchantId":"600086900","state":"Active","updated":"2022-03-01T00:00:00Z"}]}`,
+		map[string]string{"600086900": `[{"terminalId":"66770050","state":"Active","updated":"2022-03-01T00:00:00Z"},
+			{"terminalId":"66770051","state":"Active","updated":"2022-03-01T00:00:00Z"}]`})
+
+	w := NewWatcher(c)
+	ctx := context.Background()
+	if events, err := w.Poll(ctx); err != nil || len(events) != 0 {
+		t.Fatalf("first Poll = %v, %v", events, err)
+	}
+
+	tms.set(`{"items":[{"merchantId":"600086900","state":"Suspended","updated":"2022-03-02T00:00:00Z"},{"merchantId":"999700163"}]}`,
+		map[string]string{"600086900": `[{"terminalId":"66770050","state":"Blocked","updated":"2022-03-01T00:00:00Z"},
+			{"terminalId":"66770052","state":"Active"}]`, "999700163": `[]`})
+
+	events, err := w.Poll(ctx)
+	if err != nil {
+		t.Fatalf("Poll error = %v", err)
+	}
+	got := []string{}
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s %s %s%s", e.Kind, e.Entity, e.MerchantID, e.TerminalID))
+	}
+	want := []string{
+		"updated merchant 600086900",
+		"created merchant 999700163",
+		"deleted terminal 60008690066770051",
+		"created terminal 60008690066770052",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if f := events[0].Fields; len(f) != 2 || f[0].Field != "state" || f[0].Old != "Active" || f[0].New != "Suspended" {
+		t.Errorf("merchant fields = %+v", f)
+	}
+	if events[2].Terminal == nil || events[2].Terminal.State != "Active" {
+		t.Errorf("deleted terminal = %+v", events[2].Terminal)
+	}
+
+	tms.mu.Lock()
+	tms.pages = map[string]string{
+		"1": `{"totalPages":2,"items":[{"merchantId":"600086900","state":"Suspended","updated":"2022-03-02T00:00:00Z"}]}`,
+		"2": `{"totalPages":2,"items":[{"merchantId":"999700163"}]}`,
+	}
+	tms.mu.Unlock()
+	if events, err := w.Poll(ctx); err != nil || len(events) != 0 {
+		t.Errorf("Poll of paged merchants = %+v, %v", events, err)
+	}
+
+	tms.mu.Lock()
+	tms.fail = true
+	tms.mu.Unlock()
+	if _, err := w.Poll(ctx); err == nil {
+		t.Error("Poll of failing TMS succeeded")
+	}
+	if len(w.merchants) != 2 {
+		t.Error("failed poll replaced the snapshot")
+	}
+}
+
+func TestWatcherWatch(t *testing.T) {
+	c, mux, _, teardown := setup()
+	defer teardown()
+
+	tms := &fakeTMS{fail: true}
+	tms.register(t, mux)
+	tms.set(`{"items":[{"merchantId":"600086900"}]}`, map[string]string{"600086900": `[]`})
+
+	w := NewWatcher(c)
+	w.Interval = 5 * time.Millisecond
+	w.MaxBackoff = 20 * time.Millisecond
+	errs := make(chan error, 10)
+	w.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := w.Watch(ctx)
+
+	<-errs
+	tms.mu.Lock()
+	tms.fail = false
+	tms.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	tms.set(`{"items":[{"merchantId":"600086900"},{"merchantId":"999700163"}]}`, map[string]string{"600086900": `[]`, "999700163": `[]`})
+
+	e := <-ch
+	if e.Kind != ChangeCreated || e.MerchantID != "999700163" {
+		t.Errorf("event = %+v", e)
+	}
+	cancel()
+	for range ch {
+	}
+
+	if d := w.wait(10); d != w.MaxBackoff {
+		t.Errorf("wait(10) = %v, want %v", d, w.MaxBackoff)
+	}
+	if d := w.wait(1); d != 10*time.Millisecond {
+		t.Errorf("wait(1) = %v", d)
+	}
+}
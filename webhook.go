@@ -0,0 +1,261 @@
+package softpos
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256 of the
+// timestamp, a dot and the body, keyed with the shared secret.
+const (
+	WebhookSignatureHeader = "X-Softpos-Signature"
+	WebhookTimestampHeader = "X-Softpos-Timestamp"
+)
+
+// Event types.
+const (
+	EventTerminalActivated = "terminal.activated"
+	EventKeysConfirmed     = "terminal.keys_confirmed"
+	EventMerchantSuspended = "merchant.suspended"
+	EventBatchClosed       = "batch.closed"
+)
+
+const maxWebhookBody = 1 << 20
+
+// Event is a webhook notification. Data holds the entity the event is
+// about.
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Created time.Time       `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type TerminalEvent struct {
+	Event
+	Terminal TemrinalDetails
+}
+
+type MerchantEvent struct {
+	Event
+	Merchant MerchantDetails
+}
+
+type BatchEvent struct {
+	Event
+	Batch Batch
+}
+
+// SignWebhook returns the signature header value for a body sent at ts.
+func SignWebhook(secret []byte, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%d.", ts.Unix())
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EventDeduper remembers processed events so redelivered ones are
+// acknowledged without running the handlers again.
+type EventDeduper interface {
+	// Claim reserves the event ID; it returns false when the event was
+	// already processed or is being processed.
+	Claim(id string) bool
+	// Release ends a claim. Processed events are remembered, others may be
+	// claimed again on redelivery.
+	Release(id string, processed bool)
+}
+
+// memoryDeduper remembers processed events for ttl.
+type memoryDeduper struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	inFlight map[string]bool
+	done     map[string]time.Time
+}
+
+// NewMemoryDeduper returns an EventDeduper keeping event IDs in memory for
+// ttl, which should exceed the TMS retry period.
+func NewMemoryDeduper(ttl time.Duration) EventDeduper {
+	return &memoryDeduper{ttl: ttl, inFlight: map[string]bool{}, done: map[string]time.Time{}}
+}
+
+func (d *memoryDeduper) Claim(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range d.done {
+		if now.Sub(t) > d.ttl {
+			delete(d.done, k)
+		}
+	}
+	if _, ok := d.done[id]; ok || d.inFlight[id] {
+		return false
+	}
+	d.inFlight[id] = true
+	return true
+}
+
+func (d *memoryDeduper) Release(id string, processed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, id)
+	if processed {
+		d.done[id] = time.Now()
+	}
+}
+
+// WebhookHandler receives TMS notifications. It rejects requests with a
+// bad signature or a timestamp outside Tolerance, and answers 500 when a
+// handler fails so the TMS delivers the event again.
+type WebhookHandler struct {
+	secret    []byte
+	Tolerance time.Duration
+	Deduper   EventDeduper
+	Logger    Logger
+
+	mu       sync.RWMutex
+	handlers map[string][]func(context.Context, *Event) error
+	now      func() time.Time
+}
+
+func NewWebhookHandler(secret string) *WebhookHandler {
+	return &WebhookHandler{
+		secret:    []byte(secret),
+		Tolerance: 5 * time.Minute,
+		Deduper:   NewMemoryDeduper(24 * time.Hour),
+		handlers:  map[string][]func(context.Context, *Event) error{},
+		now:       time.Now,
+	}
+}
+
+// On registers a handler for the raw events of a type.
+func (h *WebhookHandler) On(eventType string, fn func(context.Context, *Event) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[eventType] = append(h.handlers[eventType], fn)
+}
+
+func (h *WebhookHandler) onTerminal(eventType string, fn func(context.Context, *TerminalEvent) error) {
+	h.On(eventType, func(ctx context.Context, e *Event) error {
+		te := &TerminalEvent{Event: *e}
+		if err := json.Unmarshal(e.Data, &te.Terminal); err != nil {
+			return err
+		}
+		return fn(ctx, te)
+	})
+}
+
+func (h *WebhookHandler) OnTerminalActivated(fn func(context.Context, *TerminalEvent) error) {
+	h.onTerminal(EventTerminalActivated, fn)
+}
+
+func (h *WebhookHandler) OnKeysConfirmed(fn func(context.Context, *TerminalEvent) error) {
+	h.onTerminal(EventKeysConfirmed, fn)
+}
+
+func (h *WebhookHandler) OnMerchantSuspended(fn func(context.Context, *MerchantEvent) error) {
+	h.On(EventMerchantSuspended, func(ctx context.Context, e *Event) error {
+		me := &MerchantEvent{Event: *e}
+		if err := json.Unmarshal(e.Data, &me.Merchant); err != nil {
+			return err
+		}
+		return fn(ctx, me)
+	})
+}
+
+func (h *WebhookHandler) OnBatchClosed(fn func(context.Context, *BatchEvent) error) {
+	h.On(EventBatchClosed, func(ctx context.Context, e *Event) error {
+		be := &BatchEvent{Event: *e}
+		if err := json.Unmarshal(e.Data, &be.Batch); err != nil {
+			return err
+		}
+		return fn(ctx, be)
+	})
+}
+
+// Verify checks the signature and timestamp headers of a body.
+func (h *WebhookHandler) Verify(header http.Header, body []byte) error {
+	sec, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook timestamp: %w", ErrWebhookSignature)
+	}
+	ts := time.Unix(sec, 0)
+	if d := h.now().Sub(ts); d > h.Tolerance || d < -h.Tolerance {
+		return fmt.Errorf("webhook timestamp %s out of tolerance: %w", ts.UTC().Format(time.RFC3339), ErrWebhookSignature)
+	}
+
+	got, err := hex.DecodeString(header.Get(WebhookSignatureHeader))
+	want, _ := hex.DecodeString(SignWebhook(h.secret, ts, body))
+	if err != nil || !hmac.Equal(got, want) {
+		return fmt.Errorf("webhook signature: %w", ErrWebhookSignature)
+	}
+	return nil
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil || len(body) > maxWebhookBody {
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Verify(r.Header, body); err != nil {
+		h.logf("%v", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	e := &Event{}
+	if err := json.Unmarshal(body, e); err != nil || e.ID == "" || e.Type == "" {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	if !h.Deduper.Claim(e.ID) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	err = h.dispatch(r.Context(), e)
+	h.Deduper.Release(e.ID, err == nil)
+	if err != nil {
+		h.logf("webhook event %s %s: %v", e.Type, e.ID, err)
+		http.Error(w, "event not processed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *WebhookHandler) dispatch(ctx context.Context, e *Event) error {
+	h.mu.RLock()
+	handlers := h.handlers[e.Type]
+	h.mu.RUnlock()
+
+	for _, fn := range handlers {
+		if err := fn(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *WebhookHandler) logf(format string, args ...interface{}) {
+	if h.Logger != nil {
+		h.Logger.Warnf(format, args...)
+	}
+}
@@ -0,0 +1,144 @@
+package softpos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const webhookSecret = "whsec_test"
+
+func webhookRequest(body string, ts time.Time, secret string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/softpos", strings.NewReader(body))
+	r.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	r.Header.Set(WebhookSignatureHeader, SignWebhook([]byte(secret), ts, []byte(body)))
+	return r
+}
+
+func TestWebhookHandlerVerify(t *testing.T) {
+	now := time.Date(2022, 3, 28, 9, 0, 0, 0, time.UTC)
+	h := NewWebhookHandler(webhookSecret)
+	h.now = func() time.Time { return now }
+
+	body := `{"id":"evt-1","type":"terminal.activated","data":{}}`
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"valid", webhookRequest(body, now, webhookSecret), http.StatusOK},
+		{"wrong secret", webhookRequest(body, now, "other"), http.StatusUnauthorized},
+		{"replayed", webhookRequest(body, now.Add(-10*time.Minute), webhookSecret), http.StatusUnauthorized},
+		{"future", webhookRequest(body, now.Add(10*time.Minute), webhookSecret), http.StatusUnauthorized},
+		{"get", httptest.NewRequest(http.MethodGet, "/", nil), http.StatusMethodNotAllowed},
+		{"not an event", webhookRequest(`{"id":""}`, now, webhookSecret), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, tt.req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	tampered := webhookRequest(body, now, webhookSecret)
+	tampered.Header.Set(WebhookTimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+	if err := h.Verify(tampered.Header, []byte(body)); !errors.Is(err, ErrWebhookSignature) {
+		t.Errorf("Verify error = %v, want %v", err, ErrWebhookSignature)
+	}
+}
+
+func TestWebhookHandlerDispatch(t *testing.T) {
+	now := time.Now()
+	h := NewWebhookHandler(webhookSecret)
+
+	var activated, suspended, batches int32
+	h.OnTerminalActivated(func(ctx context.Context, e *TerminalEvent) error {
+		if e.Terminal.TerminalID != "66770050" || e.Terminal.Merchant.MerchantID != "600086900" {
+			t.Errorf("terminal event = %+v", e.Terminal)
+		}
+		atomic.AddInt32(&activated, 1)
+		return nil
+	})
+	h.OnMerchantSuspended(func(ctx context.Context, e *MerchantEvent) error {
+		if e.Merchant.State != "Suspended" {
+			t.Errorf("merchant event = %+v", e.Merchant)
+		}
+		atomic.AddInt32(&suspended, 1)
+		return nil
+	})
+	fail := true
+	h.OnBatchClosed(func(ctx context.Context, e *BatchEvent) error {
+		atomic.AddInt32(&batches, 1)
+		if fail {
+			return errors.New("database down")
+		}
+		if tot, _ := e.Batch.Total(634); tot.SalesAmount != 15050 {
+			t.Errorf("batch event = %+v", e.Batch)
+		}
+		return nil
+	})
+
+	send := func(body string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, webhookRequest(body, now, webhookSecret))
+		return w.Code
+	}
+
+	terminal := `{"id":"evt-1","type":"terminal.activated","created":"2022-03-28T09:00:00Z","data":{"terminalId":"66770050","state":"Active","merchant":{"merchantId":"600086900"}}}`
+	for i := 0; i < 2; i++ {
+		if code := send(terminal); code != http.StatusOK {
+			t.Errorf("delivery %d status = %d", i, code)
+		}
+	}
+	if activated != 1 {
+		t.Errorf("terminal handler ran %d times, want 1", activated)
+	}
+
+	if code := send(`{"id":"evt-2","type":"merchant.suspended","data":{"merchantId":"600086900","state":"Suspended"}}`); code != http.StatusOK || suspended != 1 {
+		t.Errorf("merchant event status = %d, handled %d", code, suspended)
+	}
+
+	batch := fmt.Sprintf(`{"id":"evt-3","type":"batch.closed","data":%s}`, fmt.Sprintf(batchJSON, BatchClosed))
+	if code := send(batch); code != http.StatusInternalServerError {
+		t.Errorf("failing handler status = %d, want 500", code)
+	}
+	fail = false
+	if code := send(batch); code != http.StatusOK || batches != 2 {
+		t.Errorf("redelivery status = %d, handled %d times", code, batches)
+	}
+
+	if code := send(`{"id":"evt-4","type":"terminal.deleted","data":{}}`); code != http.StatusOK {
+		t.Errorf("unhandled event status = %d", code)
+	}
+}
+
+func TestMemoryDeduper(t *testing.T) {
+	d := NewMemoryDeduper(time.Hour)
+	if !d.Claim("a") || d.Claim("a") {
+		t.Fatal("in flight event claimed twice")
+	}
+	d.Release("a", false)
+	if !d.Claim("a") {
+		t.Fatal("failed event not claimable again")
+	}
+	d.Release("a", true)
+	if d.Claim("a") {
+		t.Error("processed event claimed again")
+	}
+
+	d = NewMemoryDeduper(0)
+	d.Claim("b")
+	d.Release("b", true)
+	time.Sleep(time.Millisecond)
+	if !d.Claim("b") {
+		t.Error("expired event not claimable")
+	}
+}